@@ -1,11 +1,14 @@
 package baradb
 
 import (
+	"context"
+	"encoding/binary"
 	"sync"
 	"sync/atomic"
 
 	"github.com/saint-yellow/baradb/data"
 	"github.com/saint-yellow/baradb/index"
+	"github.com/saint-yellow/baradb/metrics"
 )
 
 // nonTranNo This is not a transaction serial number
@@ -19,13 +22,21 @@ type WriteBatch struct {
 	mu            *sync.RWMutex              // Lock
 	db            *DB                        // DB engine
 	options       WriteBatchOptions          // options for batch writing
-	pendingWrites map[string]*data.LogRecord // data (log records) pending to be writen
+	pendingWrites map[string]*data.LogRecord // data (log records) pending to be writen, see pendingKey
+}
+
+// pendingKey returns the key of a log record pending to be written, which tells keys of different column families apart
+func pendingKey(family uint32, key []byte) string {
+	buffer := make([]byte, binary.MaxVarintLen32+len(key))
+	n := binary.PutUvarint(buffer, uint64(family))
+	n += copy(buffer[n:], key)
+	return string(buffer[:n])
 }
 
 // NewWriteBatch initializes a write batch in the DB engine
-func (db *DB) NewWriteBatch(options WriteBatchOptions) *WriteBatch {
-	if db.options.IndexType == index.BPtree && !db.tranNoFileExists && !db.isFirstLaunch {
-		panic("Can not use a write batch since the tran-no file does not exist")
+func (db *DB) NewWriteBatch(options WriteBatchOptions) (*WriteBatch, error) {
+	if options.MaxBatchNumber <= 0 {
+		return nil, ErrInvalidMaxBatchNumber
 	}
 
 	wb := &WriteBatch{
@@ -34,7 +45,7 @@ func (db *DB) NewWriteBatch(options WriteBatchOptions) *WriteBatch {
 		options:       options,
 		pendingWrites: make(map[string]*data.LogRecord),
 	}
-	return wb
+	return wb, nil
 }
 
 // Put writes data
@@ -43,17 +54,34 @@ func (wb *WriteBatch) Put(key, value []byte) error {
 		return ErrKeyIsEmpty
 	}
 
-	wb.mu.Lock()
-	defer wb.mu.Unlock()
-
 	lr := &data.LogRecord{
 		Key:   key,
 		Value: value,
 		Type:  data.NormalLogRecord,
 	}
+	return wb.put(lr)
+}
+
+// PutCF writes data to a column family
+func (wb *WriteBatch) PutCF(cf *ColumnFamily, key, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	lr, err := cf.newLogRecord(key, value, data.NormalLogRecord)
+	if err != nil {
+		return err
+	}
+	return wb.put(lr)
+}
+
+// put stores a log record which is pending to be written
+func (wb *WriteBatch) put(lr *data.LogRecord) error {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
 
 	// Temporarily store a log record which is pending to be written
-	wb.pendingWrites[string(key)] = lr
+	wb.pendingWrites[pendingKey(lr.Family, lr.Key)] = lr
 	return nil
 }
 
@@ -63,28 +91,51 @@ func (wb *WriteBatch) Delete(key []byte) error {
 		return ErrKeyIsEmpty
 	}
 
+	lr := &data.LogRecord{
+		Key:  key,
+		Type: data.DeletedLogRecord,
+	}
+	return wb.delete(lr, wb.db.index)
+}
+
+// DeleteCF deletes data of a column family
+func (wb *WriteBatch) DeleteCF(cf *ColumnFamily, key []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	lr, _ := cf.newLogRecord(key, nil, data.DeletedLogRecord)
+	return wb.delete(lr, cf.index)
+}
+
+// delete stores a log record of a deletion which is pending to be written, where the key is looked up in a given index
+func (wb *WriteBatch) delete(lr *data.LogRecord, idx index.Index) error {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
 	// Try to find the corresponding position in the index
 	// If the position is not found, then delete the corresponding log record in this transaction
-	lrp := wb.db.index.Get(key)
+	key := pendingKey(lr.Family, lr.Key)
+	lrp, err := idx.Get(lr.Key)
+	if err != nil {
+		return err
+	}
 	if lrp == nil {
-		if wb.pendingWrites[string(key)] != nil {
-			delete(wb.pendingWrites, string(key))
+		if wb.pendingWrites[key] != nil {
+			delete(wb.pendingWrites, key)
 		}
 		return nil
 	}
 
-	lr := &data.LogRecord{
-		Key:  key,
-		Type: data.DeletedLogRecord,
-	}
-
 	// Temporarily store a log record which is pending to be written
-	wb.pendingWrites[string(key)] = lr
+	wb.pendingWrites[key] = lr
 	return nil
 }
 
 // Commit commits the transaction, writes the pending data to the disk and updates the in-memory index
-func (wb *WriteBatch) Commit() error {
+func (wb *WriteBatch) Commit() (err error) {
+	defer wb.db.startOperation(context.Background(), metrics.OperationCommit)(&err)
+
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
 
@@ -101,26 +152,38 @@ func (wb *WriteBatch) Commit() error {
 	// Lock the DB to make sure the serialization of transaction Commit
 	wb.db.mu.Lock()
 	defer wb.db.mu.Unlock()
+	wb.db.waitForPublishes()
+
+	// Nothing is written if any column family has been dropped
+	for _, lr := range wb.pendingWrites {
+		if _, ok := wb.db.familiesByID[lr.Family]; lr.Family != 0 && !ok {
+			return ErrColumnFamilyNotFound
+		}
+	}
 
 	// Get the latest serial number of this transaction
 	transNo := atomic.AddUint64(&wb.db.tranNo, 1)
 
-	// Write pending data to a data file
+	// Write pending data to a data file, all of which are written at the same time
+	timestamp := wb.db.nextTimestamp()
 	positions := make(map[string]*data.LogRecordPosition)
-	for _, lr := range wb.pendingWrites {
+	for key, lr := range wb.pendingWrites {
 		lrp, err := wb.db.appendLogRecord(&data.LogRecord{
-			Key:   data.EncodeKey(lr.Key, transNo),
-			Value: lr.Value,
-			Type:  lr.Type,
+			Key:        data.EncodeKey(lr.Key, transNo),
+			Value:      lr.Value,
+			Type:       lr.Type,
+			Timestamp:  timestamp,
+			Family:     lr.Family,
+			Compressed: lr.Compressed,
 		}, false)
 		if err != nil {
 			return err
 		}
-		positions[string(lr.Key)] = lrp
+		positions[key] = lrp
 	}
 
 	// Add a log record that means this transaction is finished
-	_, err := wb.db.appendLogRecord(&data.LogRecord{
+	_, err = wb.db.appendLogRecord(&data.LogRecord{
 		Key:  data.EncodeKey(tranFinishedKey, transNo),
 		Type: data.TransactionFinishedLogRecord,
 	}, false)
@@ -137,20 +200,36 @@ func (wb *WriteBatch) Commit() error {
 	}
 
 	// Update in-memory index
-	for _, lr := range wb.pendingWrites {
-		lrp := positions[string(lr.Key)]
+	for key, lr := range wb.pendingWrites {
+		lrp := positions[key]
+		if lr.Family != 0 {
+			wb.db.familiesByID[lr.Family].updateIndex(lr.Key, lr.Type, lrp)
+			continue
+		}
+
 		var oldLRP *data.LogRecordPosition
+		var err error
 
 		switch lr.Type {
 		case data.DeletedLogRecord:
-			oldLRP, _ = wb.db.index.Delete(lr.Key)
+			oldLRP, _, err = wb.db.index.Delete(lr.Key)
 		case data.NormalLogRecord:
-			oldLRP = wb.db.index.Put(lr.Key, lrp)
+			oldLRP, err = wb.db.index.Put(lr.Key, lrp)
+			wb.db.addToFilter(lr.Key)
+		}
+		if err != nil {
+			return err
 		}
 
 		if oldLRP != nil {
-			wb.db.reclaimSize += int64(oldLRP.Size)
+			wb.db.reclaimSize.Add(int64(oldLRP.Size))
 		}
+		wb.db.addVersion(lr.Key, timestamp, lrp, lr.Type == data.DeletedLogRecord)
+		wb.db.dropMergeOperands(lr.Key)
+	}
+
+	if err := wb.db.saveIndexMetadata(); err != nil {
+		return err
 	}
 
 	// Clear the panding data
@@ -10,6 +10,7 @@ import (
 
 	"github.com/saint-yellow/baradb"
 	"github.com/saint-yellow/baradb/index"
+	"github.com/saint-yellow/baradb/io_handler"
 	"github.com/saint-yellow/baradb/utils"
 )
 
@@ -65,3 +66,123 @@ func Benchmark_Delete(b *testing.B) {
 		}
 	}
 }
+
+func Benchmark_MultiGet(b *testing.B) {
+	rand.New(rand.NewSource(time.Now().UnixNano()))
+	keys := make([][]byte, 500)
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		for j := range keys {
+			keys[j] = utils.NewKey(rand.Intn(b.N + 1))
+		}
+		_, errs := db.MultiGet(keys)
+		for _, err := range errs {
+			if err != nil && err != baradb.ErrKeyNotFound {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func Benchmark_GetView(b *testing.B) {
+	rand.New(rand.NewSource(time.Now().UnixNano()))
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		err := db.GetView(utils.NewKey(rand.Int()), func(value []byte) error {
+			return nil
+		})
+		if err != nil && err != baradb.ErrKeyNotFound {
+			b.Fatal(err)
+		}
+	}
+}
+
+// launchMMapDB launches a DB engine whose data files are handled by writable memory mapping,
+// with a given number of keys whose values are large
+func launchMMapDB(b *testing.B, keyNumber int) *baradb.DB {
+	opts := baradb.DefaultDBOptions
+	opts.IndexType = index.Btree
+	opts.IOHandlerType = io_handler.WritableMemoryMappedIOHandler
+	opts.Directory = b.TempDir()
+
+	mmapDB, err := baradb.Launch(opts)
+	assert.Nil(b, err)
+	b.Cleanup(func() {
+		mmapDB.Close()
+	})
+	for i := 0; i < keyNumber; i++ {
+		assert.Nil(b, mmapDB.Put(utils.NewKey(i), utils.NewRandomValue(64*1024)))
+	}
+	return mmapDB
+}
+
+func Benchmark_GetLargeValueWithMMap(b *testing.B) {
+	mmapDB := launchMMapDB(b, 100)
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_, err := mmapDB.Get(utils.NewKey(i % 100))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_GetViewLargeValueWithMMap(b *testing.B) {
+	mmapDB := launchMMapDB(b, 100)
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		err := mmapDB.GetView(utils.NewKey(i%100), func(value []byte) error {
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Benchmark_ParallelPut compares indexes under concurrent writers,
+// the index is updated after the lock of the DB engine is released, so a concurrent index lets writers scale
+func Benchmark_ParallelPut(b *testing.B) {
+	indexTypes := []struct {
+		name      string
+		indexType index.IndexType
+	}{
+		{"Btree", index.Btree},
+		{"ShardedBtree", index.ShardedBtree},
+	}
+	for _, it := range indexTypes {
+		b.Run(it.name, func(b *testing.B) {
+			opts := baradb.DefaultDBOptions
+			opts.IndexType = it.indexType
+			opts.IOHandlerType = io_handler.WritableMemoryMappedIOHandler
+			opts.Directory = b.TempDir()
+
+			parallelDB, err := baradb.Launch(opts)
+			assert.Nil(b, err)
+			b.Cleanup(func() {
+				parallelDB.Close()
+			})
+			value := utils.NewRandomValue(128)
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(time.Now().UnixNano()))
+				for pb.Next() {
+					if err := parallelDB.Put(utils.NewKey(r.Intn(1000000)), value); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
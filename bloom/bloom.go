@@ -0,0 +1,135 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+var ErrInvalidFilter = errors.New("invalid encoded Bloom filter")
+
+// Filter represents a Bloom filter of keys
+//
+// A filter never reports a key which has been added as absent,
+// and reports an absent key as present with a configured false-positive rate as long as it is not over its capacity.
+//
+// A filter is not safe for concurrent modifications, callers should synchronize them.
+type Filter struct {
+	bits     []uint64
+	m        uint64 // Number of bits
+	k        uint32 // Number of hash functions
+	capacity uint64 // Number of keys which keep the false-positive rate
+	count    uint64 // Number of added keys
+}
+
+// New constructs a filter which keeps a given false-positive rate for a given number of keys
+func New(capacity int, falsePositiveRate float64) *Filter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	n := float64(capacity)
+	m := uint64(math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint32(math.Round(float64(m) / n * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	f := &Filter{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        k,
+		capacity: uint64(capacity),
+	}
+	return f
+}
+
+// hash returns two hash values of a key, from which hash functions of the filter are derived
+func hash(key []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write(key)
+	h1 := h.Sum64()
+	h2 := (h1>>33 ^ h1) * 0xff51afd7ed558ccd
+	h2 = (h2>>33 ^ h2) | 1
+	return h1, h2
+}
+
+// Add adds a key to the filter
+func (f *Filter) Add(key []byte) {
+	h1, h2 := hash(key)
+	for i := uint32(0); i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+// MayContain reports whether a key may have been added to the filter
+func (f *Filter) MayContain(key []byte) bool {
+	h1, h2 := hash(key)
+	for i := uint32(0); i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns the number of added keys
+func (f *Filter) Count() int {
+	return int(f.count)
+}
+
+// Capacity returns the number of keys which keep the false-positive rate of the filter
+func (f *Filter) Capacity() int {
+	return int(f.capacity)
+}
+
+// Encode encodes the filter into a byte array
+func (f *Filter) Encode() []byte {
+	buffer := make([]byte, binary.MaxVarintLen64*3+binary.MaxVarintLen32+len(f.bits)*8)
+	index := 0
+	index += binary.PutUvarint(buffer[index:], f.m)
+	index += binary.PutUvarint(buffer[index:], uint64(f.k))
+	index += binary.PutUvarint(buffer[index:], f.capacity)
+	index += binary.PutUvarint(buffer[index:], f.count)
+	for _, word := range f.bits {
+		binary.LittleEndian.PutUint64(buffer[index:], word)
+		index += 8
+	}
+	return buffer[:index]
+}
+
+// Decode decodes a filter from a byte array
+func Decode(buffer []byte) (*Filter, error) {
+	index := 0
+	values := make([]uint64, 4)
+	for i := range values {
+		value, n := binary.Uvarint(buffer[index:])
+		if n <= 0 {
+			return nil, ErrInvalidFilter
+		}
+		values[i] = value
+		index += n
+	}
+
+	f := &Filter{
+		m:        values[0],
+		k:        uint32(values[1]),
+		capacity: values[2],
+		count:    values[3],
+	}
+	if f.m == 0 || f.k == 0 || uint64(len(buffer)-index) != (f.m+63)/64*8 {
+		return nil, ErrInvalidFilter
+	}
+	f.bits = make([]uint64, (f.m+63)/64)
+	for i := range f.bits {
+		f.bits[i] = binary.LittleEndian.Uint64(buffer[index:])
+		index += 8
+	}
+	return f, nil
+}
@@ -0,0 +1,54 @@
+package bloom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/saint-yellow/baradb/utils"
+)
+
+func TestFilter_AddAndMayContain(t *testing.T) {
+	capacity, rate := 10000, 0.01
+	f := New(capacity, rate)
+
+	for i := 0; i < capacity; i++ {
+		f.Add(utils.NewKey(i))
+	}
+	assert.Equal(t, capacity, f.Count())
+	assert.Equal(t, capacity, f.Capacity())
+
+	// There is no false negative
+	for i := 0; i < capacity; i++ {
+		assert.True(t, f.MayContain(utils.NewKey(i)))
+	}
+
+	// The false-positive rate is close to the configured one
+	falsePositives := 0
+	for i := capacity; i < 2*capacity; i++ {
+		if f.MayContain(utils.NewKey(i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, float64(falsePositives)/float64(capacity), 2*rate)
+}
+
+func TestFilter_EncodeAndDecode(t *testing.T) {
+	f1 := New(100, 0.001)
+	for i := 0; i < 50; i++ {
+		f1.Add(utils.NewKey(i))
+	}
+
+	f2, err := Decode(f1.Encode())
+	assert.Nil(t, err)
+	assert.Equal(t, f1, f2)
+	for i := 0; i < 50; i++ {
+		assert.True(t, f2.MayContain(utils.NewKey(i)))
+	}
+
+	_, err = Decode(nil)
+	assert.Equal(t, ErrInvalidFilter, err)
+	encoded := f1.Encode()
+	_, err = Decode(encoded[:len(encoded)-1])
+	assert.Equal(t, ErrInvalidFilter, err)
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// shardNumber Number of shards of a cache
+const shardNumber = 16
+
+// entryOverhead Approximate memory occupied by an entry besides its value (unit: B)
+const entryOverhead = 64
+
+// position identifies a log record by the data file and the offset where it is stored
+type position struct {
+	fileID uint32
+	offset int64
+}
+
+// entry represents a cached value
+type entry struct {
+	position position
+	value    []byte
+}
+
+// shard represents a part of a cache, which evicts its least recently used entries
+type shard struct {
+	lock     *sync.Mutex
+	entries  map[position]*list.Element
+	lru      *list.List // Entries ordered from the most recently used to the least recently used
+	size     int64      // Memory occupied by entries (unit: B)
+	capacity int64      // Maximum memory occupied by entries (unit: B)
+}
+
+// Cache represents a sharded LRU cache of values of log records with a budget of bytes
+//
+// Values are keyed by positions of log records, which never change once log records are written.
+// Data files are only replaced by merged ones when a DB engine is launched, before any value is cached,
+// so cached values never become invalid.
+type Cache struct {
+	shards []*shard
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// Stat represents statistical information of a cache
+type Stat struct {
+	Hits    uint64 // Number of lookups which found values
+	Misses  uint64 // Number of lookups which found nothing
+	Entries int    // Number of cached values
+	Size    int64  // Memory occupied by cached values (unit: B)
+}
+
+// New constructs a cache which occupies memory no more than a given capacity (unit: B)
+func New(capacity int64) *Cache {
+	c := &Cache{
+		shards: make([]*shard, shardNumber),
+	}
+	for i := range c.shards {
+		c.shards[i] = &shard{
+			lock:     new(sync.Mutex),
+			entries:  make(map[position]*list.Element),
+			lru:      list.New(),
+			capacity: capacity / shardNumber,
+		}
+	}
+	return c
+}
+
+func (c *Cache) shard(p position) *shard {
+	h := (uint64(p.fileID)*0x9E3779B97F4A7C15 ^ uint64(p.offset)) * 0xBF58476D1CE4E5B9
+	return c.shards[h>>60]
+}
+
+// Get returns a copy of the value of the log record at a position
+func (c *Cache) Get(fileID uint32, offset int64) ([]byte, bool) {
+	p := position{fileID: fileID, offset: offset}
+	s := c.shard(p)
+
+	s.lock.Lock()
+	element, ok := s.entries[p]
+	if !ok {
+		s.lock.Unlock()
+		c.misses.Add(1)
+		return nil, false
+	}
+	s.lru.MoveToFront(element)
+	value := append([]byte{}, element.Value.(*entry).value...)
+	s.lock.Unlock()
+
+	c.hits.Add(1)
+	return value, true
+}
+
+// Put stores a copy of the value of the log record at a position, least recently used values are evicted if necessary
+func (c *Cache) Put(fileID uint32, offset int64, value []byte) {
+	p := position{fileID: fileID, offset: offset}
+	s := c.shard(p)
+	charge := int64(len(value)) + entryOverhead
+	if charge > s.capacity {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.entries[p]; ok {
+		return
+	}
+	for s.size+charge > s.capacity {
+		s.remove(s.lru.Back())
+	}
+	e := &entry{position: p, value: append([]byte{}, value...)}
+	s.entries[p] = s.lru.PushFront(e)
+	s.size += charge
+}
+
+// Stat returns statistical information of the cache
+func (c *Cache) Stat() Stat {
+	stat := Stat{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+	for _, s := range c.shards {
+		s.lock.Lock()
+		stat.Entries += len(s.entries)
+		stat.Size += s.size
+		s.lock.Unlock()
+	}
+	return stat
+}
+
+// remove removes an entry from a shard, the caller must hold the lock of the shard
+func (s *shard) remove(element *list.Element) {
+	e := s.lru.Remove(element).(*entry)
+	delete(s.entries, e.position)
+	s.size -= int64(len(e.value)) + entryOverhead
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_PutAndGet(t *testing.T) {
+	c := New(1024 * 1024)
+
+	value, ok := c.Get(114, 514)
+	assert.False(t, ok)
+	assert.Nil(t, value)
+
+	original := []byte("1919810")
+	c.Put(114, 514, original)
+	value, ok = c.Get(114, 514)
+	assert.True(t, ok)
+	assert.Equal(t, "1919810", string(value))
+
+	// Cached values are copies
+	original[0] = '0'
+	value[1] = '0'
+	value, _ = c.Get(114, 514)
+	assert.Equal(t, "1919810", string(value))
+
+	_, ok = c.Get(114, 515)
+	assert.False(t, ok)
+
+	stat := c.Stat()
+	assert.Equal(t, uint64(2), stat.Hits)
+	assert.Equal(t, uint64(2), stat.Misses)
+	assert.Equal(t, 1, stat.Entries)
+	assert.Equal(t, int64(len(value)+entryOverhead), stat.Size)
+}
+
+func TestCache_Eviction(t *testing.T) {
+	capacity := int64(shardNumber * (100 + entryOverhead) * 10)
+	c := New(capacity)
+
+	// A value larger than a shard is never cached
+	c.Put(0, 0, make([]byte, capacity))
+	assert.Zero(t, c.Stat().Entries)
+
+	for i := 0; i < 10000; i++ {
+		c.Put(1, int64(i), make([]byte, 100))
+	}
+	stat := c.Stat()
+	assert.LessOrEqual(t, stat.Size, capacity)
+	assert.Greater(t, stat.Entries, 0)
+	assert.Less(t, stat.Entries, 10000)
+
+	// The most recently used values are kept
+	_, ok := c.Get(1, 9999)
+	assert.True(t, ok)
+	_, ok = c.Get(1, 0)
+	assert.False(t, ok)
+}
+
+func TestCache_Concurrency(t *testing.T) {
+	c := New(64 * 1024)
+	wg := new(sync.WaitGroup)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.Put(uint32(w), int64(i), []byte("114514"))
+				c.Get(uint32(w), int64(i/2))
+			}
+		}(w)
+	}
+	wg.Wait()
+	stat := c.Stat()
+	assert.Positive(t, stat.Entries)
+	assert.LessOrEqual(t, stat.Size, int64(64*1024))
+}
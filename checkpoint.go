@@ -0,0 +1,223 @@
+package baradb
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/saint-yellow/baradb/data"
+	"github.com/saint-yellow/baradb/index"
+)
+
+const checkpointKey = "checkpoint"
+
+// checkpointHeader describes what a checkpoint file covers
+type checkpointHeader struct {
+	position    *data.LogRecordPosition // Position in data files up to which the checkpoint covers
+	tranNo      uint64                  // Transaction serial number when the checkpoint was made
+	reclaimSize int64                   // Size of invalid data when the checkpoint was made
+	count       int64                   // Number of entries in the checkpoint
+}
+
+func encodeCheckpointHeader(h *checkpointHeader) []byte {
+	buffer := make([]byte, binary.MaxVarintLen32+binary.MaxVarintLen64*4)
+	index := 0
+	index += binary.PutVarint(buffer[index:], int64(h.position.FileID))
+	index += binary.PutVarint(buffer[index:], h.position.Offset)
+	index += binary.PutUvarint(buffer[index:], h.tranNo)
+	index += binary.PutVarint(buffer[index:], h.reclaimSize)
+	index += binary.PutVarint(buffer[index:], h.count)
+	return buffer[:index]
+}
+
+func decodeCheckpointHeader(buffer []byte) (*checkpointHeader, error) {
+	index := 0
+	corrupted := false
+	readVarint := func() int64 {
+		value, n := binary.Varint(buffer[index:])
+		if n <= 0 {
+			corrupted = true
+			return 0
+		}
+		index += n
+		return value
+	}
+
+	fileID := readVarint()
+	offset := readVarint()
+	tranNo, n := binary.Uvarint(buffer[index:])
+	if n <= 0 {
+		return nil, ErrCheckpointCorrupted
+	}
+	index += n
+	reclaimSize := readVarint()
+	count := readVarint()
+	if corrupted {
+		return nil, ErrCheckpointCorrupted
+	}
+
+	h := &checkpointHeader{
+		position: &data.LogRecordPosition{
+			FileID: uint32(fileID),
+			Offset: offset,
+		},
+		tranNo:      tranNo,
+		reclaimSize: reclaimSize,
+		count:       count,
+	}
+	return h, nil
+}
+
+// Checkpoint serializes the in-memory index to a checkpoint file,
+// so that the next launch loads the checkpoint and only replays data written after it.
+//
+// It does nothing if the DB engine uses a persistent index.
+func (db *DB) Checkpoint() error {
+	if index.IsPersistent(db.options.IndexType) {
+		return nil
+	}
+
+	db.checkpointLock.Lock()
+	defer db.checkpointLock.Unlock()
+
+	// Take a snapshot of the index and the position it covers, writers are blocked in the meantime
+	db.mu.RLock()
+	if db.activeFile == nil {
+		db.mu.RUnlock()
+		return nil
+	}
+	db.waitForPublishes()
+	header := &checkpointHeader{
+		position: &data.LogRecordPosition{
+			FileID: db.activeFile.FileID,
+			Offset: db.activeFile.WriteOffset,
+		},
+		tranNo:      db.tranNo,
+		reclaimSize: db.reclaimSize.Load(),
+		count:       int64(db.index.Size()),
+	}
+	iter, err := db.index.Iterator(false)
+	db.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	// Write a temporary file then replace the checkpoint file with it
+	tempFileName := data.CheckpointFileName + ".tmp"
+	tempFilePath := filepath.Join(db.options.Directory, tempFileName)
+	if err := os.RemoveAll(tempFilePath); err != nil {
+		return err
+	}
+	file, err := data.OpenIndexFile(db.options.Directory, tempFileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	file.SetCipher(db.cipher)
+
+	elr, _, err := file.EncodeLogRecord(&data.LogRecord{
+		Key:   []byte(checkpointKey),
+		Value: encodeCheckpointHeader(header),
+	})
+	if err != nil {
+		return err
+	}
+	if err := file.Write(elr); err != nil {
+		return err
+	}
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		if err := data.WriteHintRecord(file, iter.Key(), iter.Value()); err != nil {
+			return err
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFilePath, filepath.Join(db.options.Directory, data.CheckpointFileName))
+}
+
+// loadIndexFromCheckpoint loads the index from a checkpoint file
+//
+// It returns the position from which data files should be replayed, or nil if there is no checkpoint.
+func (db *DB) loadIndexFromCheckpoint() (*data.LogRecordPosition, error) {
+	filePath := filepath.Join(db.options.Directory, data.CheckpointFileName)
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	file, err := data.OpenIndexFile(db.options.Directory, data.CheckpointFileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	file.SetCipher(db.cipher)
+
+	lr, n, err := file.ReadLogRecord(0)
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrCheckpointCorrupted
+		}
+		return nil, err
+	}
+	if string(lr.Key) != checkpointKey {
+		return nil, ErrCheckpointCorrupted
+	}
+	header, err := decodeCheckpointHeader(lr.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	// The checkpoint must point into an existing data file
+	dataFile := db.getDataFile(header.position.FileID)
+	if dataFile == nil {
+		return nil, ErrCheckpointCorrupted
+	}
+	size, err := dataFile.Size()
+	if err != nil {
+		return nil, err
+	}
+	if header.position.Offset > size {
+		return nil, ErrCheckpointCorrupted
+	}
+
+	offset := n
+	for i := int64(0); i < header.count; i++ {
+		lr, n, err := file.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				return nil, ErrCheckpointCorrupted
+			}
+			return nil, err
+		}
+		if _, err := db.index.Put(lr.Key, data.DecodeLogRecordPosition(lr.Value)); err != nil {
+			return nil, err
+		}
+		offset += n
+	}
+
+	db.tranNo = header.tranNo
+	db.reclaimSize.Store(header.reclaimSize)
+	return header.position, nil
+}
+
+// checkpointPeriodically makes checkpoints at the configured interval until the DB engine is closed
+func (db *DB) checkpointPeriodically() {
+	defer db.backgroundTasks.Done()
+
+	ticker := time.NewTicker(db.options.CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.closed:
+			return
+		case <-ticker.C:
+			// A failed checkpoint only makes the next launch replay more data
+			_ = db.Checkpoint()
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+)
+
+// EncryptedLogRecordFlag is set in the type of a log record whose key and value are encrypted
+const EncryptedLogRecordFlag LogRecordType = 0x80
+
+// KeyProvider provides keys to encrypt log records at rest
+//
+// Keys are identified by IDs, which are stored along with encrypted log records,
+// so a key must stay available until no file contains log records encrypted with it.
+type KeyProvider interface {
+	// CurrentKey returns the ID and the key to encrypt new log records with
+	CurrentKey() (uint32, []byte, error)
+
+	// Key returns the key of a given ID to decrypt log records with
+	Key(id uint32) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider which holds keys in memory
+type StaticKeyProvider struct {
+	lock    *sync.RWMutex
+	keys    map[uint32][]byte
+	current uint32
+}
+
+// NewStaticKeyProvider constructs a StaticKeyProvider with a key as the current one
+func NewStaticKeyProvider(id uint32, key []byte) *StaticKeyProvider {
+	return &StaticKeyProvider{
+		lock:    new(sync.RWMutex),
+		keys:    map[uint32][]byte{id: key},
+		current: id,
+	}
+}
+
+// Rotate adds a key and makes it the current one, the previous keys are still available for decryption
+func (p *StaticKeyProvider) Rotate(id uint32, key []byte) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.keys[id] = key
+	p.current = id
+}
+
+// Remove removes a key which is no longer used by any file
+func (p *StaticKeyProvider) Remove(id uint32) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.keys, id)
+}
+
+// CurrentKey returns the ID and the key to encrypt new log records with
+func (p *StaticKeyProvider) CurrentKey() (uint32, []byte, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.current, p.keys[p.current], nil
+}
+
+// Key returns the key of a given ID
+func (p *StaticKeyProvider) Key(id uint32) ([]byte, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, ErrKeyNotProvided
+	}
+	return key, nil
+}
+
+// Cipher encrypts and decrypts log records with AES-GCM
+//
+// The key and the value of a log record are sealed together, so the value of an encrypted log record looks like:
+//
+//	| key ID (uvarint) | nonce | sealed (key size (uvarint) | key | value) |
+//
+// The type, the write timestamp and the column family of the log record stay in plain text with EncryptedLogRecordFlag set,
+// and they are authenticated as well, so that they can not be altered or swapped between log records.
+type Cipher struct {
+	provider KeyProvider
+	aeads    map[uint32]cipher.AEAD // AEADs cached by key IDs
+	lock     *sync.Mutex
+}
+
+// NewCipher constructs a Cipher which gets keys from a given provider
+func NewCipher(provider KeyProvider) *Cipher {
+	return &Cipher{
+		provider: provider,
+		aeads:    make(map[uint32]cipher.AEAD),
+		lock:     new(sync.Mutex),
+	}
+}
+
+// aead returns the AEAD of a key, the key is fetched from the provider if it is not cached
+func (c *Cipher) aead(id uint32, key []byte) (cipher.AEAD, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if aead, ok := c.aeads[id]; ok {
+		return aead, nil
+	}
+
+	if key == nil {
+		var err error
+		key, err = c.provider.Key(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	c.aeads[id] = aead
+	return aead, nil
+}
+
+// Encrypt returns an encrypted copy of a log record with the current key
+func (c *Cipher) Encrypt(lr *LogRecord) (*LogRecord, error) {
+	id, key, err := c.provider.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := c.aead(id, key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, binary.MaxVarintLen32+len(lr.Key)+len(lr.Value))
+	n := binary.PutUvarint(plaintext, uint64(len(lr.Key)))
+	n += copy(plaintext[n:], lr.Key)
+	n += copy(plaintext[n:], lr.Value)
+
+	value := make([]byte, binary.MaxVarintLen32+aead.NonceSize(), binary.MaxVarintLen32+aead.NonceSize()+n+aead.Overhead())
+	index := binary.PutUvarint(value, uint64(id))
+	nonce := value[index : index+aead.NonceSize()]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	index += aead.NonceSize()
+
+	lrType := lr.Type | EncryptedLogRecordFlag
+	encrypted := &LogRecord{
+		Value:      aead.Seal(value[:index], nonce, plaintext[:n], associatedData(lrType, lr)),
+		Type:       lrType,
+		Timestamp:  lr.Timestamp,
+		Family:     lr.Family,
+		Compressed: lr.Compressed,
+	}
+	return encrypted, nil
+}
+
+// associatedData encodes fields of a log record which stay in plain text but are authenticated with the sealed key and value
+func associatedData(lrType LogRecordType, lr *LogRecord) []byte {
+	buffer := make([]byte, 2+binary.MaxVarintLen64+binary.MaxVarintLen32)
+	buffer[0] = lrType
+	if lr.Compressed {
+		buffer[1] = 1
+	}
+	index := 2
+	index += binary.PutVarint(buffer[index:], lr.Timestamp)
+	index += binary.PutUvarint(buffer[index:], uint64(lr.Family))
+	return buffer[:index]
+}
+
+// Decrypt returns a decrypted copy of an encrypted log record
+func (c *Cipher) Decrypt(lr *LogRecord) (*LogRecord, error) {
+	id, n := binary.Uvarint(lr.Value)
+	if n <= 0 {
+		return nil, ErrDecryptionFailed
+	}
+	aead, err := c.aead(uint32(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(lr.Value) < n+aead.NonceSize() {
+		return nil, ErrDecryptionFailed
+	}
+
+	nonce := lr.Value[n : n+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, lr.Value[n+aead.NonceSize():], associatedData(lr.Type, lr))
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	keySize, n := binary.Uvarint(plaintext)
+	if n <= 0 || uint64(len(plaintext)-n) < keySize {
+		return nil, ErrDecryptionFailed
+	}
+	decrypted := &LogRecord{
+		Key:        plaintext[n : n+int(keySize)],
+		Value:      plaintext[n+int(keySize):],
+		Type:       lr.Type &^ EncryptedLogRecordFlag,
+		Timestamp:  lr.Timestamp,
+		Family:     lr.Family,
+		Compressed: lr.Compressed,
+	}
+	return decrypted, nil
+}
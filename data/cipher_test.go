@@ -0,0 +1,93 @@
+package data
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/saint-yellow/baradb/io_handler"
+)
+
+var testingKey1 = bytes.Repeat([]byte{1}, 32)
+var testingKey2 = bytes.Repeat([]byte{2}, 32)
+
+func TestCipher_EncryptAndDecrypt(t *testing.T) {
+	provider := NewStaticKeyProvider(1, testingKey1)
+	c := NewCipher(provider)
+
+	lr := &LogRecord{Key: []byte("114"), Value: []byte("514"), Type: DeletedLogRecord, Timestamp: 1919810, Family: 114, Compressed: true}
+	elr, err := c.Encrypt(lr)
+	assert.Nil(t, err)
+	assert.Nil(t, elr.Key)
+	assert.Equal(t, DeletedLogRecord|EncryptedLogRecordFlag, elr.Type)
+	assert.False(t, bytes.Contains(elr.Value, []byte("514")))
+
+	dlr, err := c.Decrypt(elr)
+	assert.Nil(t, err)
+	assert.Equal(t, lr, dlr)
+
+	// A log record encrypted with an old key is still decryptable after rotation
+	provider.Rotate(2, testingKey2)
+	elr2, err := c.Encrypt(lr)
+	assert.Nil(t, err)
+	dlr, err = c.Decrypt(elr)
+	assert.Nil(t, err)
+	assert.Equal(t, lr, dlr)
+
+	// The old key is removed
+	provider.Remove(1)
+	_, err = NewCipher(provider).Decrypt(elr)
+	assert.Equal(t, ErrKeyNotProvided, err)
+	dlr, err = NewCipher(provider).Decrypt(elr2)
+	assert.Nil(t, err)
+	assert.Equal(t, lr, dlr)
+
+	// The type, the write timestamp and the column family of the log record are authenticated
+	for _, alter := range []func(*LogRecord){
+		func(lr *LogRecord) { lr.Type = NormalLogRecord | EncryptedLogRecordFlag },
+		func(lr *LogRecord) { lr.Timestamp++ },
+		func(lr *LogRecord) { lr.Family = 0 },
+		func(lr *LogRecord) { lr.Compressed = false },
+	} {
+		altered := *elr2
+		alter(&altered)
+		_, err = c.Decrypt(&altered)
+		assert.Equal(t, ErrDecryptionFailed, err)
+	}
+	_, err = c.Decrypt(elr2)
+	assert.Nil(t, err)
+}
+
+func TestDataFile_Encryption(t *testing.T) {
+	directory := filepath.Join(tempDir, "baradb-cipher")
+	_ = os.MkdirAll(directory, os.ModePerm)
+	defer os.RemoveAll(directory)
+
+	file, err := OpenDataFile(directory, 114, io_handler.FileIOHandler)
+	assert.Nil(t, err)
+	file.SetCipher(NewCipher(NewStaticKeyProvider(1, testingKey1)))
+
+	lr := &LogRecord{Key: []byte("114"), Value: []byte("winter flower"), Type: NormalLogRecord}
+	elr, n, err := file.EncodeLogRecord(lr)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Write(elr))
+	assert.Nil(t, file.Sync())
+
+	readLR, readSize, err := file.ReadLogRecord(0)
+	assert.Nil(t, err)
+	assert.Equal(t, n, readSize)
+	assert.Equal(t, lr, readLR)
+
+	content, err := os.ReadFile(file.Path())
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(content, []byte("winter flower")))
+
+	// An encrypted log record can not be read without a cipher
+	file.SetCipher(nil)
+	_, _, err = file.ReadLogRecord(0)
+	assert.Equal(t, ErrNoCipher, err)
+	assert.Nil(t, file.Close())
+}
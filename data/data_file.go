@@ -5,24 +5,42 @@ import (
 	"hash/crc32"
 	"io"
 	"path/filepath"
+	"sort"
+	"sync"
 
 	"github.com/saint-yellow/baradb/io_handler"
 )
 
 const (
 	// A fixed name suffix of every single data file in the DB engine
-	DataFileNameSuffix = ".data"
-	HintFileName       = "hint-index"
-	MergedFileName     = "merged"
-	TranNoFileName     = "tran-no"
+	DataFileNameSuffix  = ".data"
+	HintFileName        = "hint-index"
+	MergedFileName      = "merged"
+	TranNoFileName      = "tran-no"
+	CheckpointFileName  = "index-checkpoint"
+	BloomFilterFileName = "bloom-filter"
+	FamiliesFileName    = "column-families"
 )
 
+// maxPooledBufferSize Maximum size of a buffer which is returned to the pool of read buffers (unit: B)
+const maxPooledBufferSize = 64 * 1024
+
+// readBufferPool pools buffers which whole log records are read into
+var readBufferPool = sync.Pool{
+	New: func() any {
+		buffer := make([]byte, 0, 4096)
+		return &buffer
+	},
+}
+
 // DataFile represents a data file in a DB engine instance
 type DataFile struct {
 	path        string               // path of a data file
 	FileID      uint32               // FileID identifies of a data file
 	WriteOffset int64                // WriteOffset indicates the offset of the written data in a data file
 	ioHandler   io_handler.IOHandler // ioHandler is used to handle I/O operations in a data file
+	cipher      *Cipher              // cipher encrypts log records written to a data file, it is nil if encryption is disabled
+	syncTracer  func() func(error)   // syncTracer is called when a data file starts to be synced and returns a function called when it ends
 }
 
 // newDataFile constructs a data file
@@ -78,6 +96,12 @@ func OpenTranNoFile(directory string) (*DataFile, error) {
 	return newDataFile(filePath, 0, io_handler.FileIOHandler)
 }
 
+// OpenIndexFile opens a file with a given name that an index persists itself to
+func OpenIndexFile(directory, fileName string) (*DataFile, error) {
+	filePath := filepath.Join(directory, fileName)
+	return newDataFile(filePath, 0, io_handler.FileIOHandler)
+}
+
 // ReadLogRecord reads single log record by given offset in a data file
 func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	// Get the size of the data file
@@ -112,7 +136,10 @@ func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 
 	// Construct a log record
 	logRecord := &LogRecord{
-		Type: header.logRecordType,
+		Type:       header.logRecordType,
+		Timestamp:  header.timestamp,
+		Family:     header.family,
+		Compressed: header.compressed,
 	}
 
 	if keySize > 0 || valueSize > 0 {
@@ -131,11 +158,319 @@ func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 		return nil, 0, ErrInvalidCRC
 	}
 
+	logRecord, err = df.decrypt(logRecord)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	return logRecord, logRecordSize, nil
 }
 
+// ReadLogRecordAt reads the log record at a given position in a single read
+//
+// Unlike ReadLogRecord, it neither reads the header separately nor gets the size of the data file,
+// since the position carries the size of the whole log record.
+// If the position does not carry the size, then it falls back to ReadLogRecord.
+func (df *DataFile) ReadLogRecordAt(lrp *LogRecordPosition) (*LogRecord, error) {
+	if lrp.Size == 0 {
+		lr, _, err := df.ReadLogRecord(lrp.Offset)
+		return lr, err
+	}
+
+	bp := getReadBuffer(int(lrp.Size))
+	defer putReadBuffer(bp)
+	buffer := *bp
+
+	if _, err := df.ioHandler.Read(buffer, lrp.Offset); err != nil {
+		return nil, err
+	}
+	lr, err := decodeLogRecord(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	// The buffer is reused, so the returned log record must not refer to it.
+	// Decryption already produces a log record in a new buffer.
+	if lr.Type&EncryptedLogRecordFlag != 0 {
+		return df.decrypt(lr)
+	}
+	keySize := len(lr.Key)
+	kv := make([]byte, keySize+len(lr.Value))
+	copy(kv, lr.Key)
+	copy(kv[keySize:], lr.Value)
+	lr.Key = kv[:keySize:keySize]
+	lr.Value = kv[keySize:]
+	return lr, nil
+}
+
+// ViewLogRecord calls a function with the log record at a given position without copying its key and value if possible
+//
+// If the I/O handler of the data file keeps data in memory, such as writable memory mapping,
+// then the key and the value refer to the memory of the I/O handler, otherwise they refer to a pooled buffer.
+// Either way they are only valid during the call, and they must not be modified.
+func (df *DataFile) ViewLogRecord(lrp *LogRecordPosition, fn func(lr *LogRecord) error) error {
+	if lrp.Size == 0 {
+		lr, _, err := df.ReadLogRecord(lrp.Offset)
+		if err != nil {
+			return err
+		}
+		return fn(lr)
+	}
+
+	var buffer []byte
+	if viewer, ok := df.ioHandler.(io_handler.Viewer); ok {
+		b, err := viewer.View(lrp.Offset, int(lrp.Size))
+		if err != nil {
+			return err
+		}
+		buffer = b
+	} else {
+		bp := getReadBuffer(int(lrp.Size))
+		defer putReadBuffer(bp)
+		buffer = *bp
+		if _, err := df.ioHandler.Read(buffer, lrp.Offset); err != nil {
+			return err
+		}
+	}
+
+	lr, err := decodeLogRecord(buffer)
+	if err != nil {
+		return err
+	}
+	lr, err = df.decrypt(lr)
+	if err != nil {
+		return err
+	}
+	return fn(lr)
+}
+
+// getReadBuffer gets a buffer of a given size from the pool of read buffers
+func getReadBuffer(size int) *[]byte {
+	bp := readBufferPool.Get().(*[]byte)
+	if cap(*bp) < size {
+		*bp = make([]byte, size)
+	}
+	*bp = (*bp)[:size]
+	return bp
+}
+
+// putReadBuffer returns a buffer to the pool of read buffers unless it is too large to be kept
+func putReadBuffer(bp *[]byte) {
+	if cap(*bp) <= maxPooledBufferSize {
+		readBufferPool.Put(bp)
+	}
+}
+
+// ReadLogRecords reads log records at given positions in a data file in a batch
+//
+// Positions are sorted by offsets, and adjacent log records are coalesced into a single read,
+// then the I/O handler of the data file may issue the reads concurrently.
+// Positions should carry sizes of log records, otherwise the log records are read one by one.
+//
+// Log records and errors are returned in the order of the positions.
+func (df *DataFile) ReadLogRecords(positions []*LogRecordPosition) ([]*LogRecord, []error) {
+	logRecords := make([]*LogRecord, len(positions))
+	errs := make([]error, len(positions))
+
+	order := make([]int, len(positions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return positions[order[i]].Offset < positions[order[j]].Offset
+	})
+
+	// A span of the data file which covers adjacent log records
+	type span struct {
+		offset  int64
+		end     int64
+		members []int // Indexes of positions in the span
+	}
+	var spans []*span
+	for _, i := range order {
+		lrp := positions[i]
+		if lrp.Size == 0 {
+			logRecords[i], _, errs[i] = df.ReadLogRecord(lrp.Offset)
+			continue
+		}
+
+		end := lrp.Offset + int64(lrp.Size)
+		if len(spans) > 0 && lrp.Offset <= spans[len(spans)-1].end {
+			last := spans[len(spans)-1]
+			if end > last.end {
+				last.end = end
+			}
+			last.members = append(last.members, i)
+			continue
+		}
+		spans = append(spans, &span{offset: lrp.Offset, end: end, members: []int{i}})
+	}
+
+	requests := make([]*io_handler.ReadRequest, len(spans))
+	for i, s := range spans {
+		requests[i] = &io_handler.ReadRequest{
+			Buffer: make([]byte, s.end-s.offset),
+			Offset: s.offset,
+		}
+	}
+	io_handler.ReadBatch(df.ioHandler, requests)
+
+	for i, s := range spans {
+		r := requests[i]
+		for _, m := range s.members {
+			if r.Err != nil {
+				errs[m] = r.Err
+				continue
+			}
+			start := positions[m].Offset - s.offset
+			lr, err := decodeLogRecord(r.Buffer[start : start+int64(positions[m].Size)])
+			if err != nil {
+				errs[m] = err
+				continue
+			}
+			logRecords[m], errs[m] = df.decrypt(lr)
+		}
+	}
+	return logRecords, errs
+}
+
+// ReadLogRecordsFrom reads log records from a given offset onwards in a single read of up to a given number of bytes
+//
+// It scans a data file in sequence with fewer reads than ReadLogRecord, for example for the mergence.
+// Log records which lie wholly in the read bytes are returned with their sizes,
+// so the next log record starts at the offset plus the sum of the sizes.
+// A log record which is larger than the read bytes is read alone.
+// It returns io.EOF once there is no log record from the offset.
+func (df *DataFile) ReadLogRecordsFrom(offset, n int64) ([]*LogRecord, []int64, error) {
+	fileSize, err := df.ioHandler.Size()
+	if err != nil {
+		return nil, nil, err
+	}
+	if offset >= fileSize {
+		return nil, nil, io.EOF
+	}
+	end := offset + n
+	if end > fileSize {
+		end = fileSize
+	}
+
+	buffer, err := df.readNBytes(end-offset, offset)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	var logRecords []*LogRecord
+	var sizes []int64
+	var index int64 = 0
+	for index < int64(len(buffer)) {
+		// A header which may be cut by the end of the read bytes is left to the next read
+		rest := buffer[index:]
+		if int64(len(rest)) < maxLogRecordHeaderSize && end < fileSize {
+			break
+		}
+		header, headerSize := decodeLogRecordHeader(rest)
+		if header == nil || (header.crc == 0 && header.keySize == 0 && header.valueSize == 0) {
+			if len(logRecords) == 0 {
+				return nil, nil, io.EOF
+			}
+			break
+		}
+		size := headerSize + int64(header.keySize) + int64(header.valueSize)
+		if size > int64(len(rest)) {
+			break
+		}
+
+		lr, err := decodeLogRecord(rest[:size])
+		if err != nil {
+			return nil, nil, err
+		}
+		lr, err = df.decrypt(lr)
+		if err != nil {
+			return nil, nil, err
+		}
+		logRecords = append(logRecords, lr)
+		sizes = append(sizes, size)
+		index += size
+	}
+
+	if len(logRecords) == 0 {
+		lr, size, err := df.ReadLogRecord(offset)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*LogRecord{lr}, []int64{size}, nil
+	}
+	return logRecords, sizes, nil
+}
+
+// decodeLogRecord decodes a log record from a buffer which holds exactly the whole log record
+func decodeLogRecord(buffer []byte) (*LogRecord, error) {
+	header, headerSize := decodeLogRecordHeader(buffer)
+	if header == nil {
+		return nil, io.EOF
+	}
+	keySize, valueSize := int64(header.keySize), int64(header.valueSize)
+	if headerSize+keySize+valueSize != int64(len(buffer)) {
+		return nil, ErrInvalidCRC
+	}
+
+	logRecord := &LogRecord{
+		Key:        buffer[headerSize : headerSize+keySize],
+		Value:      buffer[headerSize+keySize:],
+		Type:       header.logRecordType,
+		Timestamp:  header.timestamp,
+		Family:     header.family,
+		Compressed: header.compressed,
+	}
+	if logRecord.crc(buffer[crc32.Size:headerSize]) != header.crc {
+		return nil, ErrInvalidCRC
+	}
+	return logRecord, nil
+}
+
+// decrypt decrypts a log record if it was encrypted
+func (df *DataFile) decrypt(lr *LogRecord) (*LogRecord, error) {
+	if lr.Type&EncryptedLogRecordFlag == 0 {
+		return lr, nil
+	}
+	if df.cipher == nil {
+		return nil, ErrNoCipher
+	}
+	return df.cipher.Decrypt(lr)
+}
+
+// EncodeLogRecord encodes a log record to be written to a data file, it is encrypted if the data file has a cipher
+func (df *DataFile) EncodeLogRecord(lr *LogRecord) ([]byte, int64, error) {
+	if df.cipher != nil {
+		var err error
+		lr, err = df.cipher.Encrypt(lr)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	elr, n := EncodeLogRecord(lr)
+	return elr, n, nil
+}
+
+// SetCipher sets a cipher to encrypt and decrypt log records in a data file
+func (df *DataFile) SetCipher(cipher *Cipher) {
+	df.cipher = cipher
+}
+
+// SetSyncTracer sets a function which is called whenever a data file starts to be synced,
+// and the function it returns is called with the error once the sync ends
+func (df *DataFile) SetSyncTracer(tracer func() func(error)) {
+	df.syncTracer = tracer
+}
+
 func (df *DataFile) Sync() error {
-	return df.ioHandler.Sync()
+	if df.syncTracer == nil {
+		return df.ioHandler.Sync()
+	}
+	end := df.syncTracer()
+	err := df.ioHandler.Sync()
+	end(err)
+	return err
 }
 
 func (df *DataFile) Write(data []byte) error {
@@ -147,6 +482,24 @@ func (df *DataFile) Write(data []byte) error {
 	return nil
 }
 
+// Truncate discards data after the given size of a data file, the next write starts at that size
+func (df *DataFile) Truncate(size int64) error {
+	if err := df.ioHandler.Truncate(size); err != nil {
+		return err
+	}
+	df.WriteOffset = size
+	return nil
+}
+
+// Seal releases space which the I/O handler reserves beyond the data of the data file,
+// it is called once the data file becomes inactive
+func (df *DataFile) Seal() error {
+	if sealer, ok := df.ioHandler.(io_handler.Sealer); ok {
+		return sealer.Seal()
+	}
+	return nil
+}
+
 func (df *DataFile) Close() error {
 	return df.ioHandler.Close()
 }
@@ -168,7 +521,10 @@ func WriteHintRecord(hintFile *DataFile, key []byte, lrp *LogRecordPosition) err
 		Key:   key,
 		Value: EncodeLogRecordPosition(lrp),
 	}
-	elr, _ := EncodeLogRecord(lr)
+	elr, _, err := hintFile.EncodeLogRecord(lr)
+	if err != nil {
+		return err
+	}
 	return hintFile.Write(elr)
 }
 
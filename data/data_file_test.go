@@ -1,6 +1,8 @@
 package data
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"testing"
 
@@ -107,3 +109,239 @@ func TestDataFile_ReadLogRecord(t *testing.T) {
 	assert.Equal(t, ws3, size3)
 	assert.Equal(t, lr3, res3)
 }
+
+func TestDataFile_ReadLogRecords(t *testing.T) {
+	for _, ioHandlerType := range []io_handler.IOHandlerType{io_handler.FileIOHandler, io_handler.DirectIOHandler} {
+		file, _ := OpenDataFile(tempDir, 364, ioHandlerType)
+
+		var positions []*LogRecordPosition
+		var logRecords []*LogRecord
+		for i := 0; i < 100; i++ {
+			lr := &LogRecord{
+				Key:   []byte(fmt.Sprintf("%d", i)),
+				Value: []byte(fmt.Sprintf("value-%d", i)),
+				Type:  NormalLogRecord,
+			}
+			b, size := EncodeLogRecord(lr)
+			positions = append(positions, &LogRecordPosition{FileID: 364, Offset: file.WriteOffset, Size: uint32(size)})
+			logRecords = append(logRecords, lr)
+			file.Write(b)
+		}
+
+		// Read log records in a different order
+		for i := 0; i < 50; i++ {
+			positions[i], positions[99-i] = positions[99-i], positions[i]
+			logRecords[i], logRecords[99-i] = logRecords[99-i], logRecords[i]
+		}
+		// Some positions are duplicated, and some are not adjacent to others
+		positions = append(positions[:40], positions[45:]...)
+		logRecords = append(logRecords[:40], logRecords[45:]...)
+		positions = append(positions, positions[7])
+		logRecords = append(logRecords, logRecords[7])
+		res, errs := file.ReadLogRecords(positions)
+		for _, err := range errs {
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, logRecords, res)
+
+		// A position with a wrong size, and a position without size
+		res, errs = file.ReadLogRecords([]*LogRecordPosition{
+			{FileID: 364, Offset: 0, Size: 1},
+			{FileID: 364, Offset: 0},
+		})
+		assert.NotNil(t, errs[0])
+		assert.Nil(t, errs[1])
+		assert.Equal(t, "0", string(res[1].Key))
+
+		assert.Nil(t, file.Close())
+		assert.Nil(t, os.Remove(file.Path()))
+	}
+}
+
+func TestDataFile_ReadLogRecordsFrom(t *testing.T) {
+	file, _ := OpenDataFile(tempDir, 365, io_handler.FileIOHandler)
+
+	var logRecords []*LogRecord
+	for i := 0; i < 100; i++ {
+		lr := &LogRecord{
+			Key:   []byte(fmt.Sprintf("%d", i)),
+			Value: []byte(fmt.Sprintf("value-%d", i)),
+			Type:  NormalLogRecord,
+		}
+		// A log record is larger than a read
+		if i == 50 {
+			lr.Value = make([]byte, 1024)
+		}
+		b, _ := EncodeLogRecord(lr)
+		logRecords = append(logRecords, lr)
+		file.Write(b)
+	}
+
+	// Scan the data file with reads which cut log records
+	var res []*LogRecord
+	var offset int64 = 0
+	reads := 0
+	for {
+		lrs, sizes, err := file.ReadLogRecordsFrom(offset, 256)
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, len(lrs), len(sizes))
+		for _, size := range sizes {
+			offset += size
+		}
+		res = append(res, lrs...)
+		reads++
+	}
+	assert.Equal(t, logRecords, res)
+	assert.Equal(t, file.WriteOffset, offset)
+	assert.Less(t, reads, len(logRecords)/2)
+
+	assert.Nil(t, file.Close())
+	assert.Nil(t, os.Remove(file.Path()))
+}
+
+func TestDataFile_ReadLogRecordAt(t *testing.T) {
+	file, _ := OpenDataFile(tempDir, 365, io_handler.FileIOHandler)
+
+	var positions []*LogRecordPosition
+	var logRecords []*LogRecord
+	for i := 0; i < 10; i++ {
+		lr := &LogRecord{
+			Key:   []byte(fmt.Sprintf("%d", i)),
+			Value: make([]byte, i*16*1024),
+			Type:  NormalLogRecord,
+		}
+		if i%3 == 0 {
+			lr.Type = DeletedLogRecord
+		}
+		b, size := EncodeLogRecord(lr)
+		positions = append(positions, &LogRecordPosition{FileID: 365, Offset: file.WriteOffset, Size: uint32(size)})
+		logRecords = append(logRecords, lr)
+		file.Write(b)
+	}
+
+	// Small and large records are read in turn, so that buffers are reused
+	for round := 0; round < 2; round++ {
+		for i, lrp := range positions {
+			lr, err := file.ReadLogRecordAt(lrp)
+			assert.Nil(t, err)
+			assert.Equal(t, logRecords[i], lr)
+		}
+	}
+
+	// A read log record does not refer to a reused buffer
+	lr1, _ := file.ReadLogRecordAt(positions[1])
+	lr2, _ := file.ReadLogRecordAt(positions[2])
+	assert.Equal(t, "1", string(lr1.Key))
+	assert.Equal(t, "2", string(lr2.Key))
+
+	// A position without size falls back to reading the header first
+	lr, err := file.ReadLogRecordAt(&LogRecordPosition{FileID: 365, Offset: positions[4].Offset})
+	assert.Nil(t, err)
+	assert.Equal(t, logRecords[4], lr)
+
+	// A position with a wrong size
+	_, err = file.ReadLogRecordAt(&LogRecordPosition{FileID: 365, Offset: 0, Size: 1})
+	assert.NotNil(t, err)
+
+	assert.Nil(t, file.Close())
+	assert.Nil(t, os.Remove(file.Path()))
+}
+
+func TestDataFile_ViewLogRecord(t *testing.T) {
+	for _, ioHandlerType := range []io_handler.IOHandlerType{io_handler.FileIOHandler, io_handler.InMemoryIOHandler} {
+		file, _ := OpenDataFile(tempDir, 366, ioHandlerType)
+
+		var positions []*LogRecordPosition
+		var logRecords []*LogRecord
+		for i := 0; i < 10; i++ {
+			lr := &LogRecord{
+				Key:   []byte(fmt.Sprintf("%d", i)),
+				Value: []byte(fmt.Sprintf("value-%d", i)),
+				Type:  NormalLogRecord,
+			}
+			b, size := EncodeLogRecord(lr)
+			positions = append(positions, &LogRecordPosition{FileID: 366, Offset: file.WriteOffset, Size: uint32(size)})
+			logRecords = append(logRecords, lr)
+			file.Write(b)
+		}
+
+		for i, lrp := range positions {
+			err := file.ViewLogRecord(lrp, func(lr *LogRecord) error {
+				assert.Equal(t, logRecords[i], lr)
+				return nil
+			})
+			assert.Nil(t, err)
+		}
+
+		// An error of the function is returned
+		err := file.ViewLogRecord(positions[0], func(lr *LogRecord) error {
+			return io.ErrUnexpectedEOF
+		})
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+		// A position with a wrong size, and a position without size
+		err = file.ViewLogRecord(&LogRecordPosition{FileID: 366, Offset: 0, Size: 1}, func(lr *LogRecord) error {
+			return nil
+		})
+		assert.NotNil(t, err)
+		err = file.ViewLogRecord(&LogRecordPosition{FileID: 366, Offset: positions[3].Offset}, func(lr *LogRecord) error {
+			assert.Equal(t, logRecords[3], lr)
+			return nil
+		})
+		assert.Nil(t, err)
+
+		assert.Nil(t, file.Close())
+		os.Remove(file.Path())
+	}
+}
+
+// prepareBenchmarkFile writes log records with values of a given size to a data file
+func prepareBenchmarkFile(b *testing.B, valueSize int) (*DataFile, []*LogRecordPosition) {
+	file, err := OpenDataFile(b.TempDir(), 0, io_handler.FileIOHandler)
+	assert.Nil(b, err)
+
+	var positions []*LogRecordPosition
+	for i := 0; i < 1000; i++ {
+		lr := &LogRecord{
+			Key:   []byte(fmt.Sprintf("key-%09d", i)),
+			Value: make([]byte, valueSize),
+			Type:  NormalLogRecord,
+		}
+		elr, size := EncodeLogRecord(lr)
+		positions = append(positions, &LogRecordPosition{Offset: file.WriteOffset, Size: uint32(size)})
+		assert.Nil(b, file.Write(elr))
+	}
+	b.Cleanup(func() {
+		file.Close()
+	})
+	return file, positions
+}
+
+func Benchmark_ReadLogRecord(b *testing.B) {
+	file, positions := prepareBenchmarkFile(b, 1024)
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_, _, err := file.ReadLogRecord(positions[i%len(positions)].Offset)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_ReadLogRecordAt(b *testing.B) {
+	file, positions := prepareBenchmarkFile(b, 1024)
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_, err := file.ReadLogRecordAt(positions[i%len(positions)])
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -2,4 +2,11 @@ package data
 
 import "errors"
 
-var ErrInvalidCRC = errors.New("invalid CRC value. Maybe the log record was corrupted")
+var (
+	ErrInvalidCRC            = errors.New("invalid CRC value. Maybe the log record was corrupted")
+	ErrNoCipher              = errors.New("the log record is encrypted but no cipher is configured")
+	ErrKeyNotProvided        = errors.New("the key to decrypt the log record is not provided")
+	ErrDecryptionFailed      = errors.New("failed to decrypt the log record")
+	ErrStreamingNotSupported = errors.New("the I/O handler or encryption of the data file does not support streaming")
+	ErrLogRecordTooLarge     = errors.New("the log record is too large")
+)
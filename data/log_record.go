@@ -18,6 +18,14 @@ type LogRecordPosition struct {
 	Size uint32
 }
 
+// Before reports whether the log record is appended before the log record at another position
+func (lrp *LogRecordPosition) Before(other *LogRecordPosition) bool {
+	if lrp.FileID != other.FileID {
+		return lrp.FileID < other.FileID
+	}
+	return lrp.Offset < other.Offset
+}
+
 // LogRecordType types of log records
 type LogRecordType = byte
 
@@ -25,16 +33,32 @@ const (
 	NormalLogRecord              LogRecordType = iota + 1 // NormalLogRecord indicates that a log record is normal to read, update or delete
 	DeletedLogRecord                                      // DeletedLogRecord indicates that a log record is deleted and unusable
 	TransactionFinishedLogRecord                          // TransactionFinishedLogRecord indicates that a Transaction is finished
+	MergeOperandLogRecord                                 // MergeOperandLogRecord indicates that a log record is an operand to be merged into the value of its key
+	RangeTombstoneLogRecord                               // RangeTombstoneLogRecord indicates that keys from the key of a log record to its value are deleted
+)
+
+const (
+	// TimestampedLogRecordFlag is set in the type of a log record whose header carries a write timestamp
+	TimestampedLogRecordFlag LogRecordType = 0x40
+
+	// FamilyLogRecordFlag is set in the type of a log record whose header carries the ID of a column family
+	FamilyLogRecordFlag LogRecordType = 0x20
+
+	// CompressedLogRecordFlag is set in the type of a log record whose value is compressed
+	CompressedLogRecordFlag LogRecordType = 0x10
 )
 
 // maxLogRecordHeaderSize Maximum size of a header of a log record
-const maxLogRecordHeaderSize = binary.MaxVarintLen32*2 + 5
+const maxLogRecordHeaderSize = binary.MaxVarintLen32*3 + binary.MaxVarintLen64 + 5
 
 // LogRecord represents a log record in a data file
 type LogRecord struct {
-	Key   []byte        // Key
-	Value []byte        // Value
-	Type  LogRecordType // Type indicates whether a log record is unusable (deleted) or not
+	Key        []byte        // Key
+	Value      []byte        // Value
+	Type       LogRecordType // Type indicates whether a log record is unusable (deleted) or not
+	Timestamp  int64         // Timestamp indicates when a log record was written (unit: ns), it is 0 if unknown
+	Family     uint32        // Family is the ID of the column family of a log record, it is 0 for the default one
+	Compressed bool          // Compressed indicates whether the value of a log record is compressed
 }
 
 // logRecordHeader A header information of a log record
@@ -43,6 +67,38 @@ type logRecordHeader struct {
 	keySize       uint32        // Size of the key of the corresponding log record
 	valueSize     uint32        // Size of the value of the corresponding log record
 	logRecordType LogRecordType // Type of the corresponding log record (normal/deleted/...)
+	timestamp     int64         // Write timestamp of the corresponding log record, it is 0 if the header carries none
+	family        uint32        // ID of the column family of the corresponding log record, it is 0 if the header carries none
+	compressed    bool          // Whether the value of the corresponding log record is compressed
+}
+
+// putLogRecordHeader stores a header of a log record except its CRC value to a buffer and returns the size of the header
+//
+// The write timestamp and the column family are stored after the sizes if they are not 0,
+// and their flags are set in the type.
+func putLogRecordHeader(header []byte, lr *LogRecord, keySize, valueSize int64) int {
+	lrType := lr.Type
+	if lr.Timestamp != 0 {
+		lrType |= TimestampedLogRecordFlag
+	}
+	if lr.Family != 0 {
+		lrType |= FamilyLogRecordFlag
+	}
+	if lr.Compressed {
+		lrType |= CompressedLogRecordFlag
+	}
+	header[4] = lrType
+
+	index := 5
+	index += binary.PutVarint(header[index:], keySize)
+	index += binary.PutVarint(header[index:], valueSize)
+	if lr.Timestamp != 0 {
+		index += binary.PutVarint(header[index:], lr.Timestamp)
+	}
+	if lr.Family != 0 {
+		index += binary.PutUvarint(header[index:], uint64(lr.Family))
+	}
+	return index
 }
 
 // EncodeLogRecord encodes a log record
@@ -50,13 +106,8 @@ func EncodeLogRecord(lr *LogRecord) ([]byte, int64) {
 	// Initialize a byte array of the header
 	header := make([]byte, maxLogRecordHeaderSize)
 
-	// Store the type of the log record to the header
-	header[4] = lr.Type
-
-	index := 5
-	// Store the size of the key and the value of the log record to the header
-	index += binary.PutVarint(header[index:], int64(len(lr.Key)))
-	index += binary.PutVarint(header[index:], int64(len(lr.Value)))
+	// Store the type, the size of the key and the value and the timestamp of the log record to the header
+	index := putLogRecordHeader(header, lr, int64(len(lr.Key)), int64(len(lr.Value)))
 
 	// Total size of the header and the log reocrd
 	size := index + len(lr.Key) + len(lr.Value)
@@ -79,13 +130,8 @@ func encodeLogRecordHeader(lr *LogRecord) ([]byte, int64) {
 	// Initialize a byte array of the header
 	header := make([]byte, maxLogRecordHeaderSize)
 
-	// Store the type of the log record to the header
-	header[4] = lr.Type
-
-	index := 5
-	// Store the size of the key and the value of the log record to the header
-	index += binary.PutVarint(header[index:], int64(len(lr.Key)))
-	index += binary.PutVarint(header[index:], int64(len(lr.Value)))
+	// Store the type, the size of the key and the value and the timestamp of the log record to the header
+	index := putLogRecordHeader(header, lr, int64(len(lr.Key)), int64(len(lr.Value)))
 
 	// Total size of the header and the log reocrd
 	size := index + len(lr.Key) + len(lr.Value)
@@ -126,6 +172,27 @@ func decodeLogRecordHeader(buffer []byte) (*logRecordHeader, int64) {
 	header.valueSize = uint32(valueSize)
 	index += n
 
+	// Get the write timestamp of the log record if any
+	if header.logRecordType&TimestampedLogRecordFlag != 0 {
+		header.logRecordType &^= TimestampedLogRecordFlag
+		timestamp, n := binary.Varint(buffer[index:])
+		header.timestamp = timestamp
+		index += n
+	}
+
+	// Get the column family of the log record if any
+	if header.logRecordType&FamilyLogRecordFlag != 0 {
+		header.logRecordType &^= FamilyLogRecordFlag
+		family, n := binary.Uvarint(buffer[index:])
+		header.family = uint32(family)
+		index += n
+	}
+
+	if header.logRecordType&CompressedLogRecordFlag != 0 {
+		header.logRecordType &^= CompressedLogRecordFlag
+		header.compressed = true
+	}
+
 	return header, int64(index)
 }
 
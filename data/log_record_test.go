@@ -64,6 +64,61 @@ func TestLogRecordCRC(t *testing.T) {
 	}
 }
 
+func TestLogRecordTimestamp(t *testing.T) {
+	lr := &LogRecord{
+		Key:       []byte("114"),
+		Value:     []byte("514"),
+		Type:      DeletedLogRecord,
+		Timestamp: 1145141919810,
+	}
+	b, n := EncodeLogRecord(lr)
+	assert.Equal(t, DeletedLogRecord|TimestampedLogRecordFlag, b[4])
+
+	// The timestamp is stored in the header and the flag is cleared from the decoded type
+	h, headerSize := decodeLogRecordHeader(b)
+	assert.Equal(t, DeletedLogRecord, h.logRecordType)
+	assert.Equal(t, lr.Timestamp, h.timestamp)
+	assert.Equal(t, n, headerSize+int64(len(lr.Key)+len(lr.Value)))
+	decoded, err := decodeLogRecord(b)
+	assert.Nil(t, err)
+	assert.Equal(t, lr, decoded)
+
+	// A log record without timestamp is encoded as before
+	lr.Timestamp = 0
+	b2, n2 := EncodeLogRecord(lr)
+	assert.Equal(t, DeletedLogRecord, b2[4])
+	assert.Less(t, n2, n)
+}
+
+func TestLogRecordFamily(t *testing.T) {
+	lr := &LogRecord{
+		Key:        []byte("114"),
+		Value:      []byte("514"),
+		Type:       NormalLogRecord,
+		Timestamp:  1145141919810,
+		Family:     1919,
+		Compressed: true,
+	}
+	b, n := EncodeLogRecord(lr)
+	assert.Equal(t, NormalLogRecord|TimestampedLogRecordFlag|FamilyLogRecordFlag|CompressedLogRecordFlag, b[4])
+
+	// The column family is stored in the header and flags are cleared from the decoded type
+	h, headerSize := decodeLogRecordHeader(b)
+	assert.Equal(t, NormalLogRecord, h.logRecordType)
+	assert.Equal(t, lr.Family, h.family)
+	assert.True(t, h.compressed)
+	assert.Equal(t, n, headerSize+int64(len(lr.Key)+len(lr.Value)))
+	decoded, err := decodeLogRecord(b)
+	assert.Nil(t, err)
+	assert.Equal(t, lr, decoded)
+
+	// A log record of the default column family is encoded as before
+	lr.Family, lr.Compressed = 0, false
+	b2, n2 := EncodeLogRecord(lr)
+	assert.Equal(t, NormalLogRecord|TimestampedLogRecordFlag, b2[4])
+	assert.Less(t, n2, n)
+}
+
 func TestEncodingKeyWithTranNo(t *testing.T) {
 	originalKey := utils.NewKey(8)
 	var tranNo uint64 = 114514
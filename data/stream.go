@@ -0,0 +1,192 @@
+package data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/saint-yellow/baradb/io_handler"
+)
+
+// streamChunkSize Size of chunks in which values are streamed (unit: B)
+const streamChunkSize = 64 * 1024
+
+// WriteLogRecordFrom writes a log record whose value of a given size is streamed from a reader,
+// and returns the size of the written log record
+//
+// The value of the given log record is ignored, the key, the type and the timestamp of it are written.
+//
+// The value is written in chunks and the CRC is computed incrementally, so the value is never held in memory as a whole.
+// Since the CRC is stored in the header, a zeroed header is written first and filled in once the value is synced,
+// so a log record torn by a crash is read as the end of the data file.
+//
+// It requires an I/O handler which implements io_handler.Patcher, and it does not support encryption.
+func (df *DataFile) WriteLogRecordFrom(lr *LogRecord, r io.Reader, size int64) (int64, error) {
+	patcher, ok := df.ioHandler.(io_handler.Patcher)
+	if !ok || df.cipher != nil {
+		return 0, ErrStreamingNotSupported
+	}
+
+	key := lr.Key
+	header := make([]byte, maxLogRecordHeaderSize)
+	headerSize := putLogRecordHeader(header, lr, int64(len(key)), size)
+	header = header[:headerSize]
+
+	logRecordSize := int64(headerSize) + int64(len(key)) + size
+	if size < 0 || logRecordSize > math.MaxUint32 {
+		return 0, ErrLogRecordTooLarge
+	}
+
+	offset := df.WriteOffset
+	err := func() error {
+		if err := df.Write(make([]byte, headerSize)); err != nil {
+			return err
+		}
+
+		crc := crc32.ChecksumIEEE(header[crc32.Size:])
+		crc = crc32.Update(crc, crc32.IEEETable, key)
+		if err := df.Write(key); err != nil {
+			return err
+		}
+
+		buffer := make([]byte, streamChunkSize)
+		for remaining := size; remaining > 0; {
+			chunk := buffer
+			if remaining < int64(len(chunk)) {
+				chunk = chunk[:remaining]
+			}
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				if err == io.EOF {
+					return io.ErrUnexpectedEOF
+				}
+				return err
+			}
+			crc = crc32.Update(crc, crc32.IEEETable, chunk)
+			if err := df.Write(chunk); err != nil {
+				return err
+			}
+			remaining -= int64(len(chunk))
+		}
+
+		// The header is filled in after the value is persisted, so a complete header never precedes a missing value
+		if err := df.Sync(); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(header[:crc32.Size], crc)
+		return patcher.Patch(header, offset)
+	}()
+	if err != nil {
+		// Discard the partially written log record
+		if terr := df.Truncate(offset); terr != nil {
+			return 0, terr
+		}
+		return 0, err
+	}
+
+	return logRecordSize, nil
+}
+
+// ValueReader reads the value of a log record in a data file in chunks,
+// and validates the CRC of the log record once the whole value is read
+type ValueReader struct {
+	Type LogRecordType // Type of the log record
+	Size int64         // Size of the value
+
+	file      *DataFile
+	offset    int64  // Offset of the next byte of the value to read
+	remaining int64  // Number of bytes of the value left to read
+	crc       uint32 // CRC of the bytes read so far
+	expected  uint32 // CRC stored in the header of the log record
+
+	decrypted *bytes.Reader // Value of an encrypted log record, which has been read and decrypted as a whole
+}
+
+// NewValueReader returns a reader of the value of the log record at a given position
+//
+// Only the header and the key are read upfront.
+// An encrypted log record is read and decrypted as a whole, since it is authenticated as a whole.
+func (df *DataFile) NewValueReader(lrp *LogRecordPosition) (*ValueReader, error) {
+	fileSize, err := df.ioHandler.Size()
+	if err != nil {
+		return nil, err
+	}
+	headerBytes := int64(maxLogRecordHeaderSize)
+	if lrp.Offset+headerBytes > fileSize {
+		headerBytes = fileSize - lrp.Offset
+	}
+	if headerBytes <= 0 {
+		return nil, io.EOF
+	}
+	headerBuffer, err := df.readNBytes(headerBytes, lrp.Offset)
+	if err != nil {
+		return nil, err
+	}
+	header, headerSize := decodeLogRecordHeader(headerBuffer)
+	if header == nil || (header.crc == 0 && header.keySize == 0 && header.valueSize == 0) {
+		return nil, io.EOF
+	}
+
+	if header.logRecordType&EncryptedLogRecordFlag != 0 {
+		lr, err := df.ReadLogRecordAt(lrp)
+		if err != nil {
+			return nil, err
+		}
+		vr := &ValueReader{
+			Type:      lr.Type,
+			Size:      int64(len(lr.Value)),
+			decrypted: bytes.NewReader(lr.Value),
+		}
+		return vr, nil
+	}
+
+	key, err := df.readNBytes(int64(header.keySize), lrp.Offset+headerSize)
+	if err != nil {
+		return nil, err
+	}
+	crc := crc32.ChecksumIEEE(headerBuffer[crc32.Size:headerSize])
+	crc = crc32.Update(crc, crc32.IEEETable, key)
+
+	vr := &ValueReader{
+		Type:      header.logRecordType,
+		Size:      int64(header.valueSize),
+		file:      df,
+		offset:    lrp.Offset + headerSize + int64(header.keySize),
+		remaining: int64(header.valueSize),
+		crc:       crc,
+		expected:  header.crc,
+	}
+	return vr, nil
+}
+
+// Read reads the next bytes of the value, it returns ErrInvalidCRC instead of io.EOF if the log record is corrupted
+func (vr *ValueReader) Read(b []byte) (int, error) {
+	if vr.decrypted != nil {
+		return vr.decrypted.Read(b)
+	}
+	if vr.remaining == 0 {
+		if vr.crc != vr.expected {
+			return 0, ErrInvalidCRC
+		}
+		return 0, io.EOF
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	if int64(len(b)) > vr.remaining {
+		b = b[:vr.remaining]
+	}
+	n, err := vr.file.ioHandler.Read(b, vr.offset)
+	vr.crc = crc32.Update(vr.crc, crc32.IEEETable, b[:n])
+	vr.offset += int64(n)
+	vr.remaining -= int64(n)
+	if err == io.EOF {
+		if vr.remaining > 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	return n, err
+}
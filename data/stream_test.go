@@ -0,0 +1,125 @@
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/saint-yellow/baradb/io_handler"
+)
+
+func TestDataFile_WriteLogRecordFrom(t *testing.T) {
+	for _, ioHandlerType := range []io_handler.IOHandlerType{io_handler.FileIOHandler, io_handler.InMemoryIOHandler} {
+		file, _ := OpenDataFile(tempDir, 367, ioHandlerType)
+
+		// A value spans many chunks
+		value := make([]byte, 3*streamChunkSize+114)
+		rand.Read(value)
+		size, err := file.WriteLogRecordFrom(&LogRecord{Key: []byte("114"), Type: NormalLogRecord}, bytes.NewReader(value), int64(len(value)))
+		assert.Nil(t, err)
+		assert.Equal(t, file.WriteOffset, size)
+
+		// It is the same log record as a written one
+		lr, n, err := file.ReadLogRecord(0)
+		assert.Nil(t, err)
+		assert.Equal(t, size, n)
+		assert.Equal(t, "114", string(lr.Key))
+		assert.Equal(t, value, lr.Value)
+		elr, _ := EncodeLogRecord(&LogRecord{Key: []byte("114"), Value: value, Type: NormalLogRecord})
+		assert.Equal(t, int64(len(elr)), size)
+
+		// A reader which ends early writes nothing
+		_, err = file.WriteLogRecordFrom(&LogRecord{Key: []byte("514"), Type: NormalLogRecord}, bytes.NewReader(value[:10]), 11)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		assert.Equal(t, size, file.WriteOffset)
+		fileSize, _ := file.Size()
+		assert.Equal(t, size, fileSize)
+
+		// An empty value
+		n, err = file.WriteLogRecordFrom(&LogRecord{Key: []byte("514"), Type: DeletedLogRecord}, bytes.NewReader(nil), 0)
+		assert.Nil(t, err)
+		lr, _, err = file.ReadLogRecord(size)
+		assert.Nil(t, err)
+		assert.Equal(t, DeletedLogRecord, lr.Type)
+		assert.Equal(t, size+n, file.WriteOffset)
+
+		_, err = file.WriteLogRecordFrom(&LogRecord{Key: []byte("514"), Type: NormalLogRecord}, bytes.NewReader(nil), -1)
+		assert.Equal(t, ErrLogRecordTooLarge, err)
+
+		assert.Nil(t, file.Close())
+		os.Remove(file.Path())
+	}
+
+	// A log record whose header was not filled in is read as the end of the data file
+	file, _ := OpenDataFile(tempDir, 368, io_handler.FileIOHandler)
+	file.Write(make([]byte, 5+2))
+	file.Write([]byte("114514"))
+	_, _, err := file.ReadLogRecord(0)
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, file.Close())
+	os.Remove(file.Path())
+
+	// Streaming is not supported by read-only memory mapping or encryption
+	file, _ = OpenDataFile(tempDir, 369, io_handler.MemoryMappedIOHandler)
+	_, err = file.WriteLogRecordFrom(&LogRecord{Key: []byte("114"), Type: NormalLogRecord}, bytes.NewReader(nil), 0)
+	assert.Equal(t, ErrStreamingNotSupported, err)
+	assert.Nil(t, file.Close())
+	file, _ = OpenDataFile(tempDir, 369, io_handler.FileIOHandler)
+	file.SetCipher(NewCipher(NewStaticKeyProvider(1, testingKey1)))
+	_, err = file.WriteLogRecordFrom(&LogRecord{Key: []byte("114"), Type: NormalLogRecord}, bytes.NewReader(nil), 0)
+	assert.Equal(t, ErrStreamingNotSupported, err)
+	assert.Nil(t, file.Close())
+	os.Remove(file.Path())
+}
+
+func TestDataFile_NewValueReader(t *testing.T) {
+	file, _ := OpenDataFile(tempDir, 370, io_handler.FileIOHandler)
+
+	value := make([]byte, 2*streamChunkSize)
+	rand.Read(value)
+	b, size := EncodeLogRecord(&LogRecord{Key: []byte("114"), Value: value, Type: NormalLogRecord})
+	file.Write(b)
+	lrp := &LogRecordPosition{FileID: 370, Offset: 0, Size: uint32(size)}
+
+	vr, err := file.NewValueReader(lrp)
+	assert.Nil(t, err)
+	assert.Equal(t, NormalLogRecord, vr.Type)
+	assert.Equal(t, int64(len(value)), vr.Size)
+	read, err := io.ReadAll(vr)
+	assert.Nil(t, err)
+	assert.Equal(t, value, read)
+
+	// An encrypted log record is decrypted as a whole
+	file.SetCipher(NewCipher(NewStaticKeyProvider(1, testingKey1)))
+	b, encryptedSize, _ := file.EncodeLogRecord(&LogRecord{Key: []byte("514"), Value: []byte("1919810"), Type: NormalLogRecord})
+	file.Write(b)
+	vr, err = file.NewValueReader(&LogRecordPosition{FileID: 370, Offset: size, Size: uint32(encryptedSize)})
+	assert.Nil(t, err)
+	read, err = io.ReadAll(vr)
+	assert.Nil(t, err)
+	assert.Equal(t, "1919810", string(read))
+
+	// A corrupted value is detected at its end
+	corrupted := make([]byte, len(value))
+	copy(corrupted, value)
+	corrupted[len(corrupted)-1] ^= 0xff
+	b, corruptedSize := EncodeLogRecord(&LogRecord{Key: []byte("114"), Value: corrupted, Type: NormalLogRecord})
+	copy(b[len(b)-len(corrupted):], value)
+	offset := file.WriteOffset
+	file.Write(b)
+	vr, err = file.NewValueReader(&LogRecordPosition{FileID: 370, Offset: offset, Size: uint32(corruptedSize)})
+	assert.Nil(t, err)
+	_, err = io.ReadAll(vr)
+	assert.Equal(t, ErrInvalidCRC, err)
+
+	// There is no log record at the end of the data file
+	_, err = file.NewValueReader(&LogRecordPosition{FileID: 370, Offset: file.WriteOffset})
+	assert.Equal(t, io.EOF, err)
+
+	assert.Nil(t, file.Close())
+	os.Remove(file.Path())
+}
@@ -1,7 +1,10 @@
 package baradb
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"hash/maphash"
 	"io"
 	"os"
 	"path/filepath"
@@ -9,48 +12,76 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/gofrs/flock"
 
+	"github.com/saint-yellow/baradb/bloom"
+	"github.com/saint-yellow/baradb/cache"
 	"github.com/saint-yellow/baradb/data"
 	"github.com/saint-yellow/baradb/index"
 	"github.com/saint-yellow/baradb/io_handler"
+	"github.com/saint-yellow/baradb/metrics"
 	"github.com/saint-yellow/baradb/utils"
 )
 
 const (
-	tranNoKey    = "tran-no"
-	fileLockName = "flock"
+	tranNoKey          = "tran-no"
+	appliedPositionKey = "applied-position"
+	fileLockName       = "flock"
+
+	// keyLockNumber Number of locks which order publishes of keys to the index
+	keyLockNumber = 256
 )
 
 // DB represents a baradb engine
 type DB struct {
-	mu               *sync.RWMutex             // Mutial exclusion lock
-	options          DBOptions                 // DB Options
-	fileIDs          []int                     // File IDs of all data files
-	activeFile       *data.DataFile            // Active data file, readable and writeable
-	inactiveFiles    map[uint32]*data.DataFile // Inactive data files, readable but unwritable
-	index            index.Index               // In-memory index
-	tranNo           uint64                    // Globally increasing serial number of a transaction
-	isMerging        bool                      // Whether the DB is merging
-	tranNoFileExists bool                      // Whether a file about transaction serial number exists
-	isFirstLaunch    bool                      // Whether the DB engine is launched for the first time
-	fileLock         *flock.Flock              // File lock
-	bytesWritten     uint                      // Bytes written by the DB
-	reclaimSize      int64                     // Size of invalid data
+	mu              *sync.RWMutex             // Mutial exclusion lock
+	options         DBOptions                 // DB Options
+	fileIDs         []int                     // File IDs of all data files
+	activeFile      *data.DataFile            // Active data file, readable and writeable
+	inactiveFiles   map[uint32]*data.DataFile // Inactive data files, readable but unwritable
+	index           index.Index               // In-memory index
+	tranNo          uint64                    // Globally increasing serial number of a transaction
+	isMerging       bool                      // Whether the DB is merging
+	fileLock        *flock.Flock              // File lock
+	bytesWritten    uint                      // Bytes written by the DB
+	reclaimSize     atomic.Int64              // Size of invalid data
+	checkpointLock  *sync.Mutex               // Lock which makes sure only one checkpoint is made at a time
+	backgroundTasks *sync.WaitGroup           // Background tasks of the DB, such as periodic checkpoints
+	closed          chan struct{}             // Closed when the DB is closed to stop background tasks
+	cipher          *data.Cipher              // Encrypts log records at rest, it is nil if encryption is disabled
+	cache           *cache.Cache              // Caches values of hot log records, it is nil if caching is disabled
+	filter          *bloom.Filter             // Answers lookups of absent keys, it is nil if the Bloom filter is disabled
+	history         map[string][]*version     // Retained versions of keys, it is nil if the history is disabled
+	lastTimestamp   int64                     // Latest write timestamp of log records
+	families        map[string]*ColumnFamily  // Column families by their names
+	familiesByID    map[uint32]*ColumnFamily  // Column families by their IDs
+	nextFamilyID    uint32                    // ID of the next created column family
+	mergeFuncs      map[string]MergeFunc      // Merge functions registered by users
+	operands        map[string]*operandChain  // Merge operands of keys which are not resolved yet
+	instruments     *instruments              // Counters and histograms of operations of the DB
+	keyLocks        []sync.Mutex              // Locks which order publishes of keys to the index, a key is guarded by one by its hash
+	keySeed         maphash.Seed              // Seed of hashes of keys to choose their locks
+	publishes       *sync.WaitGroup           // Writes whose log records are appended but not published to the index yet
 }
 
 // Launch launches a DB engine instance
-func Launch(options DBOptions) (*DB, error) {
+func Launch(options DBOptions) (db *DB, err error) {
+	defer func() {
+		err = classifyError(err)
+	}()
+
 	// make sure that options are valid
+	if options.IOHandlerType == 0 {
+		options.IOHandlerType = io_handler.FileIOHandler
+	}
 	if err := checkDBOptions(options); err != nil {
 		return nil, err
 	}
 
-	var isFirstLaunch bool
 	// make sure the existance of the directory in options
 	if _, err := os.Stat(options.Directory); os.IsNotExist(err) {
-		isFirstLaunch = true
 		if err := os.Mkdir(options.Directory, os.ModePerm); err != nil {
 			return nil, err
 		}
@@ -66,72 +97,126 @@ func Launch(options DBOptions) (*DB, error) {
 		return nil, ErrDatabaseIsUsed
 	}
 
-	entries, err := os.ReadDir(options.Directory)
-	if err != nil {
-		return nil, err
-	}
-	if len(entries) == 0 {
-		isFirstLaunch = true
-	}
+	// Release resources if the DB engine fails to launch, so that it can be launched again
+	launched := false
+	defer func() {
+		if launched {
+			return
+		}
+		if db != nil && db.index != nil {
+			_ = db.index.Close()
+		}
+		_ = fileLock.Unlock()
+	}()
 
 	// initialize DB instance
-	db := &DB{
-		mu:            new(sync.RWMutex),
-		options:       options,
-		activeFile:    nil,
-		inactiveFiles: make(map[uint32]*data.DataFile),
-		index: index.New(
-			options.IndexType,
-			options.Directory,
-			options.SyncWrites,
-		),
-		isFirstLaunch: isFirstLaunch,
-		fileLock:      fileLock,
+	db = &DB{
+		mu:              new(sync.RWMutex),
+		options:         options,
+		activeFile:      nil,
+		inactiveFiles:   make(map[uint32]*data.DataFile),
+		fileLock:        fileLock,
+		checkpointLock:  new(sync.Mutex),
+		backgroundTasks: new(sync.WaitGroup),
+		closed:          make(chan struct{}),
+		mergeFuncs:      make(map[string]MergeFunc),
+		instruments:     newInstruments(),
+		keyLocks:        make([]sync.Mutex, keyLockNumber),
+		keySeed:         maphash.MakeSeed(),
+		publishes:       new(sync.WaitGroup),
+	}
+	if options.KeyProvider != nil {
+		db.cipher = data.NewCipher(options.KeyProvider)
+	}
+	if options.CacheSize > 0 {
+		db.cache = cache.New(options.CacheSize)
 	}
 
 	if err := db.loadMergenceFiles(); err != nil {
 		return nil, err
 	}
 
+	// A persistent index is reused unless its file is missing, for example it was removed after a mergence
+	persistentIndexExists := false
+	if index.IsPersistent(options.IndexType) {
+		indexFilePath := filepath.Join(options.Directory, index.FileName(options.IndexType))
+		if _, err := os.Stat(indexFilePath); err == nil {
+			persistentIndexExists = true
+		}
+	}
+
+	if db.index, err = db.newIndex(); err != nil {
+		return nil, err
+	}
+
 	if err := db.loadDataFiles(); err != nil {
 		return nil, err
 	}
 
-	// If the DB engine uses B+ tree as its index, then it don't need to load index from files
-	if options.IndexType != index.BPtree {
-		if err := db.loadIndexFromHintFile(); err != nil {
+	if persistentIndexExists {
+		// A persistent index which already exists only needs the tail of data files it has not applied yet
+		if err := db.loadPersistentIndex(); err != nil {
 			return nil, err
 		}
-
-		if err := db.loadIndexFromDataFiles(); err != nil {
+	} else {
+		if err := db.loadIndex(); err != nil {
 			return nil, err
 		}
 	}
 
 	// Reset the type of I/O handler
-	if db.options.MMapAtStartup {
+	if db.mmapAtStartup() {
 		if err := db.resetIOHandler(); err != nil {
 			return nil, err
 		}
 	}
 
-	// Get a transaction serial number from file
-	if options.IndexType == index.BPtree {
-		if err := db.loadTranNo(); err != nil {
+	// Discard a torn log record at the end of the active data file, which was being written when the DB engine crashed
+	if err := db.truncateActiveFile(); err != nil {
+		return nil, err
+	}
+
+	if err := db.loadColumnFamilies(); err != nil {
+		return nil, err
+	}
+
+	if len(options.MergeOperators) > 0 {
+		if err := db.loadMergeOperands(); err != nil {
 			return nil, err
 		}
-		if db.activeFile != nil {
-			size, err := db.activeFile.Size()
-			if err != nil {
-				return nil, err
-			}
-			db.activeFile.WriteOffset += size
+	}
+
+	if db.historyEnabled() {
+		if err := db.loadHistory(); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.BloomFilterFalsePositiveRate > 0 {
+		if err := db.loadBloomFilter(); err != nil {
+			return nil, err
 		}
 	}
 
+	if options.CheckpointInterval > 0 {
+		db.backgroundTasks.Add(1)
+		go db.checkpointPeriodically()
+	}
+
+	launched = true
 	return db, nil
 }
 
+// newIndex creates an index configured by the options of the DB engine
+func (db *DB) newIndex() (index.Index, error) {
+	return index.New(db.options.IndexType, index.IndexOptions{
+		Directory:  db.options.Directory,
+		SyncWrites: db.options.SyncWrites,
+		KeyReader:  db.readKeyByPosition,
+		Cipher:     db.cipher,
+	})
+}
+
 // Fork creates a new DB engine instance mainly for merging data
 func (db *DB) Fork(directory string) (*DB, error) {
 	opts := db.options
@@ -150,6 +235,7 @@ func (db *DB) Fork(directory string) (*DB, error) {
 func (db *DB) Backup(directory string) error {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
+	db.waitForPublishes()
 
 	excludedFiles := []string{
 		fileLockName,
@@ -157,12 +243,83 @@ func (db *DB) Backup(directory string) error {
 	return utils.CopyDir(db.options.Directory, directory, excludedFiles)
 }
 
+// BackupContext is like Backup, but it stops between files and returns the error of the context once the context is done
+//
+// Files copied before are left in the directory.
+func (db *DB) BackupContext(ctx context.Context, directory string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	db.waitForPublishes()
+
+	excludedFiles := []string{
+		fileLockName,
+	}
+	return utils.CopyDirContext(ctx, db.options.Directory, directory, excludedFiles)
+}
+
 // Put Writes data to the DB engine
 func (db *DB) Put(key, value []byte) error {
+	return db.PutContext(context.Background(), key, value)
+}
+
+// PutContext is like Put, but nothing is written and the error of the context is returned if the context is done
+// before the lock of the DB engine is acquired
+func (db *DB) PutContext(ctx context.Context, key, value []byte) (err error) {
+	defer db.startOperation(ctx, metrics.OperationPut)(&err)
+
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The lock of the DB engine only orders appends, the index is updated after it is released if possible
+	db.mu.Lock()
+	if err := ctx.Err(); err != nil {
+		db.mu.Unlock()
+		return err
+	}
+	if !db.canPublishConcurrently(key) {
+		defer db.mu.Unlock()
+		return classifyError(db.put(key, value))
+	}
+	lrp, err := db.appendPut(key, value)
+	if err != nil {
+		db.mu.Unlock()
+		return classifyError(err)
+	}
+	db.publishes.Add(1)
+	db.mu.Unlock()
+	defer db.publishes.Done()
+
+	return classifyError(db.publish(key, lrp, false))
+}
+
+// put writes data to the DB engine
+//
+// The caller must hold the lock of the DB engine.
+func (db *DB) put(key, value []byte) error {
+	lrp, err := db.appendPut(key, value)
+	if err != nil {
+		return err
+	}
+	if err := db.publish(key, lrp, false); err != nil {
+		return err
+	}
+	db.dropMergeOperands(key)
+	return nil
+}
 
+// appendPut appends a log record of a key and its value, and updates everything but the index,
+// the caller should publish the returned position to the index
+//
+// The caller must hold the lock of the DB engine.
+func (db *DB) appendPut(key, value []byte) (*data.LogRecordPosition, error) {
 	lr := &data.LogRecord{
 		Key:   data.EncodeKey(key, nonTranNo),
 		Value: value,
@@ -170,95 +327,467 @@ func (db *DB) Put(key, value []byte) error {
 	}
 
 	// Append the data to the current active data file
-	lrp, err := db.appendLogRecord(lr, true)
+	lr.Timestamp = db.nextTimestamp()
+	lrp, err := db.appendLogRecord(lr, false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Update the data in the index
-	if oldLRP := db.index.Put(key, lrp); oldLRP != nil {
-		db.reclaimSize += int64(oldLRP.Size)
+	// The key is added to the Bloom filter before it is published, so that readers never miss it
+	db.addToFilter(key)
+	db.addVersion(key, lr.Timestamp, lrp, false)
+
+	return lrp, nil
+}
+
+// canPublishConcurrently reports whether a write of a key can be published to the index after the lock of the DB engine is released
+//
+// An index which does not keep keys reads them from data files, which are rotated under the lock,
+// and merge operands of a key are resolved against the index under the lock.
+// Writes of them are published under the lock.
+// The caller must hold the lock of the DB engine.
+func (db *DB) canPublishConcurrently(key []byte) bool {
+	if _, ok := db.index.(index.UnconfirmedGetter); ok {
+		return false
+	}
+	_, ok := db.operands[string(key)]
+	return !ok
+}
+
+// publish updates the index with the position of a log record of a key,
+// the key is deleted from the index if the log record is a tombstone
+//
+// Log records are appended in order under the lock of the DB engine, but may be published after it is released,
+// so a log record of a key may be published after a later one of the same key.
+// Positions of a key are compared under a lock of the key, and the later one is kept.
+// Only puts are published after the lock is released, a deletion is published under it once earlier writes are published.
+func (db *DB) publish(key []byte, lrp *data.LogRecordPosition, deleted bool) error {
+	mu := &db.keyLocks[maphash.Bytes(db.keySeed, key)%keyLockNumber]
+	mu.Lock()
+	defer mu.Unlock()
+
+	current, err := db.index.Get(key)
+	if err != nil {
+		return err
+	}
+	if current != nil && lrp.Before(current) {
+		// The log record has been overwritten by a later one, a tombstone is already counted as invalid data
+		if !deleted {
+			db.reclaimSize.Add(int64(lrp.Size))
+		}
+		return nil
 	}
 
+	var oldLRP *data.LogRecordPosition
+	if deleted {
+		var ok bool
+		oldLRP, ok, err = db.index.Delete(key)
+		if err == nil && !ok {
+			// A deletion is published once the key is found in the index, see Delete
+			err = ErrIndexUpdateFailed
+		}
+	} else {
+		oldLRP, err = db.index.Put(key, lrp)
+	}
+	if err != nil {
+		return err
+	}
+	if oldLRP != nil {
+		db.reclaimSize.Add(int64(oldLRP.Size))
+	}
 	return nil
 }
 
+// waitForPublishes waits until writes whose log records are appended are published to the index
+//
+// The caller must hold the lock or the read lock of the DB engine, so that no log record is appended in the meantime.
+// Callers which read the index to write, or take the index as a snapshot, call it first.
+func (db *DB) waitForPublishes() {
+	db.publishes.Wait()
+}
+
 // Get Reads data from the DB engine by a given key
 func (db *DB) Get(key []byte) ([]byte, error) {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
+	return db.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but it returns the error of the context if the context is done
+// before the lock of the DB engine is acquired
+func (db *DB) GetContext(ctx context.Context, key []byte) (value []byte, err error) {
+	defer db.startOperation(ctx, metrics.OperationGet)(&err)
 
 	if len(key) == 0 {
 		return nil, ErrKeyIsEmpty
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	lrp := db.index.Get(key)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	value, err = db.get(key)
+	return value, classifyError(err)
+}
+
+// get reads data from the DB engine by a given key
+//
+// The caller must hold the lock of the DB engine.
+func (db *DB) get(key []byte) ([]byte, error) {
+	if !db.mayContain(key) {
+		return nil, ErrKeyNotFound
+	}
+
+	lrp, lr, err := db.lookup(db.index, key)
+	if err != nil {
+		return nil, err
+	}
 	if lrp == nil {
 		return nil, ErrKeyNotFound
 	}
 
+	// The log record has been read to confirm the key
+	if lr != nil {
+		if db.cache != nil {
+			db.cache.Put(lrp.FileID, lrp.Offset, lr.Value)
+		}
+		return lr.Value, nil
+	}
+
 	// Get value from a data file
 	return db.getValueByPosition(lrp)
 }
 
+// MultiGet Reads data of many keys from the DB engine in a batch
+//
+// Positions of all keys are resolved from the index at once, then log records are read file by file,
+// where adjacent log records are read together.
+//
+// Values and errors are returned in the order of the keys, an error of a key does not affect others.
+func (db *DB) MultiGet(keys [][]byte) (values [][]byte, errs []error) {
+	// The batch is measured as a single read, which fails with the first error of a key other than ErrKeyNotFound
+	var err error
+	defer db.startOperation(context.Background(), metrics.OperationGet)(&err)
+	defer func() {
+		for _, e := range errs {
+			if e != nil && e != ErrKeyNotFound {
+				err = e
+				break
+			}
+		}
+	}()
+
+	values = make([][]byte, len(keys))
+	errs = make([]error, len(keys))
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// Group positions of keys by data files
+	positions := make(map[uint32][]*data.LogRecordPosition)
+	members := make(map[uint32][]int)
+	for i, key := range keys {
+		if len(key) == 0 {
+			errs[i] = ErrKeyIsEmpty
+			continue
+		}
+		if !db.mayContain(key) {
+			errs[i] = ErrKeyNotFound
+			continue
+		}
+		lrp, err := db.index.Get(key)
+		if err != nil {
+			errs[i] = classifyError(err)
+			continue
+		}
+		if lrp == nil {
+			errs[i] = ErrKeyNotFound
+			continue
+		}
+		if db.cache != nil {
+			if value, ok := db.cache.Get(lrp.FileID, lrp.Offset); ok {
+				values[i] = value
+				continue
+			}
+		}
+		positions[lrp.FileID] = append(positions[lrp.FileID], lrp)
+		members[lrp.FileID] = append(members[lrp.FileID], i)
+	}
+
+	fileIDs := make([]uint32, 0, len(positions))
+	for fileID := range positions {
+		fileIDs = append(fileIDs, fileID)
+	}
+	sort.Slice(fileIDs, func(i, j int) bool {
+		return fileIDs[i] < fileIDs[j]
+	})
+
+	for _, fileID := range fileIDs {
+		file := db.getDataFile(fileID)
+		if file == nil {
+			for _, i := range members[fileID] {
+				errs[i] = ErrFileNotFound
+			}
+			continue
+		}
+
+		lrs, lrErrs := file.ReadLogRecords(positions[fileID])
+		for j, i := range members[fileID] {
+			switch {
+			case lrErrs[j] != nil:
+				errs[i] = lrErrs[j]
+			case lrs[j].Type == data.DeletedLogRecord:
+				errs[i] = ErrKeyNotFound
+			case lrs[j].Type == data.MergeOperandLogRecord:
+				values[i], errs[i] = db.getValueByPosition(positions[fileID][j])
+			default:
+				values[i] = lrs[j].Value
+				if db.cache != nil {
+					db.cache.Put(fileID, positions[fileID][j].Offset, lrs[j].Value)
+				}
+			}
+		}
+	}
+
+	return values, errs
+}
+
+// GetView calls a function with the value of a given key without copying the value if possible
+//
+// If data files are handled by writable memory mapping or kept in memory,
+// then the value refers to the memory of the data file, otherwise it refers to a reused buffer.
+// Either way the value is only valid during the call and must not be modified, copy it to keep it.
+//
+// The DB engine is locked for reading during the call, so the function must not write to the DB engine.
+func (db *DB) GetView(key []byte, fn func(value []byte) error) (err error) {
+	defer db.startOperation(context.Background(), metrics.OperationGet)(&err)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	if !db.mayContain(key) {
+		return ErrKeyNotFound
+	}
+
+	lrp, err := db.index.Get(key)
+	if err != nil {
+		return classifyError(err)
+	}
+	if lrp == nil {
+		return ErrKeyNotFound
+	}
+
+	// Errors of the function are returned as they are
+	return db.viewValueByPosition(lrp, fn)
+}
+
+// getDataFile returns the data file with the given ID
+func (db *DB) getDataFile(fileID uint32) *data.DataFile {
+	if db.activeFile != nil && fileID == db.activeFile.FileID {
+		return db.activeFile
+	}
+	return db.inactiveFiles[fileID]
+}
+
 // getValueByPosition gets corresponding value by given position
 func (db *DB) getValueByPosition(lrp *data.LogRecordPosition) ([]byte, error) {
-	// Confirm which data file the keys is stored in
-	var file *data.DataFile
-	if lrp.FileID == db.activeFile.FileID {
-		file = db.activeFile
-	} else {
-		file = db.inactiveFiles[lrp.FileID]
+	if db.cache != nil {
+		if value, ok := db.cache.Get(lrp.FileID, lrp.Offset); ok {
+			return value, nil
+		}
+	}
+
+	lr, err := db.getLogRecordByPosition(lrp)
+	if err != nil {
+		return nil, err
 	}
+
+	if db.cache != nil {
+		db.cache.Put(lrp.FileID, lrp.Offset, lr.Value)
+	}
+	return lr.Value, nil
+}
+
+// getLogRecordByPosition reads the log record of a value at a given position
+func (db *DB) getLogRecordByPosition(lrp *data.LogRecordPosition) (*data.LogRecord, error) {
+	// Confirm which data file the keys is stored in
+	file := db.getDataFile(lrp.FileID)
 	if file == nil {
 		return nil, ErrFileNotFound
 	}
 
-	lr, _, err := file.ReadLogRecord(lrp.Offset)
+	lr, err := file.ReadLogRecordAt(lrp)
 	if err != nil {
 		return nil, err
 	}
+	return db.resolveLogRecord(lr, lrp)
+}
 
-	if lr.Type == data.DeletedLogRecord {
+// resolveLogRecord turns a log record read at a given position into the log record of its value
+func (db *DB) resolveLogRecord(lr *data.LogRecord, lrp *data.LogRecordPosition) (*data.LogRecord, error) {
+	switch lr.Type {
+	case data.DeletedLogRecord:
 		return nil, ErrKeyNotFound
+	case data.MergeOperandLogRecord:
+		value, err := db.resolveMergeOperand(lr, lrp)
+		if err != nil {
+			return nil, err
+		}
+		lr.Value, lr.Type = value, data.NormalLogRecord
 	}
+	return lr, nil
+}
 
-	return lr.Value, nil
+// viewValueByPosition calls a function with the value at a given position without copying the value if possible
+func (db *DB) viewValueByPosition(lrp *data.LogRecordPosition, fn func(value []byte) error) error {
+	file := db.getDataFile(lrp.FileID)
+	if file == nil {
+		return ErrFileNotFound
+	}
+
+	if db.cache != nil {
+		if value, ok := db.cache.Get(lrp.FileID, lrp.Offset); ok {
+			return fn(value)
+		}
+	}
+
+	return file.ViewLogRecord(lrp, func(lr *data.LogRecord) error {
+		switch lr.Type {
+		case data.DeletedLogRecord:
+			return ErrKeyNotFound
+		case data.MergeOperandLogRecord:
+			value, err := db.resolveMergeOperand(lr, lrp)
+			if err != nil {
+				return err
+			}
+			return fn(value)
+		}
+		return fn(lr.Value)
+	})
+}
+
+// readKeyByPosition reads the key of the log record at the given position
+//
+// It is used by an index which does not keep full keys in memory.
+func (db *DB) readKeyByPosition(lrp *data.LogRecordPosition) ([]byte, error) {
+	file := db.getDataFile(lrp.FileID)
+	if file == nil {
+		return nil, ErrFileNotFound
+	}
+
+	lr, err := file.ReadLogRecordAt(lrp)
+	if err != nil {
+		return nil, err
+	}
+
+	key, _ := data.DecodeKey(lr.Key)
+	return key, nil
+}
+
+// lookup gets the position of a key in a given index, and the log record of its value if it has been read
+//
+// An index which does not keep keys may skip confirming the key (see index.UnconfirmedGetter),
+// then the log record is read here to confirm the key, so that the caller does not read it again.
+// It returns a nil position if the key does not exist.
+func (db *DB) lookup(idx index.Index, key []byte) (*data.LogRecordPosition, *data.LogRecord, error) {
+	getter, ok := idx.(index.UnconfirmedGetter)
+	if !ok {
+		lrp, err := idx.Get(key)
+		return lrp, nil, err
+	}
+
+	lrp, confirmed, err := getter.GetUnconfirmed(key)
+	if err != nil || lrp == nil || confirmed {
+		return lrp, nil, err
+	}
+
+	file := db.getDataFile(lrp.FileID)
+	if file == nil {
+		return nil, nil, ErrFileNotFound
+	}
+	lr, err := file.ReadLogRecordAt(lrp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if k, _ := data.DecodeKey(lr.Key); !bytes.Equal(k, key) {
+		return nil, nil, nil
+	}
+	lr, err = db.resolveLogRecord(lr, lrp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lrp, lr, nil
 }
 
 // Delete Delete data by the given key
-func (db *DB) Delete(key []byte) error {
+func (db *DB) Delete(key []byte) (err error) {
+	defer db.startOperation(context.Background(), metrics.OperationDelete)(&err)
+
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
 
+	// A deletion is published under the lock of the DB engine after earlier writes are published,
+	// since a tombstone leaves no position in the index for an earlier write published later to be compared with,
+	// and the key is only found in the index once earlier writes of it are published
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.waitForPublishes()
+
+	return classifyError(db.delete(key))
+}
+
+// delete deletes data by the given key
+//
+// The caller must hold the lock of the DB engine.
+func (db *DB) delete(key []byte) error {
+	lrp, err := db.appendDelete(key)
+	if err != nil || lrp == nil {
+		return err
+	}
+	if err := db.publish(key, lrp, true); err != nil {
+		return err
+	}
+	db.dropMergeOperands(key)
+	return nil
+}
+
+// appendDelete appends a tombstone of a key, and updates everything but the index,
+// the caller should publish the returned position to the index
+//
+// It returns a nil position if the key does not exist, then nothing is appended.
+// The caller must hold the lock of the DB engine.
+func (db *DB) appendDelete(key []byte) (*data.LogRecordPosition, error) {
 	// Maybe the data never exist, or it has been deleted before
-	if p := db.index.Get(key); p == nil {
-		return nil
+	if !db.mayContain(key) {
+		return nil, nil
+	}
+	if p, err := db.index.Get(key); err != nil || p == nil {
+		return nil, err
 	}
 
 	lr := &data.LogRecord{
-		Key:  data.EncodeKey(key, nonTranNo),
-		Type: data.DeletedLogRecord,
+		Key:       data.EncodeKey(key, nonTranNo),
+		Type:      data.DeletedLogRecord,
+		Timestamp: db.nextTimestamp(),
 	}
 
 	//
-	lrp, err := db.appendLogRecord(lr, true)
+	lrp, err := db.appendLogRecord(lr, false)
 	if err != nil {
-		return err
-	}
-	db.reclaimSize += int64(lrp.Size)
-
-	//
-	oldLRP, ok := db.index.Delete(key)
-	if !ok {
-		return ErrIndexUpdateFailed
-	}
-	if oldLRP != nil {
-		db.reclaimSize += int64(oldLRP.Size)
+		return nil, err
 	}
+	db.reclaimSize.Add(int64(lrp.Size))
+	db.addVersion(key, lr.Timestamp, lrp, true)
 
-	return nil
+	return lrp, nil
 }
 
 // appendLogRecord appends a log record to the current active data file in DB
@@ -274,21 +803,20 @@ func (db *DB) appendLogRecord(lr *data.LogRecord, needMutex bool) (*data.LogReco
 		}
 	}
 
-	elr, n := data.EncodeLogRecord(lr)
-	if db.activeFile.WriteOffset+n > db.options.MaxDataFileSize {
-		if err := db.activeFile.Sync(); err != nil {
-			return nil, err
-		}
-
-		db.inactiveFiles[db.activeFile.FileID] = db.activeFile
-
-		if err := db.setActiveFile(); err != nil {
-			return nil, err
-		}
+	elr, n, err := db.activeFile.EncodeLogRecord(lr)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.rotateActiveFile(n); err != nil {
+		return nil, err
 	}
 
 	writeOffset := db.activeFile.WriteOffset
 	if err := db.activeFile.Write(elr); err != nil {
+		// Discard a partially written log record, so that the next one is not appended after garbage
+		if terr := db.activeFile.Truncate(writeOffset); terr != nil {
+			return nil, terr
+		}
 		return nil, err
 	}
 
@@ -319,6 +847,25 @@ func (db *DB) appendLogRecord(lr *data.LogRecord, needMutex bool) (*data.LogReco
 	return lrp, nil
 }
 
+// rotateActiveFile makes the active data file inactive and sets a new one if a log record of a given size does not fit in it
+// The caller must have a mutex lock before calling this function
+func (db *DB) rotateActiveFile(size int64) error {
+	if db.activeFile.WriteOffset+size <= db.options.MaxDataFileSize {
+		return nil
+	}
+
+	if err := db.activeFile.Sync(); err != nil {
+		return err
+	}
+	if err := db.activeFile.Seal(); err != nil {
+		return err
+	}
+
+	db.inactiveFiles[db.activeFile.FileID] = db.activeFile
+
+	return db.setActiveFile()
+}
+
 // setActiveFile sets an active data file in DB
 // The caller must have a mutex lock before calling this function
 func (db *DB) setActiveFile() error {
@@ -327,10 +874,15 @@ func (db *DB) setActiveFile() error {
 		fileID = db.activeFile.FileID + 1
 	}
 
-	file, err := data.OpenDataFile(db.options.Directory, fileID, io_handler.FileIOHandler)
+	file, err := data.OpenDataFile(db.options.Directory, fileID, db.options.IOHandlerType)
 	if err != nil {
 		return err
 	}
+	file.SetCipher(db.cipher)
+	file.SetSyncTracer(db.startSync)
+	if db.activeFile != nil {
+		db.instruments.fileRotations.Inc()
+	}
 	db.activeFile = file
 	return nil
 }
@@ -361,14 +913,16 @@ func (db *DB) loadDataFiles() error {
 
 	// Open every single data file sequantially
 	for i, fileID := range fileIDs {
-		ioHandlerType := io_handler.FileIOHandler
-		if db.options.MMapAtStartup {
+		ioHandlerType := db.options.IOHandlerType
+		if db.mmapAtStartup() {
 			ioHandlerType = io_handler.MemoryMappedIOHandler
 		}
 		file, err := data.OpenDataFile(db.options.Directory, uint32(fileID), ioHandlerType)
 		if err != nil {
 			return err
 		}
+		file.SetCipher(db.cipher)
+		file.SetSyncTracer(db.startSync)
 
 		// The last data file shoule be the current active one of the DB engine
 		if i == len(fileIDs)-1 {
@@ -381,8 +935,32 @@ func (db *DB) loadDataFiles() error {
 	return nil
 }
 
+// loadIndex builds the in-memory index from a checkpoint, or from the hint file and data files if there is no valid checkpoint
+func (db *DB) loadIndex() error {
+	lrp, err := db.loadIndexFromCheckpoint()
+	if err == nil && lrp != nil {
+		return db.loadIndexFromDataFiles(lrp)
+	}
+
+	// The checkpoint is unusable, so discard what has been loaded from it and replay all data files
+	if err != nil {
+		if db.index, err = db.newIndex(); err != nil {
+			return err
+		}
+		db.tranNo = nonTranNo
+		db.reclaimSize.Store(0)
+	}
+
+	if err := db.loadIndexFromHintFile(); err != nil {
+		return err
+	}
+	return db.loadIndexFromDataFiles(nil)
+}
+
 // loadIndexFromDataFiles Build index from data files on the disk and load the built index to the memory
-func (db *DB) loadIndexFromDataFiles() error {
+//
+// Log records before the given position are skipped if the position is not nil.
+func (db *DB) loadIndexFromDataFiles(start *data.LogRecordPosition) error {
 	if len(db.fileIDs) == 0 {
 		return nil
 	}
@@ -397,29 +975,37 @@ func (db *DB) loadIndexFromDataFiles() error {
 		hasMerged, nonMergedFileID = true, fileID
 	}
 
-	updateIndex := func(key []byte, lrt data.LogRecordType, lrp *data.LogRecordPosition) {
+	updateIndex := func(key []byte, lrt data.LogRecordType, lrp *data.LogRecordPosition) error {
 		var oldLRP *data.LogRecordPosition
+		var err error
 		if lrt == data.DeletedLogRecord {
-			oldLRP, _ = db.index.Delete(key)
-			db.reclaimSize += int64(lrp.Size)
+			oldLRP, _, err = db.index.Delete(key)
+			db.reclaimSize.Add(int64(lrp.Size))
 		} else {
-			oldLRP = db.index.Put(key, lrp)
+			oldLRP, err = db.index.Put(key, lrp)
+		}
+		if err != nil {
+			return err
 		}
 
 		if oldLRP != nil {
-			db.reclaimSize += int64(oldLRP.Size)
+			db.reclaimSize.Add(int64(oldLRP.Size))
 		}
+		return nil
 	}
 
 	transactionRecords := make(map[uint64][]*data.TransactionRecord)
 
-	currentTransNo := nonTranNo
+	currentTransNo := db.tranNo
 
 	for i, fid := range db.fileIDs {
 		fileID := uint32(fid)
 		if hasMerged && fileID < nonMergedFileID {
 			continue
 		}
+		if start != nil && fileID < start.FileID {
+			continue
+		}
 		var file *data.DataFile
 		if fileID == db.activeFile.FileID {
 			file = db.activeFile
@@ -428,6 +1014,9 @@ func (db *DB) loadIndexFromDataFiles() error {
 		}
 
 		var offset int64 = 0
+		if start != nil && fileID == start.FileID {
+			offset = start.Offset
+		}
 		for {
 			lr, n, err := file.ReadLogRecord(offset)
 			if err != nil {
@@ -442,18 +1031,34 @@ func (db *DB) loadIndexFromDataFiles() error {
 				Offset: offset,
 				Size:   uint32(n),
 			}
+			if lr.Timestamp > db.lastTimestamp {
+				db.lastTimestamp = lr.Timestamp
+			}
 
 			// Decode the key of the log record to get the real key and the transaction serial number
 			lrKey, tranNo := data.DecodeKey(lr.Key)
+			// Log records of column families are loaded into their own indexes, see loadColumnFamilyIndexes
 			if tranNo == nonTranNo {
 				// If transaction serial number is 0, then update the in-memory index directly
 				// Because it is not a transactional operation
-				updateIndex(lrKey, lr.Type, lrp)
+				if lr.Type == data.RangeTombstoneLogRecord {
+					if _, err := db.deleteRange(lrKey, lr.Value, lrp); err != nil {
+						return err
+					}
+				} else if lr.Family == 0 {
+					if err := updateIndex(lrKey, lr.Type, lrp); err != nil {
+						return err
+					}
+				}
 			} else {
 				// Transactional operation
 				if lr.Type == data.TransactionFinishedLogRecord {
 					for _, tr := range transactionRecords[tranNo] {
-						updateIndex(tr.Log.Key, tr.Log.Type, tr.Position)
+						if tr.Log.Family == 0 {
+							if err := updateIndex(tr.Log.Key, tr.Log.Type, tr.Position); err != nil {
+								return err
+							}
+						}
 					}
 					delete(transactionRecords, tranNo)
 				} else {
@@ -496,6 +1101,7 @@ func (db *DB) loadIndexFromHintFile() error {
 	if err != nil {
 		return err
 	}
+	file.SetCipher(db.cipher)
 
 	var offset int64 = 0
 	for {
@@ -508,14 +1114,81 @@ func (db *DB) loadIndexFromHintFile() error {
 		}
 
 		lrp := data.DecodeLogRecordPosition(lr.Value)
-		db.index.Put(lr.Key, lrp)
+		if _, err := db.index.Put(lr.Key, lrp); err != nil {
+			return err
+		}
 		offset += n
 	}
 	return nil
 }
 
-// loadTranNo Gets a transaction serial number from a file
+// loadPersistentIndex brings an existing persistent index up to date with data files
+//
+// Data written after the last applied position recorded by the index is replayed,
+// so that writes whose index updates were lost in a crash are applied again.
+// All data files are replayed if the index records no valid position.
+func (db *DB) loadPersistentIndex() error {
+	if err := db.loadTranNo(); err != nil {
+		return err
+	}
+
+	position, err := db.loadAppliedPosition()
+	if err != nil {
+		return err
+	}
+	if err := db.loadIndexFromDataFiles(position); err != nil {
+		return err
+	}
+
+	return db.saveIndexMetadata()
+}
+
+// loadAppliedPosition gets the position in data files up to which a persistent index has applied
+//
+// It returns nil if the position is missing or does not point into an existing data file.
+func (db *DB) loadAppliedPosition() (*data.LogRecordPosition, error) {
+	ms, ok := db.index.(index.MetadataStore)
+	if !ok {
+		return nil, nil
+	}
+	value, err := ms.GetMetadata([]byte(appliedPositionKey))
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	position := data.DecodeLogRecordPosition(value)
+	dataFile := db.getDataFile(position.FileID)
+	if dataFile == nil {
+		return nil, nil
+	}
+	size, err := dataFile.Size()
+	if err != nil {
+		return nil, err
+	}
+	if position.Offset > size {
+		return nil, nil
+	}
+	return position, nil
+}
+
+// loadTranNo Gets a transaction serial number persisted by a persistent index
+//
+// A tran-no file written by earlier versions of the DB engine is read as well, and then removed.
 func (db *DB) loadTranNo() error {
+	if ms, ok := db.index.(index.MetadataStore); ok {
+		value, err := ms.GetMetadata([]byte(tranNoKey))
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			tranNo, err := strconv.ParseUint(string(value), 10, 64)
+			if err != nil {
+				return err
+			}
+			db.tranNo = tranNo
+		}
+	}
+
 	filePath := filepath.Join(db.options.Directory, data.TranNoFileName)
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return nil
@@ -525,6 +1198,7 @@ func (db *DB) loadTranNo() error {
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
 	lr, _, err := file.ReadLogRecord(0)
 	if err != nil {
@@ -535,25 +1209,59 @@ func (db *DB) loadTranNo() error {
 	if err != nil {
 		return err
 	}
+	if tranNo > db.tranNo {
+		db.tranNo = tranNo
+	}
 
-	db.tranNo = tranNo
-	db.tranNoFileExists = true
-
+	if err := db.saveIndexMetadata(); err != nil {
+		return err
+	}
 	return os.Remove(filePath)
 }
 
+// saveIndexMetadata persists the current transaction serial number and the position in data files
+// up to which the index has applied in a persistent index,
+// since such an index only replays data files after that position at startup
+//
+// It must be called while no write is half applied, i.e. with the lock of the DB engine held.
+func (db *DB) saveIndexMetadata() error {
+	ms, ok := db.index.(index.MetadataStore)
+	if !ok {
+		return nil
+	}
+	// The position must be covered by the index
+	db.waitForPublishes()
+	if err := ms.PutMetadata([]byte(tranNoKey), []byte(strconv.FormatUint(db.tranNo, 10))); err != nil {
+		return err
+	}
+	if db.activeFile == nil {
+		return nil
+	}
+	position := &data.LogRecordPosition{
+		FileID: db.activeFile.FileID,
+		Offset: db.activeFile.WriteOffset,
+	}
+	return ms.PutMetadata([]byte(appliedPositionKey), data.EncodeLogRecordPosition(position))
+}
+
+// mmapAtStartup reports whether data files are loaded with read-only memory mapping at startup,
+// which is unnecessary if they are handled by writable memory mapping anyway
+func (db *DB) mmapAtStartup() bool {
+	return db.options.MMapAtStartup && db.options.IOHandlerType != io_handler.WritableMemoryMappedIOHandler
+}
+
 func (db *DB) resetIOHandler() error {
 	if db.activeFile == nil {
 		return nil
 	}
 
 	var err error
-	err = db.activeFile.SetIOHandler(io_handler.FileIOHandler)
+	err = db.activeFile.SetIOHandler(db.options.IOHandlerType)
 	if err != nil {
 		return err
 	}
 	for _, file := range db.inactiveFiles {
-		err = file.SetIOHandler(io_handler.FileIOHandler)
+		err = file.SetIOHandler(db.options.IOHandlerType)
 		if err != nil {
 			return err
 		}
@@ -561,9 +1269,33 @@ func (db *DB) resetIOHandler() error {
 	return nil
 }
 
+// truncateActiveFile discards data after the last complete log record in the active data file
+func (db *DB) truncateActiveFile() error {
+	if db.activeFile == nil {
+		return nil
+	}
+
+	size, err := db.activeFile.Size()
+	if err != nil {
+		return err
+	}
+	if size <= db.activeFile.WriteOffset {
+		return nil
+	}
+	return db.activeFile.Truncate(db.activeFile.WriteOffset)
+}
+
 // ListKeys gets all keys in the DB engine
-func (db *DB) ListKeys() [][]byte {
-	iter := db.index.Iterator(false)
+func (db *DB) ListKeys() ([][]byte, error) {
+	// An index which does not keep keys reads them from data files, which are rotated under the lock
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	iter, err := db.index.Iterator(false)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
 	keys := make([][]byte, db.index.Size())
 
 	index := 0
@@ -572,7 +1304,7 @@ func (db *DB) ListKeys() [][]byte {
 		index++
 	}
 
-	return keys
+	return keys, nil
 }
 
 // userOperationFunc User-defined function
@@ -581,12 +1313,24 @@ type userOperationFunc = func(key, value []byte) bool
 // Fold retrieves all the data and iteratively executes an user-specified operation (UDF)
 // Once the UDF failed, the iteration will stop intermediatelly
 func (db *DB) Fold(fn userOperationFunc) error {
+	return db.FoldContext(context.Background(), fn)
+}
+
+// FoldContext is like Fold, but it stops between keys and returns the error of the context once the context is done
+func (db *DB) FoldContext(ctx context.Context, fn userOperationFunc) error {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
-	iter := db.index.Iterator(false)
+	iter, err := db.index.Iterator(false)
+	if err != nil {
+		return err
+	}
 	defer iter.Close()
 	for iter.Rewind(); iter.Valid(); iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		value, err := db.getValueByPosition(iter.Value())
 		if err != nil {
 			return err
@@ -600,44 +1344,84 @@ func (db *DB) Fold(fn userOperationFunc) error {
 	return nil
 }
 
+// FoldView is like Fold, but values are not copied if possible
+//
+// A value is only valid during the call of the UDF and must not be modified, see GetView for details.
+func (db *DB) FoldView(fn userOperationFunc) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	iter, err := db.index.Iterator(false)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		ok := true
+		err := db.viewValueByPosition(iter.Value(), func(value []byte) error {
+			ok = fn(iter.Key(), value)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			break
+		}
+	}
+
+	return nil
+}
+
 // Close closes the DB engine
-func (db *DB) Close() error {
+func (db *DB) Close() (err error) {
 	defer func() {
-		if err := db.fileLock.Unlock(); err != nil {
-			panic(fmt.Sprintf("Failed to unlock the directory, %v", err))
+		if unlockErr := db.fileLock.Unlock(); unlockErr != nil && err == nil {
+			err = fmt.Errorf("failed to unlock the directory: %w", unlockErr)
 		}
+		err = classifyError(err)
 	}()
 
+	// Stop background tasks
+	select {
+	case <-db.closed:
+	default:
+		close(db.closed)
+	}
+	db.backgroundTasks.Wait()
+
 	// There is nothing to do if the DB engine has no data file
 	if db.activeFile == nil {
 		return nil
 	}
 
+	if db.options.CheckpointAtClose {
+		if err := db.Checkpoint(); err != nil {
+			return err
+		}
+	}
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
+	db.waitForPublishes()
 
-	var err error
-
-	err = db.index.Close()
+	err = db.saveIndexMetadata()
 	if err != nil {
 		return err
 	}
 
-	// Save the current transaction serial numbers
-	file, err := data.OpenTranNoFile(db.options.Directory)
+	err = db.saveBloomFilter()
 	if err != nil {
 		return err
 	}
-	lr := &data.LogRecord{
-		Key:   []byte(tranNoKey),
-		Value: []byte(strconv.FormatUint(db.tranNo, 10)),
-	}
-	elr, _ := data.EncodeLogRecord(lr)
-	err = file.Write(elr)
+
+	err = db.index.Close()
 	if err != nil {
 		return err
 	}
-	err = file.Sync()
+
+	err = db.closeColumnFamilies()
 	if err != nil {
 		return err
 	}
@@ -660,6 +1444,8 @@ func (db *DB) Close() error {
 }
 
 // Sync persistence of data in active data file of the DB engine
+//
+// The sync of the data file is measured as a sync operation, like syncs by SyncWrites, SyncThreshold and rotation.
 func (db *DB) Sync() error {
 	if db.activeFile == nil {
 		return nil
@@ -670,11 +1456,15 @@ func (db *DB) Sync() error {
 
 	// The inactive data file was already been synced before
 	// So the current active data file is the only thing to handle
-	return db.activeFile.Sync()
+	if err := db.activeFile.Sync(); err != nil {
+		return classifyError(err)
+	}
+
+	return classifyError(db.saveIndexMetadata())
 }
 
 // Stat returns statistical information of the DB engine
-func (db *DB) Stat() *Stat {
+func (db *DB) Stat() (*Stat, error) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
@@ -685,14 +1475,20 @@ func (db *DB) Stat() *Stat {
 
 	dataFileSize, err := utils.DirSize(db.options.Directory)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to read the directory of the DB engine: %v", err))
+		return nil, classifyError(err)
 	}
 
 	stat := &Stat{
 		KeyNumber:       uint(db.index.Size()),
 		DataFileNumber:  uint(dataFileNumber),
-		ReclaimableSize: db.reclaimSize,
+		ReclaimableSize: db.reclaimSize.Load(),
 		DiskSize:        dataFileSize,
 	}
-	return stat
+	if db.cache != nil {
+		cacheStat := db.cache.Stat()
+		stat.CacheHits = cacheStat.Hits
+		stat.CacheMisses = cacheStat.Misses
+		stat.CacheSize = cacheStat.Size
+	}
+	return stat, nil
 }
@@ -1,14 +1,24 @@
 package baradb
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/saint-yellow/baradb/data"
 	"github.com/saint-yellow/baradb/index"
+	"github.com/saint-yellow/baradb/io_handler"
+	"github.com/saint-yellow/baradb/metrics"
 	"github.com/saint-yellow/baradb/utils"
 )
 
@@ -33,6 +43,22 @@ func destroyDB(db *DB) {
 	}
 }
 
+// statOf gets statistical information of the DB engine, and fails the test if it is unavailable
+func statOf(t *testing.T, db *DB) *Stat {
+	t.Helper()
+	stat, err := db.Stat()
+	assert.Nil(t, err)
+	return stat
+}
+
+// keysOf gets all keys in the DB engine, and fails the test if they are unavailable
+func keysOf(t *testing.T, db *DB) [][]byte {
+	t.Helper()
+	keys, err := db.ListKeys()
+	assert.Nil(t, err)
+	return keys
+}
+
 func TestDB_Launch(t *testing.T) {
 	db, err := Launch(testingDBOptions)
 	defer destroyDB(db)
@@ -297,19 +323,23 @@ func TestDB_ListKeys(t *testing.T) {
 	defer destroyDB(db)
 
 	var keys [][]byte
+	var err error
 
 	// The DB engine has no key
-	keys = db.ListKeys()
+	keys, err = db.ListKeys()
+	assert.Nil(t, err)
 	assert.Equal(t, 0, len(keys))
 
 	// The DB engine has one key
 	db.Put([]byte("114"), []byte("514"))
-	keys = db.ListKeys()
+	keys, err = db.ListKeys()
+	assert.Nil(t, err)
 	assert.Equal(t, 1, len(keys))
 
 	// The DB engine deletes the only Key
 	db.Delete([]byte("114"))
-	keys = db.ListKeys()
+	keys, err = db.ListKeys()
+	assert.Nil(t, err)
 	assert.Equal(t, 0, len(keys))
 
 	// The DB engine has more than one key
@@ -317,7 +347,8 @@ func TestDB_ListKeys(t *testing.T) {
 	for i := 11; i <= 30; i++ {
 		db.Put([]byte(fmt.Sprintf("%02d", i)), utils.NewRandomValue(8))
 	}
-	keys = db.ListKeys()
+	keys, err = db.ListKeys()
+	assert.Nil(t, err)
 	assert.Equal(t, keysCount, len(keys))
 	index := 11
 	for _, key := range keys {
@@ -447,8 +478,14 @@ func TestDB_NewWriteBatch(t *testing.T) {
 		wb  *WriteBatch
 	)
 
+	// Invalid options
+	wb, err = db.NewWriteBatch(WriteBatchOptions{})
+	assert.Equal(t, ErrInvalidMaxBatchNumber, err)
+	assert.Nil(t, wb)
+
 	// Write data, no commit
-	wb = db.NewWriteBatch(DefaultWriteBatchOptions)
+	wb, err = db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
 	assert.NotNil(t, wb)
 	err = wb.Put([]byte("114"), []byte("514"))
 	assert.Nil(t, err)
@@ -533,9 +570,11 @@ func TestDB_Stat(t *testing.T) {
 	defer destroyDB(db)
 
 	var stat *Stat
+	var err error
 
 	// No key
-	stat = db.Stat()
+	stat, err = db.Stat()
+	assert.Nil(t, err)
 	assert.Zero(t, stat.KeyNumber)
 	assert.Zero(t, stat.DataFileNumber)
 	assert.Zero(t, stat.ReclaimableSize)
@@ -548,7 +587,8 @@ func TestDB_Stat(t *testing.T) {
 		db.Put(utils.NewKey(i), utils.NewRandomValue(4096))
 	}
 
-	stat = db.Stat()
+	stat, err = db.Stat()
+	assert.Nil(t, err)
 	assert.Equal(t, keyNumber, int(stat.KeyNumber))
 	entries, _ := os.ReadDir(db.options.Directory)
 	assert.Equal(t, len(entries)-1, int(stat.DataFileNumber))
@@ -571,7 +611,7 @@ func TestDB_Backup(t *testing.T) {
 	err := db1.Backup(dir)
 	assert.Nil(t, err)
 
-	n1 := db1.Stat().DataFileNumber
+	n1 := statOf(t, db1).DataFileNumber
 	entries, err := os.ReadDir(dir)
 	assert.Nil(t, err)
 	n2 := len(entries)
@@ -588,7 +628,7 @@ func TestDB_Backup(t *testing.T) {
 	db2, _ := Launch(opts2)
 	defer destroyDB(db2)
 
-	assert.EqualValues(t, db1.Stat(), db2.Stat())
+	assert.EqualValues(t, statOf(t, db1), statOf(t, db2))
 }
 
 func TestDB_Fork(t *testing.T) {
@@ -601,3 +641,2195 @@ func TestDB_Fork(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, db2)
 }
+
+func TestDB_ReadMergenceBatches(t *testing.T) {
+	opts := testingDBOptions
+	opts.MaxDataFileSize = 4 * 1024
+	db, _ := Launch(opts)
+	defer destroyDB(db)
+
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(512)))
+	}
+	files := make([]*data.DataFile, 0, len(db.inactiveFiles))
+	for _, file := range db.inactiveFiles {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].FileID < files[j].FileID
+	})
+	assert.Greater(t, len(files), 2*mergenceReadConcurrency)
+
+	// Data files are read concurrently, and batches of every data file arrive in order
+	done := make(chan struct{})
+	readers := new(sync.WaitGroup)
+	batches := readMergenceBatches(files, done, readers)
+	for i, file := range files {
+		var offset int64 = 0
+		for batch := range batches[i] {
+			assert.Nil(t, batch.err)
+			for j, lr := range batch.lrs {
+				expected, _, err := file.ReadLogRecord(offset)
+				assert.Nil(t, err)
+				assert.Equal(t, expected, lr)
+				offset += batch.sizes[j]
+			}
+		}
+		assert.Equal(t, file.WriteOffset, offset)
+	}
+	close(done)
+	readers.Wait()
+
+	// Reading stops once the mergence stops
+	done = make(chan struct{})
+	batches = readMergenceBatches(files, done, readers)
+	<-batches[0]
+	close(done)
+	readers.Wait()
+}
+
+func TestDB_HashIndex(t *testing.T) {
+	opts := testingDBOptions
+	opts.IndexType = index.Hash
+	db, _ := Launch(opts)
+	defer destroyDB(db)
+
+	for i := 1; i <= 100; i++ {
+		db.Put(utils.NewKey(i), utils.NewRandomValue(64))
+	}
+	for i := 51; i <= 100; i++ {
+		db.Delete(utils.NewKey(i))
+	}
+	db.Put([]byte("114"), []byte("514"))
+
+	// Relaunch the DB engine, the index is restored from its own file
+	db.Close()
+	db, _ = Launch(opts)
+	assert.Equal(t, 51, int(statOf(t, db).KeyNumber))
+	val, err := db.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.Equal(t, "514", string(val))
+	_, err = db.Get(utils.NewKey(100))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// Merge data, then the index is rebuilt since positions are changed
+	err = db.Merge()
+	assert.Nil(t, err)
+	db.Close()
+	db, _ = Launch(opts)
+	assert.Equal(t, 51, int(statOf(t, db).KeyNumber))
+	val, err = db.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.Equal(t, "514", string(val))
+	for i := 1; i <= 50; i++ {
+		val, err = db.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+		assert.NotNil(t, val)
+	}
+}
+
+func TestDB_FingerprintIndex(t *testing.T) {
+	opts := testingDBOptions
+	opts.IndexType = index.Fingerprint
+	db, _ := Launch(opts)
+	defer destroyDB(db)
+
+	for i := 1; i <= 100; i++ {
+		db.Put(utils.NewKey(i), utils.NewRandomValue(64))
+	}
+	for i := 51; i <= 100; i++ {
+		db.Delete(utils.NewKey(i))
+	}
+	db.Put([]byte("114"), []byte("514"))
+
+	// Relaunch the DB engine, the index is rebuilt from data files
+	db.Close()
+	db, _ = Launch(opts)
+	assert.Equal(t, 51, int(statOf(t, db).KeyNumber))
+	val, err := db.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.Equal(t, "514", string(val))
+	_, err = db.Get(utils.NewKey(100))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	keys, err := db.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 51, len(keys))
+	for i := 1; i <= 50; i++ {
+		assert.Equal(t, utils.NewKey(i), keys[i])
+	}
+}
+
+func TestDB_FingerprintIndexWithRotation(t *testing.T) {
+	opts := testingDBOptions
+	opts.IndexType = index.Fingerprint
+	opts.MaxDataFileSize = 16 * 1024
+	opts.MergenceThreshold = 0
+	db, _ := Launch(opts)
+	defer destroyDB(db)
+
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(512)))
+	}
+
+	// Keys are read from data files while writes rotate the active data file
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(512)))
+		}
+	}()
+	assert.Nil(t, db.Merge())
+	for i := 0; i < 5; i++ {
+		keys, err := db.ListKeys()
+		assert.Nil(t, err)
+		assert.Equal(t, 200, len(keys))
+		iter := db.NewItrerator(index.DefaultIteratorOptions)
+		assert.Nil(t, iter.Err())
+		iter.Close()
+	}
+	wg.Wait()
+}
+
+// sharedFingerprintIndex simulates an index whose keys all share a fingerprint with a given key, which is not confirmed
+type sharedFingerprintIndex struct {
+	index.Index
+	key []byte
+}
+
+func (idx *sharedFingerprintIndex) GetUnconfirmed([]byte) (*data.LogRecordPosition, bool, error) {
+	lrp, err := idx.Index.Get(idx.key)
+	return lrp, lrp == nil, err
+}
+
+// undeletableIndex simulates an index which fails to delete keys without an error
+type undeletableIndex struct {
+	index.Index
+}
+
+func (idx *undeletableIndex) Delete([]byte) (*data.LogRecordPosition, bool, error) {
+	return nil, false, nil
+}
+
+func TestDB_IndexUpdateFailed(t *testing.T) {
+	db, _ := Launch(testingDBOptions)
+	defer destroyDB(db)
+
+	assert.Nil(t, db.Put([]byte("114"), []byte("514")))
+	db.index = &undeletableIndex{Index: db.index}
+	assert.Equal(t, ErrIndexUpdateFailed, db.Delete([]byte("114")))
+	assert.Nil(t, db.Delete([]byte("1919810")))
+}
+
+func TestDB_UnconfirmedLookup(t *testing.T) {
+	db, _ := Launch(testingDBOptions)
+	defer destroyDB(db)
+
+	assert.Nil(t, db.Put([]byte("114"), []byte("514")))
+	db.index = &sharedFingerprintIndex{Index: db.index, key: []byte("114")}
+
+	// The key is confirmed by the log record which is read for the value
+	val, err := db.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.Equal(t, "514", string(val))
+	val, _, err = db.GetWithMeta([]byte("114"))
+	assert.Nil(t, err)
+	assert.Equal(t, "514", string(val))
+
+	// Another key sharing the fingerprint does not exist
+	_, err = db.Get([]byte("1919"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, _, err = db.GetWithMeta([]byte("1919"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_ShardedIndex(t *testing.T) {
+	opts := testingDBOptions
+	opts.IndexType = index.ShardedBtree
+	db, _ := Launch(opts)
+	defer destroyDB(db)
+
+	// Write and read concurrently
+	wg := new(sync.WaitGroup)
+	workers, count := 4, 250
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				key := utils.NewKey(w*count + i)
+				assert.Nil(t, db.Put(key, utils.NewRandomValue(64)))
+				val, err := db.Get(key)
+				assert.Nil(t, err)
+				assert.NotNil(t, val)
+			}
+		}(w)
+	}
+	wg.Wait()
+	assert.Equal(t, workers*count, int(statOf(t, db).KeyNumber))
+
+	// Relaunch the DB engine and iterate keys in order
+	db.Close()
+	db, _ = Launch(opts)
+	keys, err := db.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, workers*count, len(keys))
+	for i, key := range keys {
+		assert.Equal(t, utils.NewKey(i), key)
+	}
+}
+
+func TestDB_ConcurrentWritesOfSameKeys(t *testing.T) {
+	opts := testingDBOptions
+	opts.IndexType = index.ShardedBtree
+	db, _ := Launch(opts)
+	defer destroyDB(db)
+
+	// Writers race on a few keys, and publish to the index after the lock of the DB engine is released
+	wg := new(sync.WaitGroup)
+	workers, count, keyNumber := 8, 500, 10
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				key := utils.NewKey((w + i) % keyNumber)
+				if i%5 == 4 {
+					assert.Nil(t, db.Delete(key))
+					continue
+				}
+				assert.Nil(t, db.Put(key, []byte(fmt.Sprintf("%d-%d", w, i))))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// The index keeps the latest log record of every key, which is the one kept by replaying data files
+	values := make(map[int][]byte, keyNumber)
+	for i := 0; i < keyNumber; i++ {
+		value, err := db.Get(utils.NewKey(i))
+		if err != nil {
+			assert.Equal(t, ErrKeyNotFound, err)
+		}
+		values[i] = value
+	}
+	db.Close()
+	db, _ = Launch(opts)
+	for i := 0; i < keyNumber; i++ {
+		value, err := db.Get(utils.NewKey(i))
+		if err != nil {
+			assert.Equal(t, ErrKeyNotFound, err)
+		}
+		assert.Equal(t, values[i], value)
+	}
+}
+
+func TestDB_DeleteAfterPendingPublish(t *testing.T) {
+	opts := testingDBOptions
+	opts.IndexType = index.ShardedBtree
+	db, _ := Launch(opts)
+	defer destroyDB(db)
+
+	key := utils.NewKey(1)
+	assert.Nil(t, db.Put(key, []byte("1")))
+
+	// A write is appended but published late, as if its writer was descheduled after releasing the lock
+	db.mu.Lock()
+	lrp, err := db.appendPut(key, []byte("2"))
+	assert.Nil(t, err)
+	db.publishes.Add(1)
+	db.mu.Unlock()
+
+	deleted := make(chan error)
+	go func() {
+		deleted <- db.Delete(key)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, db.publish(key, lrp, false))
+	db.publishes.Done()
+	assert.Nil(t, <-deleted)
+
+	// The key does not come back after the deletion, neither in the index nor by replaying data files
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	db.Close()
+	db, _ = Launch(opts)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_Checkpoint(t *testing.T) {
+	opts := testingDBOptions
+	opts.CheckpointAtClose = true
+	db, _ := Launch(opts)
+	defer destroyDB(db)
+
+	checkpointFilePath := filepath.Join(opts.Directory, data.CheckpointFileName)
+
+	// The DB engine has no data file
+	err := db.Checkpoint()
+	assert.Nil(t, err)
+	assert.NoFileExists(t, checkpointFilePath)
+
+	for i := 1; i <= 100; i++ {
+		db.Put(utils.NewKey(i), utils.NewRandomValue(64))
+	}
+	wb, _ := db.NewWriteBatch(DefaultWriteBatchOptions)
+	wb.Put([]byte("114"), []byte("514"))
+	wb.Commit()
+	err = db.Checkpoint()
+	assert.Nil(t, err)
+	assert.FileExists(t, checkpointFilePath)
+	reclaimSize := db.reclaimSize.Load()
+
+	// Data written after the checkpoint is replayed from data files
+	for i := 51; i <= 100; i++ {
+		db.Delete(utils.NewKey(i))
+	}
+	db.Put([]byte("1919"), []byte("810"))
+	assert.Greater(t, db.reclaimSize.Load(), reclaimSize)
+	reclaimSize = db.reclaimSize.Load()
+
+	opts.CheckpointAtClose = false
+	db.Close()
+	db, _ = Launch(opts)
+	assert.Equal(t, 52, int(statOf(t, db).KeyNumber))
+	assert.Equal(t, reclaimSize, db.reclaimSize.Load())
+	assert.Equal(t, 1, int(db.tranNo))
+	val, err := db.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.Equal(t, "514", string(val))
+	val, err = db.Get([]byte("1919"))
+	assert.Nil(t, err)
+	assert.Equal(t, "810", string(val))
+	_, err = db.Get(utils.NewKey(100))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// Make a checkpoint at close
+	db.Close()
+	opts.CheckpointAtClose = true
+	db, _ = Launch(opts)
+	db.Delete([]byte("1919"))
+	db.Close()
+	db, _ = Launch(opts)
+	assert.Equal(t, 51, int(statOf(t, db).KeyNumber))
+	_, err = db.Get([]byte("1919"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// A corrupted checkpoint makes the DB engine replay all data files
+	db.Close()
+	err = os.WriteFile(checkpointFilePath, []byte("114514"), 0644)
+	assert.Nil(t, err)
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 51, int(statOf(t, db).KeyNumber))
+	assert.Equal(t, 1, int(db.tranNo))
+	for i := 1; i <= 50; i++ {
+		_, err = db.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+	}
+
+	// The checkpoint is removed after a mergence since positions are changed
+	err = db.Merge()
+	assert.Nil(t, err)
+	opts.CheckpointAtClose = false
+	db.Close()
+	db, _ = Launch(opts)
+	assert.NoFileExists(t, checkpointFilePath)
+	assert.Equal(t, 51, int(statOf(t, db).KeyNumber))
+	val, err = db.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.Equal(t, "514", string(val))
+}
+
+func TestDB_PeriodicCheckpoint(t *testing.T) {
+	opts := testingDBOptions
+	opts.CheckpointInterval = 10 * time.Millisecond
+	db, _ := Launch(opts)
+	defer destroyDB(db)
+
+	db.Put([]byte("114"), []byte("514"))
+	checkpointFilePath := filepath.Join(opts.Directory, data.CheckpointFileName)
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(checkpointFilePath)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDB_WriteBatchWithPersistentIndex(t *testing.T) {
+	for _, indexType := range []index.IndexType{index.BPtree, index.Hash} {
+		opts := testingDBOptions
+		opts.IndexType = indexType
+		db, _ := Launch(opts)
+
+		for i := 1; i <= 3; i++ {
+			wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+			assert.Nil(t, err)
+			wb.Put(utils.NewKey(i), utils.NewRandomValue(8))
+			assert.Nil(t, wb.Commit())
+		}
+		assert.Equal(t, 3, int(db.tranNo))
+
+		// Simulate a crash, nothing but the index is closed
+		assert.Nil(t, db.index.Close())
+		assert.Nil(t, db.fileLock.Unlock())
+
+		db, err := Launch(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, int(db.tranNo))
+		wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+		assert.Nil(t, err)
+		wb.Put([]byte("114"), []byte("514"))
+		assert.Nil(t, wb.Commit())
+		assert.Equal(t, 4, int(db.tranNo))
+
+		db.Close()
+		db, _ = Launch(opts)
+		assert.Equal(t, 4, int(db.tranNo))
+		val, err := db.Get([]byte("114"))
+		assert.Nil(t, err)
+		assert.Equal(t, "514", string(val))
+		destroyDB(db)
+	}
+}
+
+func TestDB_PersistentIndexReplaysTail(t *testing.T) {
+	for _, indexType := range []index.IndexType{index.BPtree, index.Hash} {
+		opts := testingDBOptions
+		opts.IndexType = indexType
+		db, _ := Launch(opts)
+
+		for i := 1; i <= 10; i++ {
+			assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(8)))
+		}
+		assert.Nil(t, db.Sync())
+
+		// Simulate a crash between appending data and updating the index
+		appendWithoutIndex := func(key []byte, value []byte, lrt data.LogRecordType, tranNo uint64) {
+			_, err := db.appendLogRecord(&data.LogRecord{
+				Key:   data.EncodeKey(key, tranNo),
+				Value: value,
+				Type:  lrt,
+			}, true)
+			assert.Nil(t, err)
+		}
+		appendWithoutIndex(utils.NewKey(11), []byte("11"), data.NormalLogRecord, nonTranNo)
+		appendWithoutIndex(utils.NewKey(1), nil, data.DeletedLogRecord, nonTranNo)
+		// A committed transaction
+		appendWithoutIndex(utils.NewKey(12), []byte("12"), data.NormalLogRecord, 1)
+		appendWithoutIndex(utils.NewKey(2), nil, data.DeletedLogRecord, 1)
+		appendWithoutIndex(tranFinishedKey, nil, data.TransactionFinishedLogRecord, 1)
+		// A transaction which is not finished
+		appendWithoutIndex(utils.NewKey(13), []byte("13"), data.NormalLogRecord, 2)
+		assert.Nil(t, db.index.Close())
+		assert.Nil(t, db.fileLock.Unlock())
+
+		db, err := Launch(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, int(db.tranNo))
+		val, err := db.Get(utils.NewKey(11))
+		assert.Nil(t, err)
+		assert.Equal(t, "11", string(val))
+		val, err = db.Get(utils.NewKey(12))
+		assert.Nil(t, err)
+		assert.Equal(t, "12", string(val))
+		for _, i := range []int{1, 2, 13} {
+			_, err = db.Get(utils.NewKey(i))
+			assert.Equal(t, ErrKeyNotFound, err)
+		}
+		assert.Equal(t, 10, len(keysOf(t, db)))
+
+		// New data is appended after the replayed tail
+		assert.Nil(t, db.Put([]byte("114"), []byte("514")))
+		assert.Nil(t, db.Close())
+		db, err = Launch(opts)
+		assert.Nil(t, err)
+		val, err = db.Get([]byte("114"))
+		assert.Nil(t, err)
+		assert.Equal(t, "514", string(val))
+		val, err = db.Get(utils.NewKey(11))
+		assert.Nil(t, err)
+		assert.Equal(t, "11", string(val))
+		destroyDB(db)
+	}
+}
+
+func TestDB_Encryption(t *testing.T) {
+	// A B+ tree index stores keys in plain text
+	opts := testingDBOptions
+	opts.IndexType = index.BPtree
+	opts.KeyProvider = data.NewStaticKeyProvider(1, []byte("0123456789abcdef"))
+	_, err := Launch(opts)
+	assert.Equal(t, ErrEncryptionNotSupported, err)
+
+	containsPlaintext := func(directory string, plaintext []byte) bool {
+		entries, _ := os.ReadDir(directory)
+		for _, entry := range entries {
+			content, _ := os.ReadFile(filepath.Join(directory, entry.Name()))
+			if bytes.Contains(content, plaintext) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, indexType := range []index.IndexType{index.Btree, index.Hash} {
+		provider := data.NewStaticKeyProvider(1, []byte("0123456789abcdef"))
+		opts := testingDBOptions
+		opts.IndexType = indexType
+		opts.KeyProvider = provider
+		opts.CheckpointAtClose = true
+		db, err := Launch(opts)
+		assert.Nil(t, err)
+
+		for i := 1; i <= 100; i++ {
+			assert.Nil(t, db.Put([]byte(fmt.Sprintf("secret-key-%d", i)), []byte(fmt.Sprintf("secret-value-%d", i))))
+		}
+		assert.Nil(t, db.Close())
+		assert.False(t, containsPlaintext(opts.Directory, []byte("secret-key")))
+		assert.False(t, containsPlaintext(opts.Directory, []byte("secret-value")))
+
+		// Data can not be read without the key
+		if !index.IsPersistent(indexType) {
+			withoutKey := opts
+			withoutKey.KeyProvider = nil
+			withoutKey.CheckpointAtClose = false
+			_, err = Launch(withoutKey)
+			assert.Equal(t, data.ErrNoCipher, err)
+		}
+
+		// Rotate the key and merge to re-encrypt old data with the new key
+		provider.Rotate(2, []byte("fedcba9876543210"))
+		db, err = Launch(opts)
+		assert.Nil(t, err)
+		for i := 1; i <= 50; i++ {
+			assert.Nil(t, db.Delete([]byte(fmt.Sprintf("secret-key-%d", i))))
+		}
+		assert.Nil(t, db.Merge())
+		assert.Nil(t, db.Close())
+
+		// The old key is no longer needed
+		provider.Remove(1)
+		db, err = Launch(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, 50, len(keysOf(t, db)))
+		for i := 51; i <= 100; i++ {
+			val, err := db.Get([]byte(fmt.Sprintf("secret-key-%d", i)))
+			assert.Nil(t, err)
+			assert.Equal(t, fmt.Sprintf("secret-value-%d", i), string(val))
+		}
+		assert.False(t, containsPlaintext(opts.Directory, []byte("secret-value")))
+		destroyDB(db)
+	}
+}
+
+func TestDB_InMemoryIOHandler(t *testing.T) {
+	opts := testingDBOptions
+	opts.IOHandlerType = io_handler.InMemoryIOHandler
+	opts.IndexType = index.BPtree
+	_, err := Launch(opts)
+	assert.Equal(t, ErrPersistentIndexInMemory, err)
+
+	opts.IOHandlerType = 114
+	_, err = Launch(opts)
+	assert.Equal(t, ErrUnsupportedIOHandlerType, err)
+
+	opts = testingDBOptions
+	opts.IOHandlerType = io_handler.InMemoryIOHandler
+	opts.MaxDataFileSize = 64 * 1024
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	for i := 1; i <= 1000; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(128)))
+	}
+	assert.True(t, len(db.inactiveFiles) > 0)
+	for i := 1; i <= 1000; i++ {
+		_, err := db.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, ErrMergenceNotSupported, db.Merge())
+
+	// Nothing is written to the disk
+	entries, _ := os.ReadDir(opts.Directory)
+	for _, entry := range entries {
+		assert.NotEqual(t, data.DataFileNameSuffix, filepath.Ext(entry.Name()))
+	}
+}
+
+func TestDB_TornWriteRecovery(t *testing.T) {
+	var faultyIOHandler io_handler.IOHandlerType = 114
+	injector := io_handler.NewFaultInjector(io_handler.FileIOHandler)
+	assert.Nil(t, io_handler.Register(faultyIOHandler, injector.New))
+
+	opts := testingDBOptions
+	opts.IOHandlerType = faultyIOHandler
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+
+	for i := 1; i <= 10; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(64)))
+	}
+
+	// A torn write is discarded and the DB engine keeps working
+	fileName := filepath.Base(db.activeFile.Path())
+	injector.TearWriteAt(fileName, db.activeFile.WriteOffset+8)
+	err = db.Put([]byte("114"), utils.NewRandomValue(64))
+	assert.ErrorIs(t, err, io_handler.ErrTornWrite)
+	assert.ErrorAs(t, err, new(*IOError))
+	_, err = db.Get([]byte("114"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.Put([]byte("514"), []byte("1919810")))
+
+	injector.FailWriteAt(fileName, db.activeFile.WriteOffset)
+	err = db.Put([]byte("114"), utils.NewRandomValue(64))
+	assert.ErrorIs(t, err, io_handler.ErrInjectedFault)
+	assert.ErrorAs(t, err, new(*IOError))
+	assert.Nil(t, db.Close())
+
+	// Simulate a crash in the middle of writing a log record
+	elr, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   data.EncodeKey([]byte("114"), nonTranNo),
+		Value: utils.NewRandomValue(64),
+		Type:  data.NormalLogRecord,
+	})
+	file, err := os.OpenFile(filepath.Join(opts.Directory, fileName), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = file.Write(elr[:len(elr)/2])
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	// The torn log record is discarded at startup
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+	size, _ := db.activeFile.Size()
+	assert.Equal(t, db.activeFile.WriteOffset, size)
+	_, err = db.Get([]byte("114"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.Put([]byte("114"), []byte("514")))
+	assert.Nil(t, db.Close())
+
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	val, err := db.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.Equal(t, "514", string(val))
+	val, err = db.Get([]byte("514"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1919810", string(val))
+	assert.Equal(t, 12, len(keysOf(t, db)))
+}
+
+func TestDB_WritableMMap(t *testing.T) {
+	opts := testingDBOptions
+	opts.IOHandlerType = io_handler.WritableMemoryMappedIOHandler
+	opts.MaxDataFileSize = 4 * 1024 * 1024
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+
+	for i := 1; i <= 10000; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(512)))
+	}
+	assert.True(t, len(db.inactiveFiles) > 0)
+	for i := 1; i <= 10000; i++ {
+		_, err := db.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+	}
+
+	// Inactive data files are truncated once they are rotated out
+	for _, file := range db.inactiveFiles {
+		stat, _ := os.Stat(file.Path())
+		assert.Equal(t, file.WriteOffset, stat.Size())
+	}
+	assert.Nil(t, db.Sync())
+	writeOffset := db.activeFile.WriteOffset
+	activeFilePath := db.activeFile.Path()
+
+	// Simulate a crash, the preallocated space of the active data file is left
+	assert.Nil(t, db.fileLock.Unlock())
+	stat, _ := os.Stat(activeFilePath)
+	assert.Greater(t, stat.Size(), writeOffset)
+
+	opts.MMapAtStartup = true
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, writeOffset, db.activeFile.WriteOffset)
+	assert.Nil(t, db.Put([]byte("114"), []byte("514")))
+	assert.Nil(t, db.Close())
+
+	// The preallocated space is truncated after the DB engine is closed
+	stat, _ = os.Stat(activeFilePath)
+	assert.Equal(t, db.activeFile.WriteOffset, stat.Size())
+
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+	assert.Equal(t, 10001, len(keysOf(t, db)))
+	val, err := db.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.Equal(t, "514", string(val))
+}
+
+func TestDB_DirectIO(t *testing.T) {
+	opts := testingDBOptions
+	opts.IOHandlerType = io_handler.DirectIOHandler
+	opts.MaxDataFileSize = 64 * 1024
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+
+	values := make(map[string][]byte)
+	for i := 1; i <= 1000; i++ {
+		values[string(utils.NewKey(i))] = utils.NewRandomValue(100)
+		assert.Nil(t, db.Put(utils.NewKey(i), values[string(utils.NewKey(i))]))
+	}
+	assert.True(t, len(db.inactiveFiles) > 0)
+	assert.Nil(t, db.Close())
+
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+	for key, value := range values {
+		val, err := db.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, value, val)
+	}
+}
+
+func TestDB_MultiGet(t *testing.T) {
+	for _, indexType := range []index.IndexType{index.Btree, index.Fingerprint} {
+		opts := testingDBOptions
+		opts.IndexType = indexType
+		opts.MaxDataFileSize = 64 * 1024
+		db, _ := Launch(opts)
+
+		// Nothing is found in an empty DB engine
+		values, errs := db.MultiGet([][]byte{[]byte("114"), nil})
+		assert.Nil(t, values[0])
+		assert.Equal(t, ErrKeyNotFound, errs[0])
+		assert.Equal(t, ErrKeyIsEmpty, errs[1])
+
+		for i := 1; i <= 1000; i++ {
+			assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(100)))
+		}
+		for i := 1; i <= 1000; i += 10 {
+			assert.Nil(t, db.Delete(utils.NewKey(i)))
+		}
+		assert.True(t, len(db.inactiveFiles) > 0)
+
+		// Keys spread over data files in a random order, with duplicated, deleted and unknown keys
+		var keys [][]byte
+		for i := 1000; i >= 1; i -= 3 {
+			keys = append(keys, utils.NewKey(i))
+		}
+		keys = append(keys, utils.NewKey(500), []byte("unknown-key"), []byte(""))
+
+		values, errs = db.MultiGet(keys)
+		assert.Equal(t, len(keys), len(values))
+		assert.Equal(t, len(keys), len(errs))
+		for i, key := range keys {
+			val, err := db.Get(key)
+			assert.Equal(t, err, errs[i])
+			assert.Equal(t, val, values[i])
+		}
+		assert.Equal(t, ErrKeyNotFound, errs[len(keys)-2])
+		assert.Equal(t, ErrKeyIsEmpty, errs[len(keys)-1])
+		destroyDB(db)
+	}
+}
+
+func TestDB_Cache(t *testing.T) {
+	opts := testingDBOptions
+	opts.CacheSize = -1
+	_, err := Launch(opts)
+	assert.Equal(t, ErrInvalidCacheSize, err)
+
+	opts.CacheSize = 1024 * 1024
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	for i := 1; i <= 100; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), []byte(fmt.Sprintf("value-%d", i))))
+	}
+
+	// The first reads miss the cache and the second ones hit it
+	for round := 0; round < 2; round++ {
+		for i := 1; i <= 100; i++ {
+			val, err := db.Get(utils.NewKey(i))
+			assert.Nil(t, err)
+			assert.Equal(t, fmt.Sprintf("value-%d", i), string(val))
+		}
+	}
+	stat, err := db.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(100), stat.CacheHits)
+	assert.Equal(t, uint64(100), stat.CacheMisses)
+	assert.Positive(t, stat.CacheSize)
+
+	// Modifying a returned value does not affect the cache
+	val, _ := db.Get(utils.NewKey(1))
+	val[0] = 'V'
+	val, _ = db.Get(utils.NewKey(1))
+	assert.Equal(t, "value-1", string(val))
+
+	// A new value is stored at a new position
+	assert.Nil(t, db.Put(utils.NewKey(1), []byte("114514")))
+	val, _ = db.Get(utils.NewKey(1))
+	assert.Equal(t, "114514", string(val))
+
+	// MultiGet shares the cache
+	values, errs := db.MultiGet([][]byte{utils.NewKey(1), utils.NewKey(2)})
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.Equal(t, "114514", string(values[0]))
+	assert.Equal(t, "value-2", string(values[1]))
+	stat, err = db.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(104), stat.CacheHits)
+	assert.Equal(t, uint64(101), stat.CacheMisses)
+
+	// Merged data files reuse IDs of the data files they replace, but only at the next launch with an empty cache
+	for i := 1; i <= 50; i++ {
+		assert.Nil(t, db.Delete(utils.NewKey(i)))
+	}
+	assert.Nil(t, db.Merge())
+	val, _ = db.Get(utils.NewKey(60))
+	assert.Equal(t, "value-60", string(val))
+	assert.Nil(t, db.Close())
+
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	stat, err = db.Stat()
+	assert.Nil(t, err)
+	assert.Zero(t, stat.CacheSize)
+	for i := 51; i <= 100; i++ {
+		val, err := db.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("value-%d", i), string(val))
+	}
+}
+
+func TestDB_BloomFilter(t *testing.T) {
+	opts := testingDBOptions
+	opts.BloomFilterFalsePositiveRate = 1.5
+	_, err := Launch(opts)
+	assert.Equal(t, ErrInvalidBloomFilterFalsePositiveRate, err)
+
+	opts.IndexType = index.BPtree
+	opts.BloomFilterFalsePositiveRate = 0.01
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// The filter grows beyond its initial capacity
+	for i := 1; i <= 2000; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(8)))
+	}
+	for i := 1; i <= 2000; i++ {
+		_, err := db.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+	}
+
+	// Most absent keys are answered by the filter
+	falsePositives := 0
+	for i := 2001; i <= 3000; i++ {
+		if db.filter.MayContain(utils.NewKey(i)) {
+			falsePositives++
+		}
+		_, err := db.Get(utils.NewKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+		assert.Nil(t, db.Delete(utils.NewKey(i)))
+	}
+	assert.Less(t, falsePositives, 50)
+
+	// The filter is persisted at close
+	assert.Nil(t, db.Close())
+	_, err = os.Stat(filepath.Join(opts.Directory, data.BloomFilterFileName))
+	assert.Nil(t, err)
+
+	// Keys written after the persisted filter are added at the next launch
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	for i := 2001; i <= 2050; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), []byte("114514")))
+		assert.Nil(t, wb.Put(utils.NewKey(i+50), []byte("1919810")))
+	}
+	assert.Nil(t, wb.Commit())
+	assert.Nil(t, db.Sync())
+	assert.Nil(t, db.index.Close())
+	assert.Nil(t, db.fileLock.Unlock())
+
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	for i := 1; i <= 2100; i++ {
+		_, err := db.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+	}
+
+	// Mergence rebuilds the filter
+	for i := 1; i <= 1000; i++ {
+		assert.Nil(t, db.Delete(utils.NewKey(i)))
+	}
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	for i := 1; i <= 2100; i++ {
+		_, err := db.Get(utils.NewKey(i))
+		if i <= 1000 {
+			assert.Equal(t, ErrKeyNotFound, err)
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+
+	// A corrupted filter is rebuilt from the index
+	assert.Nil(t, db.Close())
+	err = os.WriteFile(filepath.Join(opts.Directory, data.BloomFilterFileName), []byte("114514"), 0644)
+	assert.Nil(t, err)
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	for i := 1001; i <= 2100; i++ {
+		_, err := db.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+	}
+}
+
+func TestDB_GetView(t *testing.T) {
+	ioHandlerTypes := []io_handler.IOHandlerType{
+		io_handler.FileIOHandler,
+		io_handler.WritableMemoryMappedIOHandler,
+		io_handler.InMemoryIOHandler,
+	}
+	for _, ioHandlerType := range ioHandlerTypes {
+		opts := testingDBOptions
+		opts.IOHandlerType = ioHandlerType
+		db, err := Launch(opts)
+		assert.Nil(t, err)
+
+		for i := 1; i <= 100; i++ {
+			assert.Nil(t, db.Put(utils.NewKey(i), []byte(fmt.Sprintf("value-%d", i))))
+		}
+		assert.Nil(t, db.Delete(utils.NewKey(100)))
+
+		err = db.GetView(utils.NewKey(1), func(value []byte) error {
+			assert.Equal(t, "value-1", string(value))
+			return nil
+		})
+		assert.Nil(t, err)
+
+		// Errors of the DB engine and of the function are returned
+		noop := func(value []byte) error {
+			return nil
+		}
+		assert.Equal(t, ErrKeyIsEmpty, db.GetView(nil, noop))
+		assert.Equal(t, ErrKeyNotFound, db.GetView(utils.NewKey(100), noop))
+		assert.Equal(t, ErrKeyNotFound, db.GetView(utils.NewKey(101), noop))
+		err = db.GetView(utils.NewKey(1), func(value []byte) error {
+			return io.ErrUnexpectedEOF
+		})
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+		// Values are copied to be kept after the calls
+		values := make(map[string]string)
+		err = db.FoldView(func(key, value []byte) bool {
+			values[string(key)] = string(value)
+			return true
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 99, len(values))
+		assert.Equal(t, "value-50", values[string(utils.NewKey(50))])
+
+		count := 0
+		err = db.FoldView(func(key, value []byte) bool {
+			count++
+			return count < 10
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 10, count)
+
+		destroyDB(db)
+	}
+}
+
+func TestDB_Streaming(t *testing.T) {
+	opts := testingDBOptions
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	value := utils.NewRandomValue(3 * 1024 * 1024)
+	assert.Nil(t, db.PutReader(utils.NewKey(1), bytes.NewReader(value), int64(len(value))))
+
+	r, err := db.GetReader(utils.NewKey(1))
+	assert.Nil(t, err)
+	read, err := io.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+	assert.Equal(t, value, read)
+
+	// A streamed value is read as a normal one
+	val, err := db.Get(utils.NewKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, value, val)
+
+	// A normal value is streamed as well
+	assert.Nil(t, db.Put(utils.NewKey(2), []byte("114514")))
+	r, err = db.GetReader(utils.NewKey(2))
+	assert.Nil(t, err)
+	read, _ = io.ReadAll(r)
+	assert.Equal(t, "114514", string(read))
+
+	// A reader which ends early writes nothing
+	err = db.PutReader(utils.NewKey(3), bytes.NewReader(value[:10]), 11)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	_, err = db.GetReader(utils.NewKey(3))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, ErrKeyIsEmpty, db.PutReader(nil, bytes.NewReader(nil), 0))
+
+	// A slow reader does not block other writes
+	pr, pw := io.Pipe()
+	streamed := make(chan error)
+	go func() {
+		streamed <- db.PutReader(utils.NewKey(4), pr, 6)
+	}()
+	_, err = pw.Write([]byte("191"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put(utils.NewKey(5), []byte("114514")))
+	_, err = pw.Write([]byte("981"))
+	assert.Nil(t, err)
+	assert.Nil(t, pw.Close())
+	assert.Nil(t, <-streamed)
+	val, err = db.Get(utils.NewKey(4))
+	assert.Nil(t, err)
+	assert.Equal(t, "191981", string(val))
+
+	// Streamed values survive restarts and deletions are respected
+	assert.Nil(t, db.Delete(utils.NewKey(2)))
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	r, err = db.GetReader(utils.NewKey(1))
+	assert.Nil(t, err)
+	read, _ = io.ReadAll(r)
+	assert.Equal(t, value, read)
+	_, err = db.GetReader(utils.NewKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.GetReader(nil)
+	assert.Equal(t, ErrKeyIsEmpty, err)
+
+	// A value whose header was not filled in before a crash is discarded at the next launch
+	offset := db.activeFile.WriteOffset
+	assert.Nil(t, db.activeFile.Write(make([]byte, 7)))
+	assert.Nil(t, db.activeFile.Write(value[:1024]))
+	assert.Nil(t, db.index.Close())
+	assert.Nil(t, db.fileLock.Unlock())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, offset, db.activeFile.WriteOffset)
+	assert.Nil(t, db.Put(utils.NewKey(3), []byte("1919810")))
+	val, err = db.Get(utils.NewKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, "1919810", string(val))
+	destroyDB(db)
+
+	// Streaming does not support encryption
+	opts.KeyProvider = data.NewStaticKeyProvider(1, bytes.Repeat([]byte{1}, 32))
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	err = db.PutReader(utils.NewKey(1), bytes.NewReader(value), int64(len(value)))
+	assert.Equal(t, ErrStreamingNotSupported, err)
+	assert.Nil(t, db.Put(utils.NewKey(1), []byte("114514")))
+	r, err = db.GetReader(utils.NewKey(1))
+	assert.Nil(t, err)
+	read, _ = io.ReadAll(r)
+	assert.Equal(t, "114514", string(read))
+}
+
+func TestDB_History(t *testing.T) {
+	opts := testingDBOptions
+	opts.HistoryVersions = -1
+	_, err := Launch(opts)
+	assert.Equal(t, ErrInvalidHistoryOptions, err)
+
+	// The history is disabled by default
+	opts.HistoryVersions = 0
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	_, err = db.GetAt(utils.NewKey(1), time.Now())
+	assert.Equal(t, ErrHistoryDisabled, err)
+	_, err = db.History(utils.NewKey(1))
+	assert.Equal(t, ErrHistoryDisabled, err)
+	destroyDB(db)
+
+	opts.HistoryVersions = 3
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	t0 := time.Now()
+	assert.Nil(t, db.Put(utils.NewKey(1), []byte("v1")))
+	t1 := time.Now()
+	assert.Nil(t, db.Put(utils.NewKey(1), []byte("v2")))
+	t2 := time.Now()
+	assert.Nil(t, db.Delete(utils.NewKey(1)))
+	t3 := time.Now()
+
+	_, err = db.GetAt(utils.NewKey(1), t0)
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := db.GetAt(utils.NewKey(1), t1)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(val))
+	val, err = db.GetAt(utils.NewKey(1), t2)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(val))
+	_, err = db.GetAt(utils.NewKey(1), t3)
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.GetAt(nil, t3)
+	assert.Equal(t, ErrKeyIsEmpty, err)
+
+	// Versions beyond the configured number are dropped
+	assert.Nil(t, db.Put(utils.NewKey(1), []byte("v4")))
+	_, err = db.GetAt(utils.NewKey(1), t1)
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err = db.GetAt(utils.NewKey(1), time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, "v4", string(val))
+
+	// Versions written by a batch share a timestamp
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, wb.Put(utils.NewKey(2), []byte("v1")))
+	assert.Nil(t, wb.Put(utils.NewKey(3), []byte("v1")))
+	assert.Nil(t, wb.Commit())
+	it2, err := db.History(utils.NewKey(2))
+	assert.Nil(t, err)
+	it3, err := db.History(utils.NewKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, it2.Timestamp(), it3.Timestamp())
+	it2.Close()
+	it3.Close()
+
+	checkHistory := func(db *DB) {
+		it, err := db.History(utils.NewKey(1))
+		assert.Nil(t, err)
+		defer it.Close()
+		var values []string
+		var last time.Time
+		for it.Rewind(); it.Valid(); it.Next() {
+			if !last.IsZero() {
+				assert.True(t, it.Timestamp().Before(last))
+			}
+			last = it.Timestamp()
+			if it.Deleted() {
+				_, err := it.Value()
+				assert.Equal(t, ErrKeyNotFound, err)
+				values = append(values, "")
+				continue
+			}
+			val, err := it.Value()
+			assert.Nil(t, err)
+			values = append(values, string(val))
+		}
+		assert.Equal(t, []string{"v4", "", "v2"}, values)
+	}
+	checkHistory(db)
+
+	// The history is rebuilt at the next launch
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	checkHistory(db)
+	val, err = db.GetAt(utils.NewKey(1), t2)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(val))
+	destroyDB(db)
+
+	// Mergence keeps retained versions and drops the others
+	opts.MaxDataFileSize = 4 * 1024
+	opts.MergenceThreshold = 0
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	values := make([][]byte, 20)
+	for i := range values {
+		values[i] = utils.NewRandomValue(1000)
+		assert.Nil(t, db.Put(utils.NewKey(1), values[i]))
+	}
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	opts.HistoryVersions = 100
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	it, err := db.History(utils.NewKey(1))
+	assert.Nil(t, err)
+	i := len(values) - 1
+	for it.Rewind(); it.Valid(); it.Next() {
+		val, err := it.Value()
+		assert.Nil(t, err)
+		assert.Equal(t, values[i], val)
+		i--
+	}
+	assert.Equal(t, len(values)-1-3, i)
+	it.Close()
+}
+
+func TestDB_Timestamps(t *testing.T) {
+	opts := testingDBOptions
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// Log records are not timestamped by default
+	assert.Nil(t, db.Put(utils.NewKey(0), []byte("114514")))
+	val, meta, err := db.GetWithMeta(utils.NewKey(0))
+	assert.Nil(t, err)
+	assert.Equal(t, "114514", string(val))
+	assert.True(t, meta.Timestamp.IsZero())
+	assert.True(t, meta.Size > 0)
+	_, _, err = db.GetWithMeta(utils.NewKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, _, err = db.GetWithMeta(nil)
+	assert.Equal(t, ErrKeyIsEmpty, err)
+	assert.Nil(t, db.Close())
+
+	opts.TimestampLogRecords = true
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	t0 := time.Now()
+	for i := 1; i <= 3; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(8)))
+	}
+	t1 := time.Now()
+	for i := 4; i <= 6; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(8)))
+	}
+	t2 := time.Now()
+
+	_, meta, err = db.GetWithMeta(utils.NewKey(2))
+	assert.Nil(t, err)
+	assert.False(t, meta.Timestamp.Before(t0))
+	assert.True(t, meta.Timestamp.Before(t1))
+
+	scan := func(options index.IteratorOptions) []int {
+		it := db.NewItrerator(options)
+		defer it.Close()
+		var keys []int
+		for it.Rewind(); it.Valid(); it.Next() {
+			meta, err := it.Meta()
+			assert.Nil(t, err)
+			if !options.ModifiedSince.IsZero() {
+				assert.False(t, meta.Timestamp.Before(options.ModifiedSince))
+			}
+			var i int
+			_, err = fmt.Sscanf(string(it.Key()), "baradb-key-%09d", &i)
+			assert.Nil(t, err)
+			keys = append(keys, i)
+		}
+		return keys
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6}, scan(index.DefaultIteratorOptions))
+	assert.Equal(t, []int{4, 5, 6}, scan(index.IteratorOptions{ModifiedSince: t1}))
+	assert.Equal(t, []int{3, 2, 1}, scan(index.IteratorOptions{ModifiedBefore: t1, Reverse: true}))
+	assert.Equal(t, []int{1, 2, 3}, scan(index.IteratorOptions{ModifiedSince: t0, ModifiedBefore: t1}))
+	assert.Equal(t, []int(nil), scan(index.IteratorOptions{ModifiedSince: t2}))
+	assert.Equal(t, []int{5}, scan(index.IteratorOptions{Prefix: utils.NewKey(5), ModifiedSince: t1}))
+
+	// Timestamps keep increasing after a restart
+	_, meta, err = db.GetWithMeta(utils.NewKey(6))
+	assert.Nil(t, err)
+	last := meta.Timestamp
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, last.UnixNano(), db.lastTimestamp)
+	assert.Nil(t, db.Put(utils.NewKey(7), utils.NewRandomValue(8)))
+	_, meta, err = db.GetWithMeta(utils.NewKey(7))
+	assert.Nil(t, err)
+	assert.True(t, meta.Timestamp.After(last))
+}
+
+func TestDB_ColumnFamily(t *testing.T) {
+	opts := testingDBOptions
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	_, err = db.CreateColumnFamily("", DefaultColumnFamilyOptions)
+	assert.Equal(t, ErrColumnFamilyNameIsEmpty, err)
+	_, err = db.CreateColumnFamily("users", ColumnFamilyOptions{IndexType: index.BPtree})
+	assert.Equal(t, ErrInvalidColumnFamilyOptions, err)
+	_, err = db.CreateColumnFamily("users", ColumnFamilyOptions{IndexType: index.Btree, TTL: -1})
+	assert.Equal(t, ErrInvalidColumnFamilyOptions, err)
+
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	_, err = db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Equal(t, ErrColumnFamilyExists, err)
+	sessions, err := db.CreateColumnFamily("sessions", ColumnFamilyOptions{IndexType: index.Btree, TTL: 200 * time.Millisecond})
+	assert.Nil(t, err)
+	counters, err := db.CreateColumnFamily("counters", ColumnFamilyOptions{IndexType: index.ShardedBtree, Compression: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"counters", "sessions", "users"}, db.ColumnFamilies())
+
+	// The same key lives in every column family independently
+	key := []byte("114514")
+	assert.Nil(t, db.Put(key, []byte("default")))
+	assert.Nil(t, users.Put(key, []byte("users")))
+	assert.Nil(t, sessions.Put(key, []byte("sessions")))
+	value := bytes.Repeat([]byte("1919810"), 1024)
+	assert.Nil(t, counters.Put(key, value))
+	checkValue := func(get func([]byte) ([]byte, error), expected []byte) {
+		val, err := get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, val)
+	}
+	checkValue(db.Get, []byte("default"))
+	checkValue(users.Get, []byte("users"))
+	checkValue(sessions.Get, []byte("sessions"))
+	checkValue(counters.Get, value)
+	assert.Equal(t, 1, int(statOf(t, db).KeyNumber))
+
+	// Values of a compressed column family take less space
+	lrp, err := counters.index.Get(key)
+	assert.Nil(t, err)
+	assert.Less(t, int(lrp.Size), len(value)/10)
+
+	// Deletion only affects one column family
+	assert.Nil(t, users.Delete(key))
+	_, err = users.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	checkValue(db.Get, []byte("default"))
+	stat, err := users.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, int(stat.KeyNumber))
+	assert.True(t, stat.ReclaimableSize > 0)
+	assert.Equal(t, ErrKeyIsEmpty, users.Put(nil, nil))
+	_, err = users.Get(nil)
+	assert.Equal(t, ErrKeyIsEmpty, err)
+
+	// A write batch is atomic across column families
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	for i := 1; i <= 10; i++ {
+		assert.Nil(t, wb.Put(utils.NewKey(i), []byte("default")))
+		assert.Nil(t, wb.PutCF(users, utils.NewKey(i), []byte("users")))
+		assert.Nil(t, wb.PutCF(counters, utils.NewKey(i), value))
+	}
+	assert.Nil(t, wb.DeleteCF(counters, key))
+	assert.Nil(t, wb.Commit())
+	keys, err := users.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(keys))
+	_, err = counters.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	count := 0
+	assert.Nil(t, counters.Fold(func(key, val []byte) bool {
+		assert.Equal(t, value, val)
+		count++
+		return true
+	}))
+	assert.Equal(t, 10, count)
+
+	// Values of a column family with TTL expire
+	time.Sleep(200 * time.Millisecond)
+	_, err = sessions.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	keys, err = sessions.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+	assert.Nil(t, sessions.Put(utils.NewKey(1), []byte("sessions")))
+
+	// Column families and their data survive restarts
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"counters", "sessions", "users"}, db.ColumnFamilies())
+	users, err = db.ColumnFamily("users")
+	assert.Nil(t, err)
+	counters, err = db.ColumnFamily("counters")
+	assert.Nil(t, err)
+	sessions, err = db.ColumnFamily("sessions")
+	assert.Nil(t, err)
+	assert.Equal(t, ColumnFamilyOptions{IndexType: index.Btree, TTL: 200 * time.Millisecond}, sessions.Options())
+	_, err = db.ColumnFamily("accounts")
+	assert.Equal(t, ErrColumnFamilyNotFound, err)
+	checkValue(db.Get, []byte("default"))
+	_, err = users.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	for i := 1; i <= 10; i++ {
+		val, err := counters.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, value, val)
+	}
+	val, err := sessions.Get(utils.NewKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, "sessions", string(val))
+	assert.Equal(t, 11, int(statOf(t, db).KeyNumber))
+
+	// A dropped column family is gone with its keys, and pending writes to it are not committed
+	wb, err = db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, wb.PutCF(users, key, []byte("users")))
+	assert.Nil(t, wb.Put(key, []byte("batch")))
+	assert.Nil(t, db.DropColumnFamily("users"))
+	assert.Equal(t, ErrColumnFamilyNotFound, db.DropColumnFamily("users"))
+	assert.Equal(t, ErrColumnFamilyNotFound, wb.Commit())
+	checkValue(db.Get, []byte("default"))
+	_, err = users.Get(utils.NewKey(1))
+	assert.Equal(t, ErrColumnFamilyNotFound, err)
+	assert.Equal(t, ErrColumnFamilyNotFound, users.Put(key, nil))
+	users, err = db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	keys, err = users.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+
+	// Mergence discards expired values and keys of dropped column families
+	time.Sleep(200 * time.Millisecond)
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	sessions, err = db.ColumnFamily("sessions")
+	assert.Nil(t, err)
+	stat, err = sessions.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, int(stat.KeyNumber))
+	users, err = db.ColumnFamily("users")
+	assert.Nil(t, err)
+	stat, err = users.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, int(stat.KeyNumber))
+	counters, err = db.ColumnFamily("counters")
+	assert.Nil(t, err)
+	stat, err = counters.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, 10, int(stat.KeyNumber))
+	val, err = counters.Get(utils.NewKey(10))
+	assert.Nil(t, err)
+	assert.Equal(t, value, val)
+	checkValue(db.Get, []byte("default"))
+}
+
+func TestDB_ColumnFamilyBackup(t *testing.T) {
+	opts := testingDBOptions
+	opts.TimestampLogRecords = true
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	counters, err := db.CreateColumnFamily("counters", ColumnFamilyOptions{IndexType: index.Btree, Compression: true})
+	assert.Nil(t, err)
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(64)))
+		assert.Nil(t, counters.Put(utils.NewKey(i), bytes.Repeat([]byte{byte(i)}, 1024)))
+		assert.Nil(t, users.Put(utils.NewKey(i), utils.NewRandomValue(64)))
+	}
+	for i := 0; i < 100; i += 2 {
+		assert.Nil(t, counters.Delete(utils.NewKey(i)))
+	}
+	lrp, err := counters.index.Get(utils.NewKey(1))
+	assert.Nil(t, err)
+	lr, err := db.getLogRecordByPosition(lrp)
+	assert.Nil(t, err)
+
+	dir := "/tmp/baradb-family-backup"
+	assert.Nil(t, counters.Backup(dir))
+	assert.Equal(t, ErrDatabaseIsUsed, counters.Backup(db.options.Directory))
+
+	opts.Directory = dir
+	backup, err := Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(backup)
+
+	// Only live records of the column family are written
+	assert.Equal(t, []string{"counters"}, backup.ColumnFamilies())
+	assert.Equal(t, 0, int(statOf(t, backup).KeyNumber))
+	bcf, err := backup.ColumnFamily("counters")
+	assert.Nil(t, err)
+	stat, err := bcf.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, 50, int(stat.KeyNumber))
+	assert.Equal(t, 0, int(stat.ReclaimableSize))
+	for i := 0; i < 100; i++ {
+		value, err := bcf.Get(utils.NewKey(i))
+		if i%2 == 0 {
+			assert.Equal(t, ErrKeyNotFound, err)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, bytes.Repeat([]byte{byte(i)}, 1024), value)
+	}
+
+	// Values stay compressed and write timestamps are kept
+	blrp, err := bcf.index.Get(utils.NewKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, lrp.Size, blrp.Size)
+	blr, err := backup.getLogRecordByPosition(blrp)
+	assert.Nil(t, err)
+	assert.True(t, blr.Compressed)
+	assert.Positive(t, blr.Timestamp)
+	assert.Equal(t, lr.Timestamp, blr.Timestamp)
+
+	assert.Nil(t, db.DropColumnFamily("counters"))
+	assert.Equal(t, ErrColumnFamilyNotFound, counters.Backup(dir))
+}
+
+func TestDB_AtomicUpdates(t *testing.T) {
+	opts := testingDBOptions
+	opts.CacheSize = 1024 * 1024
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// CompareAndSwap
+	swapped, err := db.CompareAndSwap(utils.NewKey(1), nil, []byte("114"))
+	assert.Nil(t, err)
+	assert.True(t, swapped)
+	swapped, err = db.CompareAndSwap(utils.NewKey(1), nil, []byte("514"))
+	assert.Nil(t, err)
+	assert.False(t, swapped)
+	swapped, err = db.CompareAndSwap(utils.NewKey(1), []byte("514"), []byte("1919"))
+	assert.Nil(t, err)
+	assert.False(t, swapped)
+	swapped, err = db.CompareAndSwap(utils.NewKey(1), []byte("114"), []byte{})
+	assert.Nil(t, err)
+	assert.True(t, swapped)
+	swapped, err = db.CompareAndSwap(utils.NewKey(1), nil, []byte("810"))
+	assert.Nil(t, err)
+	assert.False(t, swapped)
+	swapped, err = db.CompareAndSwap(utils.NewKey(1), []byte{}, []byte("810"))
+	assert.Nil(t, err)
+	assert.True(t, swapped)
+	val, err := db.Get(utils.NewKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, "810", string(val))
+	_, err = db.CompareAndSwap(nil, nil, nil)
+	assert.Equal(t, ErrKeyIsEmpty, err)
+
+	// Increment is atomic between concurrent callers
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := db.Increment(utils.NewKey(2), 2)
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	n, err := db.Increment(utils.NewKey(2), -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1999), n)
+	val, err = db.Get(utils.NewKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, "1999", string(val))
+	assert.Nil(t, db.Put(utils.NewKey(6), []byte("baradb")))
+	_, err = db.Increment(utils.NewKey(6), 1)
+	assert.Equal(t, ErrValueIsNotInteger, err)
+	assert.Nil(t, db.Put(utils.NewKey(3), []byte("9223372036854775807")))
+	_, err = db.Increment(utils.NewKey(3), 1)
+	assert.Equal(t, ErrIntegerOverflow, err)
+
+	// Append
+	assert.Nil(t, db.Append(utils.NewKey(4), []byte("114")))
+	assert.Nil(t, db.Append(utils.NewKey(4), []byte("514")))
+	val, err = db.Get(utils.NewKey(4))
+	assert.Nil(t, err)
+	assert.Equal(t, "114514", string(val))
+
+	// Merge functions
+	maximum := func(key, existing, operand []byte) ([]byte, error) {
+		if existing != nil && bytes.Compare(existing, operand) > 0 {
+			return existing, nil
+		}
+		return operand, nil
+	}
+	assert.Equal(t, ErrInvalidMergeFunc, db.RegisterMergeFunc("", maximum))
+	assert.Equal(t, ErrInvalidMergeFunc, db.RegisterMergeFunc("max", nil))
+	assert.Nil(t, db.RegisterMergeFunc("max", maximum))
+	assert.Equal(t, ErrMergeFuncExists, db.RegisterMergeFunc("max", maximum))
+	for _, operand := range []string{"3", "5", "4"} {
+		_, err := db.MergeWith(utils.NewKey(5), "max", []byte(operand))
+		assert.Nil(t, err)
+	}
+	val, err = db.Get(utils.NewKey(5))
+	assert.Nil(t, err)
+	assert.Equal(t, "5", string(val))
+	_, err = db.MergeWith(utils.NewKey(5), "min", []byte("1"))
+	assert.Equal(t, ErrMergeFuncNotFound, err)
+
+	// A failed merge function writes nothing
+	assert.Nil(t, db.RegisterMergeFunc("fail", func(key, existing, operand []byte) ([]byte, error) {
+		return nil, ErrValueIsNotInteger
+	}))
+	_, err = db.MergeWith(utils.NewKey(5), "fail", nil)
+	assert.Equal(t, ErrValueIsNotInteger, err)
+
+	// Results are ordinary log records which survive restarts
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	for key, expected := range map[int]string{1: "810", 2: "1999", 4: "114514", 5: "5"} {
+		val, err := db.Get(utils.NewKey(key))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(val))
+	}
+}
+
+func TestDB_MergeOperators(t *testing.T) {
+	opts := testingDBOptions
+	opts.CacheSize = 1024 * 1024
+	opts.MergeOperators = map[string]MergeFunc{
+		"join": func(key, existing, operand []byte) ([]byte, error) {
+			if existing == nil {
+				return operand, nil
+			}
+			return append(append(append([]byte{}, existing...), ','), operand...), nil
+		},
+	}
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	assert.Equal(t, ErrKeyIsEmpty, db.PutMergeOperand(nil, "join", nil))
+	assert.Equal(t, ErrMergeFuncNotFound, db.PutMergeOperand(utils.NewKey(1), "split", nil))
+
+	// Operands are merged into values when they are read
+	for _, operand := range []string{"114", "514", "1919"} {
+		assert.Nil(t, db.PutMergeOperand(utils.NewKey(1), "join", []byte(operand)))
+	}
+	assert.Nil(t, db.Put(utils.NewKey(2), []byte("810")))
+	assert.Nil(t, db.PutMergeOperand(utils.NewKey(2), "join", []byte("893")))
+	val, err := db.Get(utils.NewKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, "114,514,1919", string(val))
+	val, err = db.Get(utils.NewKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, "810,893", string(val))
+	values, errs := db.MultiGet([][]byte{utils.NewKey(1), utils.NewKey(2)})
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, "114,514,1919", string(values[0]))
+	assert.Equal(t, "810,893", string(values[1]))
+	err = db.GetView(utils.NewKey(2), func(value []byte) error {
+		assert.Equal(t, "810,893", string(value))
+		return nil
+	})
+	assert.Nil(t, err)
+	reader, err := db.GetReader(utils.NewKey(1))
+	assert.Nil(t, err)
+	val, err = io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "114,514,1919", string(val))
+	assert.Nil(t, reader.Close())
+	val, meta, err := db.GetWithMeta(utils.NewKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, "114,514,1919", string(val))
+	assert.NotNil(t, meta)
+	folded := make(map[string]string)
+	err = db.Fold(func(key, value []byte) bool {
+		folded[string(key)] = string(value)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "114,514,1919", folded[string(utils.NewKey(1))])
+	assert.Equal(t, "810,893", folded[string(utils.NewKey(2))])
+
+	// Writes and deletions reset operands
+	assert.Nil(t, db.Put(utils.NewKey(2), []byte("364")))
+	assert.Nil(t, db.PutMergeOperand(utils.NewKey(2), "join", []byte("364")))
+	val, err = db.Get(utils.NewKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, "364,364", string(val))
+	assert.Nil(t, db.Delete(utils.NewKey(2)))
+	assert.Nil(t, db.PutMergeOperand(utils.NewKey(2), "join", []byte("931")))
+	val, err = db.Get(utils.NewKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, "931", string(val))
+	assert.Positive(t, statOf(t, db).ReclaimableSize)
+
+	// Operands are resolved after restarts
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	val, err = db.Get(utils.NewKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, "114,514,1919", string(val))
+	val, err = db.Get(utils.NewKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, "931", string(val))
+	destroyDB(db)
+
+	// Mergence collapses operands in merged data files into values
+	opts.MaxDataFileSize = 4 * 1024
+	opts.MergenceThreshold = 0
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	expected := "base"
+	assert.Nil(t, db.Put(utils.NewKey(1), []byte(expected)))
+	assert.Nil(t, db.Put(utils.NewKey(2), []byte("base")))
+	for i := 0; i < 20; i++ {
+		operand := utils.NewRandomValue(300)
+		expected += "," + string(operand)
+		assert.Nil(t, db.PutMergeOperand(utils.NewKey(1), "join", operand))
+	}
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.PutMergeOperand(utils.NewKey(1), "join", []byte("tail")))
+	assert.Nil(t, db.PutMergeOperand(utils.NewKey(2), "join", []byte("tail")))
+	assert.Nil(t, db.Close())
+
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	val, err = db.Get(utils.NewKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, expected+",tail", string(val))
+	val, err = db.Get(utils.NewKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, "base,tail", string(val))
+	chain := db.operands[string(utils.NewKey(1))]
+	assert.Len(t, chain.operands, 1)
+	lr, err := db.getDataFile(chain.base.FileID).ReadLogRecordAt(chain.base)
+	assert.Nil(t, err)
+	assert.Equal(t, data.NormalLogRecord, lr.Type)
+}
+
+func TestDB_MergeOperandHistory(t *testing.T) {
+	opts := testingDBOptions
+	opts.HistoryVersions = 10
+	opts.MergeOperators = map[string]MergeFunc{
+		"join": func(key, existing, operand []byte) ([]byte, error) {
+			if existing == nil {
+				return operand, nil
+			}
+			return append(append(append([]byte{}, existing...), ','), operand...), nil
+		},
+	}
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	// Versions of merge operands are resolved after a later write drops their chain
+	assert.Nil(t, db.Put(utils.NewKey(1), []byte("114")))
+	assert.Nil(t, db.PutMergeOperand(utils.NewKey(1), "join", []byte("514")))
+	t1 := time.Now()
+	assert.Nil(t, db.PutMergeOperand(utils.NewKey(1), "join", []byte("1919")))
+	t2 := time.Now()
+	assert.Nil(t, db.Put(utils.NewKey(1), []byte("810")))
+	assert.Nil(t, db.PutMergeOperand(utils.NewKey(1), "join", []byte("893")))
+	check := func() {
+		val, err := db.GetAt(utils.NewKey(1), t1)
+		assert.Nil(t, err)
+		assert.Equal(t, "114,514", string(val))
+		val, err = db.GetAt(utils.NewKey(1), t2)
+		assert.Nil(t, err)
+		assert.Equal(t, "114,514,1919", string(val))
+		val, err = db.Get(utils.NewKey(1))
+		assert.Nil(t, err)
+		assert.Equal(t, "810,893", string(val))
+
+		it, err := db.History(utils.NewKey(1))
+		assert.Nil(t, err)
+		var values []string
+		for it.Rewind(); it.Valid(); it.Next() {
+			val, err := it.Value()
+			assert.Nil(t, err)
+			values = append(values, string(val))
+		}
+		it.Close()
+		assert.Equal(t, []string{"810,893", "810", "114,514,1919", "114,514", "114"}, values)
+	}
+	check()
+
+	// Chains are rebuilt with the history after a relaunch
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	check()
+
+	// The mergence keeps chains which retained versions are resolved with
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	check()
+}
+
+func TestDB_DeleteRange(t *testing.T) {
+	opts := testingDBOptions
+	opts.MaxDataFileSize = 4 * 1024
+	opts.MergenceThreshold = 0
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	tenantKey := func(tenant byte, i int) []byte {
+		return []byte(fmt.Sprintf("tenant-%c/%d", tenant, i))
+	}
+	for _, tenant := range []byte("abc") {
+		for i := 0; i < 10; i++ {
+			assert.Nil(t, db.Put(tenantKey(tenant, i), utils.NewRandomValue(1000)))
+		}
+	}
+
+	assert.Equal(t, ErrKeyIsEmpty, db.DeleteRange(nil, []byte("tenant-b/")))
+	assert.Equal(t, ErrKeyIsEmpty, db.DeletePrefix(nil))
+	assert.Equal(t, ErrInvalidKeyRange, db.DeleteRange([]byte("tenant-b/"), []byte("tenant-a/")))
+	assert.Nil(t, db.DeleteRange([]byte("tenant-d/"), []byte("tenant-e/")))
+
+	// Deleted keys are invisible to reads and iterators at once
+	assert.Nil(t, db.DeletePrefix([]byte("tenant-a/")))
+	_, err = db.Get(tenantKey('a', 1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.DeleteRange(tenantKey('b', 3), tenantKey('b', 6)))
+	_, err = db.Get(tenantKey('b', 5))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.Get(tenantKey('b', 6))
+	assert.Nil(t, err)
+	it := db.NewItrerator(index.IteratorOptions{Prefix: []byte("tenant-b/")})
+	n := 0
+	for it.Rewind(); it.Valid(); it.Next() {
+		n++
+	}
+	it.Close()
+	assert.Equal(t, 7, n)
+	assert.Nil(t, db.Put(tenantKey('a', 1), []byte("114514")))
+	assert.Equal(t, 18, int(statOf(t, db).KeyNumber))
+	assert.Positive(t, statOf(t, db).ReclaimableSize)
+
+	// Range tombstones survive restarts
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 18, int(statOf(t, db).KeyNumber))
+	val, err := db.Get(tenantKey('a', 1))
+	assert.Nil(t, err)
+	assert.Equal(t, "114514", string(val))
+	_, err = db.Get(tenantKey('a', 2))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// Mergence drops deleted log records
+	diskSize := statOf(t, db).DiskSize
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	assert.Less(t, statOf(t, db).DiskSize, diskSize)
+	assert.Equal(t, 18, int(statOf(t, db).KeyNumber))
+	_, err = db.Get(tenantKey('b', 4))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// The range is unbounded without an end key
+	assert.Nil(t, db.DeleteRange([]byte("tenant-c/"), nil))
+	assert.Equal(t, 8, int(statOf(t, db).KeyNumber))
+	destroyDB(db)
+
+	// Keys of an unordered index are deleted as well
+	opts.IndexType = index.Hash
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put(tenantKey('a', i), []byte("1919")))
+		assert.Nil(t, db.Put(tenantKey('b', i), []byte("810")))
+	}
+	assert.Nil(t, db.DeletePrefix([]byte("tenant-a/")))
+	assert.Equal(t, 10, int(statOf(t, db).KeyNumber))
+	_, err = db.Get(tenantKey('a', 1))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_Context(t *testing.T) {
+	opts := testingDBOptions
+	opts.MaxDataFileSize = 4 * 1024
+	opts.MergenceThreshold = 0
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+
+	assert.Nil(t, db.PutContext(ctx, utils.NewKey(1), []byte("114514")))
+	assert.Equal(t, context.Canceled, db.PutContext(cancelled, utils.NewKey(2), []byte("1919")))
+	assert.Equal(t, ErrKeyIsEmpty, db.PutContext(ctx, nil, nil))
+	val, err := db.GetContext(ctx, utils.NewKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, "114514", string(val))
+	_, err = db.GetContext(cancelled, utils.NewKey(1))
+	assert.Equal(t, context.Canceled, err)
+	_, err = db.Get(utils.NewKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	for i := 2; i <= 20; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(1000)))
+	}
+
+	// Folding stops between keys once the context is done
+	n := 0
+	err = db.FoldContext(ctx, func(key, value []byte) bool {
+		n++
+		if n == 5 {
+			cancel()
+		}
+		return true
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 5, n)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	n = 0
+	assert.Nil(t, db.FoldContext(ctx, func(key, value []byte) bool {
+		n++
+		return true
+	}))
+	assert.Equal(t, 20, n)
+
+	// Iterators become invalid once the context is done
+	_, err = db.NewIteratorContext(cancelled, index.DefaultIteratorOptions)
+	assert.Equal(t, context.Canceled, err)
+	iterCtx, iterCancel := context.WithCancel(context.Background())
+	defer iterCancel()
+	it, err := db.NewIteratorContext(iterCtx, index.DefaultIteratorOptions)
+	assert.Nil(t, err)
+	n = 0
+	for it.Rewind(); it.Valid(); it.Next() {
+		n++
+		if n == 3 {
+			iterCancel()
+		}
+	}
+	assert.Equal(t, 3, n)
+	assert.Equal(t, context.Canceled, it.Err())
+	_, err = it.Value()
+	assert.Equal(t, context.Canceled, err)
+	it.Close()
+
+	// A stopped mergence changes nothing
+	assert.Equal(t, context.Canceled, db.MergeContext(cancelled))
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, int(statOf(t, db).KeyNumber))
+	assert.Nil(t, db.MergeContext(ctx))
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, int(statOf(t, db).KeyNumber))
+
+	// Backup
+	backupDir := filepath.Join(os.TempDir(), "baradb-context-backup")
+	defer os.RemoveAll(backupDir)
+	assert.Equal(t, context.Canceled, db.BackupContext(cancelled, backupDir))
+	assert.Nil(t, db.BackupContext(ctx, backupDir))
+	_, err = os.Stat(backupDir)
+	assert.Nil(t, err)
+}
+
+func TestDB_Errors(t *testing.T) {
+	var faultyIOHandler io_handler.IOHandlerType = 115
+	injector := io_handler.NewFaultInjector(io_handler.FileIOHandler)
+	assert.Nil(t, io_handler.Register(faultyIOHandler, injector.New))
+
+	opts := testingDBOptions
+	opts.IOHandlerType = faultyIOHandler
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	for i := 1; i <= 10; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), []byte("114514")))
+	}
+
+	// A failed write is an I/O error, which is not a corruption
+	fileName := filepath.Base(db.activeFile.Path())
+	injector.FailWriteAt(fileName, db.activeFile.WriteOffset)
+	err = db.Put(utils.NewKey(11), []byte("1919810"))
+	var ioError *IOError
+	assert.ErrorAs(t, err, &ioError)
+	assert.ErrorIs(t, err, io_handler.ErrInjectedFault)
+	assert.False(t, errors.As(err, new(*CorruptionError)))
+	assert.Nil(t, db.Put(utils.NewKey(11), []byte("1919810")))
+
+	// A value which is modified on the disk is a corruption
+	lrp, err := db.index.Get(utils.NewKey(5))
+	assert.Nil(t, err)
+	file, err := os.OpenFile(filepath.Join(opts.Directory, fileName), os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = file.WriteAt([]byte("X"), lrp.Offset+int64(lrp.Size)-1)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+	_, err = db.Get(utils.NewKey(5))
+	var corruptionError *CorruptionError
+	assert.ErrorAs(t, err, &corruptionError)
+	assert.ErrorIs(t, err, data.ErrInvalidCRC)
+	assert.False(t, errors.As(err, &ioError))
+
+	// Other errors are returned as they are
+	_, err = db.Get(utils.NewKey(12))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, ErrKeyIsEmpty, db.Delete(nil))
+
+	// Stat and Close report errors instead of panicking
+	_, err = db.Stat()
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+	assert.Nil(t, os.RemoveAll(opts.Directory))
+	_, err = db.Stat()
+	assert.ErrorAs(t, err, &ioError)
+}
+
+func TestDB_Metrics(t *testing.T) {
+	var mu sync.Mutex
+	traced := make(map[metrics.Operation]int)
+	failed := make(map[metrics.Operation]int)
+
+	opts := testingDBOptions
+	opts.MaxDataFileSize = 4 * 1024
+	opts.MergenceThreshold = 0
+	opts.CacheSize = 1024 * 1024
+	opts.Tracer = metrics.TracerFunc(func(ctx context.Context, operation metrics.Operation) func(err error) {
+		return func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			traced[operation]++
+			if err != nil {
+				failed[operation]++
+			}
+		}
+	})
+	db, err := Launch(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// value finds a sample of the metrics of the DB engine by its name and the operation label if any
+	value := func(name string, operation metrics.Operation) (float64, *metrics.HistogramSnapshot) {
+		for _, m := range db.Metrics() {
+			if m.Name != name {
+				continue
+			}
+			if operation != "" && (len(m.Labels) == 0 || m.Labels[0].Value != string(operation)) {
+				continue
+			}
+			return m.Value, m.Histogram
+		}
+		t.Fatalf("metric %s not found", name)
+		return 0, nil
+	}
+
+	for i := 1; i <= 20; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(1000)))
+	}
+	for i := 1; i <= 10; i++ {
+		_, err := db.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+	}
+	_, err = db.Get([]byte("114514"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.Get(nil)
+	assert.Equal(t, ErrKeyIsEmpty, err)
+	assert.Nil(t, db.Delete(utils.NewKey(1)))
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, wb.Put(utils.NewKey(21), []byte("1919810")))
+	assert.Nil(t, wb.Commit())
+	assert.Nil(t, db.Sync())
+
+	n, _ := value("baradb_operations_total", metrics.OperationPut)
+	assert.Equal(t, 20, int(n))
+	n, _ = value("baradb_operations_total", metrics.OperationGet)
+	assert.Equal(t, 12, int(n))
+	n, _ = value("baradb_operation_errors_total", metrics.OperationGet)
+	assert.Equal(t, 1, int(n))
+	n, _ = value("baradb_operations_total", metrics.OperationDelete)
+	assert.Equal(t, 1, int(n))
+	n, _ = value("baradb_operations_total", metrics.OperationCommit)
+	assert.Equal(t, 1, int(n))
+	// Syncs by rotation and by the write batch are measured as well as the one of Sync
+	n, _ = value("baradb_operations_total", metrics.OperationSync)
+	rotations, _ := value("baradb_file_rotations_total", "")
+	assert.Equal(t, int(rotations)+2, int(n))
+	_, h := value("baradb_operation_duration_seconds", metrics.OperationPut)
+	assert.Equal(t, uint64(20), h.Count)
+	assert.Positive(t, h.Sum)
+	n, _ = value("baradb_keys", "")
+	assert.Equal(t, 20, int(n))
+	n, _ = value("baradb_file_rotations_total", "")
+	assert.Positive(t, n)
+	n, _ = value("baradb_data_files", "")
+	assert.Equal(t, int(statOf(t, db).DataFileNumber), int(n))
+	n, _ = value("baradb_cache_misses_total", "")
+	assert.Positive(t, n)
+
+	// The tracer sees every operation and its error, including a key which is not found
+	mu.Lock()
+	assert.Equal(t, 20, traced[metrics.OperationPut])
+	assert.Equal(t, 12, traced[metrics.OperationGet])
+	assert.Equal(t, 2, failed[metrics.OperationGet])
+	assert.Equal(t, 1, traced[metrics.OperationCommit])
+	mu.Unlock()
+
+	// Mergence reclaims overwritten values
+	for i := 2; i <= 10; i++ {
+		assert.Nil(t, db.Put(utils.NewKey(i), utils.NewRandomValue(1000)))
+	}
+	assert.Nil(t, db.Merge())
+	n, _ = value("baradb_operations_total", metrics.OperationMerge)
+	assert.Equal(t, 1, int(n))
+	n, _ = value("baradb_merge_reclaimed_bytes_total", "")
+	assert.Greater(t, n, float64(9*1000))
+
+	// Metrics are exported in the Prometheus text format
+	var buffer bytes.Buffer
+	assert.Nil(t, metrics.WritePrometheus(&buffer, db.Metrics()))
+	assert.Contains(t, buffer.String(), "# TYPE baradb_operation_duration_seconds histogram\n")
+	assert.Contains(t, buffer.String(), `baradb_operations_total{operation="put"} 29`)
+	assert.Contains(t, buffer.String(), `baradb_operation_duration_seconds_count{operation="merge"} 1`)
+
+	// Other reads and writes are measured as their operations
+	count := func(operation metrics.Operation) int {
+		n, _ := value("baradb_operations_total", operation)
+		return int(n)
+	}
+	gets, puts, deletes := count(metrics.OperationGet), count(metrics.OperationPut), count(metrics.OperationDelete)
+	_, errs := db.MultiGet([][]byte{utils.NewKey(2), utils.NewKey(3)})
+	assert.Equal(t, []error{nil, nil}, errs)
+	_, _, err = db.GetWithMeta(utils.NewKey(2))
+	assert.Nil(t, err)
+	assert.Nil(t, db.GetView(utils.NewKey(2), func(value []byte) error { return nil }))
+	_, err = db.Increment([]byte("visits"), 1)
+	assert.Nil(t, err)
+	_, err = db.Increment(utils.NewKey(2), 1)
+	assert.Equal(t, ErrValueIsNotInteger, err)
+	assert.Nil(t, db.DeletePrefix([]byte("visits")))
+	users, err := db.CreateColumnFamily("users", DefaultColumnFamilyOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, users.Put([]byte("114514"), []byte("1919810")))
+	_, err = users.Get([]byte("114514"))
+	assert.Nil(t, err)
+	assert.Nil(t, users.Delete([]byte("114514")))
+	assert.Equal(t, gets+4, count(metrics.OperationGet))
+	assert.Equal(t, puts+3, count(metrics.OperationPut))
+	assert.Equal(t, deletes+2, count(metrics.OperationDelete))
+	n, _ = value("baradb_operation_errors_total", metrics.OperationPut)
+	assert.Equal(t, 1, int(n))
+
+	assert.Nil(t, db.Close())
+	db, err = Launch(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, int(statOf(t, db).KeyNumber))
+}
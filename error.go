@@ -1,19 +1,131 @@
 package baradb
 
-import "errors"
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"syscall"
+
+	"github.com/saint-yellow/baradb/bloom"
+	"github.com/saint-yellow/baradb/data"
+	"github.com/saint-yellow/baradb/index"
+	"github.com/saint-yellow/baradb/io_handler"
+)
 
 // User-defined errors
 var (
-	ErrKeyIsEmpty                = errors.New("the key is empty")
-	ErrIndexUpdateFailed         = errors.New("failed to update index")
-	ErrFileNotFound              = errors.New("file not found")
-	ErrKeyNotFound               = errors.New("key not found")
-	ErrDirectoryIsEmpty          = errors.New("data path is empty")
-	ErrMaxDataFileSizeIsNegative = errors.New("the maximum size of data file is negative")
-	ErrDirectoryCorrupted        = errors.New("maybe the directory of the DB is corrupted")
-	ErrExceedMaxBatchNumber      = errors.New("exceed the maximum batch number")
-	ErrMergenceIsInProgress      = errors.New("mergence is in progress, try again later")
-	ErrDatabaseIsUsed            = errors.New("the database is used by other process")
-	ErrInvalidMergenceThreshold  = errors.New("invalid mergence threshold")
-	ErrNoMoreDiskSpace           = errors.New("no more disk space to store data")
+	ErrKeyIsEmpty                          = errors.New("the key is empty")
+	ErrIndexUpdateFailed                   = errors.New("failed to update index")
+	ErrFileNotFound                        = errors.New("file not found")
+	ErrKeyNotFound                         = errors.New("key not found")
+	ErrDirectoryIsEmpty                    = errors.New("data path is empty")
+	ErrMaxDataFileSizeIsNegative           = errors.New("the maximum size of data file is negative")
+	ErrDirectoryCorrupted                  = errors.New("maybe the directory of the DB is corrupted")
+	ErrExceedMaxBatchNumber                = errors.New("exceed the maximum batch number")
+	ErrInvalidMaxBatchNumber               = errors.New("the maximum batch number should be greater than 0")
+	ErrMergenceIsInProgress                = errors.New("mergence is in progress, try again later")
+	ErrDatabaseIsUsed                      = errors.New("the database is used by other process")
+	ErrInvalidMergenceThreshold            = errors.New("invalid mergence threshold")
+	ErrNoMoreDiskSpace                     = errors.New("no more disk space to store data")
+	ErrCheckpointCorrupted                 = errors.New("the index checkpoint is corrupted")
+	ErrInvalidCheckpointInterval           = errors.New("invalid checkpoint interval")
+	ErrEncryptionNotSupported              = errors.New("the index type does not support encryption")
+	ErrUnsupportedIOHandlerType            = errors.New("the I/O handler type is not registered")
+	ErrPersistentIndexInMemory             = errors.New("a persistent index can not be used with in-memory data files")
+	ErrMergenceNotSupported                = errors.New("mergence is not supported by in-memory data files")
+	ErrInvalidCacheSize                    = errors.New("the size of the cache should not be negative")
+	ErrInvalidBloomFilterFalsePositiveRate = errors.New("invalid false-positive rate of the Bloom filter")
+	ErrStreamingNotSupported               = data.ErrStreamingNotSupported
+	ErrInvalidHistoryOptions               = errors.New("the number and the retention of versions should not be negative")
+	ErrHistoryDisabled                     = errors.New("the history of keys is disabled")
+	ErrColumnFamilyNameIsEmpty             = errors.New("the name of the column family is empty")
+	ErrColumnFamilyExists                  = errors.New("the column family already exists")
+	ErrColumnFamilyNotFound                = errors.New("column family not found")
+	ErrInvalidColumnFamilyOptions          = errors.New("invalid options of the column family")
+	ErrColumnFamiliesCorrupted             = errors.New("the file of column families is corrupted")
+	ErrValueIsNotInteger                   = errors.New("the value is not an integer")
+	ErrIntegerOverflow                     = errors.New("the integer overflows")
+	ErrInvalidMergeFunc                    = errors.New("the name of the merge function is empty or the function is nil")
+	ErrMergeFuncExists                     = errors.New("the merge function already exists")
+	ErrMergeFuncNotFound                   = errors.New("merge function not found")
+	ErrMergeOperandUnresolved              = errors.New("the merge operand can not be resolved")
+	ErrInvalidKeyRange                     = errors.New("the start key of the range should be less than the end key")
 )
+
+// IOError reports a failure of I/O, which may be transient, so the operation may succeed if it is retried
+type IOError struct {
+	Err error // The underlying error
+}
+
+func (e *IOError) Error() string {
+	return "I/O failed: " + e.Err.Error()
+}
+
+func (e *IOError) Unwrap() error {
+	return e.Err
+}
+
+// CorruptionError reports data of the DB engine which is corrupted, which is not fixed by retrying
+type CorruptionError struct {
+	Err error // The underlying error
+}
+
+func (e *CorruptionError) Error() string {
+	return "data corrupted: " + e.Err.Error()
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return e.Err
+}
+
+// corruptionErrors are errors which indicate corrupted data
+var corruptionErrors = []error{
+	data.ErrInvalidCRC,
+	io.ErrUnexpectedEOF,
+	ErrDirectoryCorrupted,
+	ErrCheckpointCorrupted,
+	ErrColumnFamiliesCorrupted,
+	bloom.ErrInvalidFilter,
+	index.ErrIndexCorrupted,
+}
+
+// ioErrors are errors which indicate failures of I/O, besides errors of the file system
+var ioErrors = []error{
+	io.ErrShortWrite,
+	io_handler.ErrInjectedFault,
+	io_handler.ErrTornWrite,
+	index.ErrIndexIOFailed,
+}
+
+// classifyError wraps an error of corrupted data in CorruptionError and an error of I/O in IOError,
+// and returns other errors as they are
+//
+// Errors of Launch, Close, Sync, Stat, Merge, Put, Get and Delete are classified.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var corruptionError *CorruptionError
+	var ioError *IOError
+	if errors.As(err, &corruptionError) || errors.As(err, &ioError) {
+		return err
+	}
+
+	for _, e := range corruptionErrors {
+		if errors.Is(err, e) {
+			return &CorruptionError{Err: err}
+		}
+	}
+	for _, e := range ioErrors {
+		if errors.Is(err, e) {
+			return &IOError{Err: err}
+		}
+	}
+	var pathError *fs.PathError
+	var errno syscall.Errno
+	if errors.As(err, &pathError) || errors.As(err, &errno) || errors.Is(err, fs.ErrClosed) {
+		return &IOError{Err: err}
+	}
+	return err
+}
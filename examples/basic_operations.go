@@ -29,7 +29,10 @@ func main() {
 		panic(err)
 	}
 
-	wb := db.NewWriteBatch(baradb.DefaultWriteBatchOptions)
+	wb, err := db.NewWriteBatch(baradb.DefaultWriteBatchOptions)
+	if err != nil {
+		panic(err)
+	}
 
 	err = wb.Put([]byte("1919"), []byte("1919"))
 	if err != nil {
@@ -0,0 +1,721 @@
+package baradb
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/saint-yellow/baradb/data"
+	"github.com/saint-yellow/baradb/index"
+	"github.com/saint-yellow/baradb/io_handler"
+	"github.com/saint-yellow/baradb/metrics"
+)
+
+const (
+	// nextFamilyIDKey is the key of the log record which keeps the ID of the next column family in the file of column families
+	nextFamilyIDKey = "next-id"
+
+	// familyKeyPrefix is the prefix of keys of log records which keep column families in the file of column families,
+	// so that names of column families never collide with other keys
+	familyKeyPrefix = "family-"
+)
+
+// ColumnFamily represents a named set of keys in the DB engine, which has its own index and options
+//
+// Column families share data files of the DB engine, so a write batch is atomic across them,
+// and mergence, statistics and deletion of a column family do not touch keys of others.
+// Keys of the DB engine itself belong to the default column family, which is not a ColumnFamily.
+type ColumnFamily struct {
+	db          *DB                 // DB engine
+	id          uint32              // ID stored in log records of the column family
+	name        string              // Name of the column family
+	options     ColumnFamilyOptions // Options of the column family
+	index       index.Index         // In-memory index of the column family
+	reclaimSize int64               // Size of invalid data of the column family
+}
+
+// newColumnFamily constructs a column family with an empty index
+func (db *DB) newColumnFamily(id uint32, name string, options ColumnFamilyOptions) (*ColumnFamily, error) {
+	idx, err := index.New(options.IndexType, index.IndexOptions{
+		KeyReader: db.readKeyByPosition,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cf := &ColumnFamily{
+		db:      db,
+		id:      id,
+		name:    name,
+		options: options,
+		index:   idx,
+	}
+	return cf, nil
+}
+
+// CreateColumnFamily creates a column family with a given name and options
+func (db *DB) CreateColumnFamily(name string, options ColumnFamilyOptions) (*ColumnFamily, error) {
+	if name == "" {
+		return nil, ErrColumnFamilyNameIsEmpty
+	}
+	if err := checkColumnFamilyOptions(options); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.families[name]; ok {
+		return nil, ErrColumnFamilyExists
+	}
+
+	// IDs are never reused, so that log records of a dropped column family do not show up in a new one
+	cf, err := db.newColumnFamily(db.nextFamilyID, name, options)
+	if err != nil {
+		return nil, err
+	}
+	db.families[name] = cf
+	db.familiesByID[cf.id] = cf
+	db.nextFamilyID++
+	if err := db.saveColumnFamilies(); err != nil {
+		delete(db.families, name)
+		delete(db.familiesByID, cf.id)
+		db.nextFamilyID--
+		return nil, err
+	}
+	return cf, nil
+}
+
+// ColumnFamily gets a column family by a given name
+func (db *DB) ColumnFamily(name string) (*ColumnFamily, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	cf, ok := db.families[name]
+	if !ok {
+		return nil, ErrColumnFamilyNotFound
+	}
+	return cf, nil
+}
+
+// ColumnFamilies gets names of all column families in the DB engine in order
+func (db *DB) ColumnFamilies() []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	names := make([]string, 0, len(db.families))
+	for name := range db.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DropColumnFamily drops a column family with all its keys
+//
+// Log records of the column family become invalid data, which is reclaimed by the next mergence.
+func (db *DB) DropColumnFamily(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	cf, ok := db.families[name]
+	if !ok {
+		return ErrColumnFamilyNotFound
+	}
+
+	delete(db.families, name)
+	delete(db.familiesByID, cf.id)
+	if err := db.saveColumnFamilies(); err != nil {
+		db.families[name] = cf
+		db.familiesByID[cf.id] = cf
+		return err
+	}
+
+	iter, err := cf.index.Iterator(false)
+	if err != nil {
+		return err
+	}
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		db.reclaimSize.Add(int64(iter.Value().Size))
+	}
+	iter.Close()
+	return cf.index.Close()
+}
+
+// saveColumnFamilies persists names, IDs and options of all column families
+//
+// The caller must hold the lock of the DB engine.
+func (db *DB) saveColumnFamilies() error {
+	// Data in memory is gone once the DB engine is closed, so are column families
+	if db.options.IOHandlerType == io_handler.InMemoryIOHandler {
+		return nil
+	}
+
+	// Write a temporary file then replace the file of column families with it
+	tempFileName := data.FamiliesFileName + ".tmp"
+	tempFilePath := filepath.Join(db.options.Directory, tempFileName)
+	if err := os.RemoveAll(tempFilePath); err != nil {
+		return err
+	}
+	file, err := data.OpenIndexFile(db.options.Directory, tempFileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	file.SetCipher(db.cipher)
+
+	nextID := make([]byte, binary.MaxVarintLen32)
+	n := binary.PutUvarint(nextID, uint64(db.nextFamilyID))
+	lrs := []*data.LogRecord{
+		{Key: []byte(nextFamilyIDKey), Value: nextID[:n]},
+	}
+	for name, cf := range db.families {
+		lrs = append(lrs, &data.LogRecord{Key: []byte(familyKeyPrefix + name), Value: encodeColumnFamily(cf)})
+	}
+	for _, lr := range lrs {
+		elr, _, err := file.EncodeLogRecord(lr)
+		if err != nil {
+			return err
+		}
+		if err := file.Write(elr); err != nil {
+			return err
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFilePath, filepath.Join(db.options.Directory, data.FamiliesFileName))
+}
+
+// encodeColumnFamily encodes the ID and options of a column family
+func encodeColumnFamily(cf *ColumnFamily) []byte {
+	buffer := make([]byte, binary.MaxVarintLen32+binary.MaxVarintLen64+2)
+	index := 0
+	index += binary.PutUvarint(buffer[index:], uint64(cf.id))
+	buffer[index] = byte(cf.options.IndexType)
+	index++
+	index += binary.PutVarint(buffer[index:], int64(cf.options.TTL))
+	if cf.options.Compression {
+		buffer[index] = 1
+	}
+	index++
+	return buffer[:index]
+}
+
+// decodeColumnFamily decodes the ID and options of a column family
+func decodeColumnFamily(buffer []byte) (uint32, ColumnFamilyOptions, error) {
+	var options ColumnFamilyOptions
+	id, n := binary.Uvarint(buffer)
+	if n <= 0 || len(buffer) < n+1 {
+		return 0, options, ErrColumnFamiliesCorrupted
+	}
+	offset := n
+	options.IndexType = index.IndexType(buffer[offset])
+	offset++
+	ttl, n := binary.Varint(buffer[offset:])
+	if n <= 0 || len(buffer) != offset+n+1 {
+		return 0, options, ErrColumnFamiliesCorrupted
+	}
+	options.TTL = time.Duration(ttl)
+	options.Compression = buffer[offset+n] == 1
+	return uint32(id), options, nil
+}
+
+// loadColumnFamilies loads column families persisted in the directory of the DB engine and builds their indexes
+func (db *DB) loadColumnFamilies() error {
+	db.families = make(map[string]*ColumnFamily)
+	db.familiesByID = make(map[uint32]*ColumnFamily)
+	db.nextFamilyID = 1
+
+	filePath := filepath.Join(db.options.Directory, data.FamiliesFileName)
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil
+	}
+
+	file, err := data.OpenIndexFile(db.options.Directory, data.FamiliesFileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	file.SetCipher(db.cipher)
+
+	var offset int64 = 0
+	for {
+		lr, n, err := file.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		offset += n
+
+		if string(lr.Key) == nextFamilyIDKey {
+			nextID, n := binary.Uvarint(lr.Value)
+			if n <= 0 {
+				return ErrColumnFamiliesCorrupted
+			}
+			db.nextFamilyID = uint32(nextID)
+			continue
+		}
+		if !strings.HasPrefix(string(lr.Key), familyKeyPrefix) {
+			return ErrColumnFamiliesCorrupted
+		}
+
+		id, options, err := decodeColumnFamily(lr.Value)
+		if err != nil {
+			return err
+		}
+		if err := checkColumnFamilyOptions(options); err != nil {
+			return ErrColumnFamiliesCorrupted
+		}
+		cf, err := db.newColumnFamily(id, strings.TrimPrefix(string(lr.Key), familyKeyPrefix), options)
+		if err != nil {
+			return err
+		}
+		db.families[cf.name] = cf
+		db.familiesByID[cf.id] = cf
+	}
+
+	if len(db.families) == 0 {
+		return nil
+	}
+	return db.loadColumnFamilyIndexes()
+}
+
+// loadColumnFamilyIndexes builds indexes of column families from all data files
+//
+// Unlike the index of the DB engine, indexes of column families are neither persisted nor covered by the hint file,
+// so all data files are read at startup, including merged ones.
+func (db *DB) loadColumnFamilyIndexes() error {
+	transactionRecords := make(map[uint64][]*data.TransactionRecord)
+	for _, fid := range db.fileIDs {
+		fileID := uint32(fid)
+		file := db.getDataFile(fileID)
+
+		var offset int64 = 0
+		for {
+			lr, n, err := file.ReadLogRecord(offset)
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+
+			lrp := &data.LogRecordPosition{
+				FileID: fileID,
+				Offset: offset,
+				Size:   uint32(n),
+			}
+			if lr.Timestamp > db.lastTimestamp {
+				db.lastTimestamp = lr.Timestamp
+			}
+
+			// Log records written by a transaction are applied once the transaction is finished
+			lrKey, tranNo := data.DecodeKey(lr.Key)
+			switch {
+			case lr.Type == data.TransactionFinishedLogRecord:
+				for _, tr := range transactionRecords[tranNo] {
+					if err := db.updateColumnFamilyIndex(tr.Log, tr.Position); err != nil {
+						return err
+					}
+				}
+				delete(transactionRecords, tranNo)
+			case lr.Family == 0:
+				// Log records of the default column family are loaded into the index of the DB engine
+			case tranNo == nonTranNo:
+				lr.Key = lrKey
+				if err := db.updateColumnFamilyIndex(lr, lrp); err != nil {
+					return err
+				}
+			default:
+				lr.Key = lrKey
+				tr := &data.TransactionRecord{
+					Log:      lr,
+					Position: lrp,
+				}
+				transactionRecords[tranNo] = append(transactionRecords[tranNo], tr)
+			}
+
+			offset += n
+		}
+	}
+
+	return nil
+}
+
+// updateColumnFamilyIndex applies a log record of a column family to its index,
+// or counts it as invalid data if the column family has been dropped
+func (db *DB) updateColumnFamilyIndex(lr *data.LogRecord, lrp *data.LogRecordPosition) error {
+	cf, ok := db.familiesByID[lr.Family]
+	if !ok {
+		db.reclaimSize.Add(int64(lrp.Size))
+		return nil
+	}
+	return cf.updateIndex(lr.Key, lr.Type, lrp)
+}
+
+// closeColumnFamilies closes indexes of all column families
+func (db *DB) closeColumnFamilies() error {
+	for _, cf := range db.families {
+		if err := cf.index.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the column family
+func (cf *ColumnFamily) Name() string {
+	return cf.name
+}
+
+// Options returns the options of the column family
+func (cf *ColumnFamily) Options() ColumnFamilyOptions {
+	return cf.options
+}
+
+// isDropped reports whether the column family has been dropped
+//
+// The caller must hold the lock of the DB engine.
+func (cf *ColumnFamily) isDropped() bool {
+	return cf.db.familiesByID[cf.id] != cf
+}
+
+// isExpired reports whether a log record of the column family is older than the TTL of the column family
+func (cf *ColumnFamily) isExpired(lr *data.LogRecord) bool {
+	if cf.options.TTL <= 0 || lr.Timestamp == 0 {
+		return false
+	}
+	return time.Now().UnixNano()-lr.Timestamp >= int64(cf.options.TTL)
+}
+
+// newLogRecord constructs a log record of the column family, whose value is compressed if configured
+func (cf *ColumnFamily) newLogRecord(key, value []byte, lrType data.LogRecordType) (*data.LogRecord, error) {
+	lr := &data.LogRecord{
+		Key:    key,
+		Value:  value,
+		Type:   lrType,
+		Family: cf.id,
+	}
+	if lrType == data.NormalLogRecord && cf.options.Compression {
+		compressed, err := compressValue(value)
+		if err != nil {
+			return nil, err
+		}
+		lr.Value, lr.Compressed = compressed, true
+	}
+	return lr, nil
+}
+
+// updateIndex applies a written log record to the index of the column family
+//
+// The caller must hold the lock of the DB engine.
+func (cf *ColumnFamily) updateIndex(key []byte, lrType data.LogRecordType, lrp *data.LogRecordPosition) error {
+	var oldLRP *data.LogRecordPosition
+	var err error
+	if lrType == data.DeletedLogRecord {
+		oldLRP, _, err = cf.index.Delete(key)
+		cf.reclaimSize += int64(lrp.Size)
+		cf.db.reclaimSize.Add(int64(lrp.Size))
+	} else {
+		oldLRP, err = cf.index.Put(key, lrp)
+	}
+	if err != nil {
+		return err
+	}
+
+	if oldLRP != nil {
+		cf.reclaimSize += int64(oldLRP.Size)
+		cf.db.reclaimSize.Add(int64(oldLRP.Size))
+	}
+	return nil
+}
+
+// getValueByPosition gets the value of the column family at a given position
+func (cf *ColumnFamily) getValueByPosition(lrp *data.LogRecordPosition) ([]byte, error) {
+	lr, err := cf.db.getLogRecordByPosition(lrp)
+	if err != nil {
+		return nil, err
+	}
+	return cf.valueOf(lr)
+}
+
+// valueOf gets the value of the column family in a log record
+func (cf *ColumnFamily) valueOf(lr *data.LogRecord) ([]byte, error) {
+	if cf.isExpired(lr) {
+		return nil, ErrKeyNotFound
+	}
+	if lr.Compressed {
+		return decompressValue(lr.Value)
+	}
+	return lr.Value, nil
+}
+
+// Put Writes data to the column family
+func (cf *ColumnFamily) Put(key, value []byte) (err error) {
+	defer cf.db.startOperation(context.Background(), metrics.OperationPut)(&err)
+
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	lr, err := cf.newLogRecord(data.EncodeKey(key, nonTranNo), value, data.NormalLogRecord)
+	if err != nil {
+		return err
+	}
+
+	cf.db.mu.Lock()
+	defer cf.db.mu.Unlock()
+
+	if cf.isDropped() {
+		return ErrColumnFamilyNotFound
+	}
+
+	lr.Timestamp = cf.db.nextTimestamp()
+	lrp, err := cf.db.appendLogRecord(lr, false)
+	if err != nil {
+		return classifyError(err)
+	}
+	return classifyError(cf.updateIndex(key, lr.Type, lrp))
+}
+
+// Get Reads data from the column family by a given key
+func (cf *ColumnFamily) Get(key []byte) (value []byte, err error) {
+	defer cf.db.startOperation(context.Background(), metrics.OperationGet)(&err)
+
+	cf.db.mu.RLock()
+	defer cf.db.mu.RUnlock()
+
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	if cf.isDropped() {
+		return nil, ErrColumnFamilyNotFound
+	}
+
+	lrp, lr, err := cf.db.lookup(cf.index, key)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	if lrp == nil {
+		return nil, ErrKeyNotFound
+	}
+	if lr != nil {
+		value, err = cf.valueOf(lr)
+	} else {
+		value, err = cf.getValueByPosition(lrp)
+	}
+	return value, classifyError(err)
+}
+
+// Delete Delete data of the column family by the given key
+func (cf *ColumnFamily) Delete(key []byte) (err error) {
+	defer cf.db.startOperation(context.Background(), metrics.OperationDelete)(&err)
+
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	cf.db.mu.Lock()
+	defer cf.db.mu.Unlock()
+
+	if cf.isDropped() {
+		return ErrColumnFamilyNotFound
+	}
+	if p, err := cf.index.Get(key); err != nil || p == nil {
+		return classifyError(err)
+	}
+
+	lr, _ := cf.newLogRecord(data.EncodeKey(key, nonTranNo), nil, data.DeletedLogRecord)
+	lr.Timestamp = cf.db.nextTimestamp()
+	lrp, err := cf.db.appendLogRecord(lr, false)
+	if err != nil {
+		return classifyError(err)
+	}
+	return classifyError(cf.updateIndex(key, lr.Type, lrp))
+}
+
+// ListKeys gets all keys in the column family, except expired ones
+func (cf *ColumnFamily) ListKeys() ([][]byte, error) {
+	cf.db.mu.RLock()
+	defer cf.db.mu.RUnlock()
+
+	if cf.isDropped() {
+		return nil, ErrColumnFamilyNotFound
+	}
+
+	iter, err := cf.index.Iterator(false)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	keys := make([][]byte, 0, cf.index.Size())
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		if cf.options.TTL > 0 {
+			lr, err := cf.db.getLogRecordByPosition(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			if cf.isExpired(lr) {
+				continue
+			}
+		}
+		keys = append(keys, iter.Key())
+	}
+	return keys, nil
+}
+
+// Fold retrieves all the data of the column family except expired ones and iteratively executes an user-specified operation (UDF)
+// Once the UDF failed, the iteration will stop intermediatelly
+func (cf *ColumnFamily) Fold(fn userOperationFunc) error {
+	cf.db.mu.RLock()
+	defer cf.db.mu.RUnlock()
+
+	if cf.isDropped() {
+		return ErrColumnFamilyNotFound
+	}
+
+	iter, err := cf.index.Iterator(false)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		value, err := cf.getValueByPosition(iter.Value())
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if ok := fn(iter.Key(), value); !ok {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Stat returns statistical information of the column family
+func (cf *ColumnFamily) Stat() (*ColumnFamilyStat, error) {
+	cf.db.mu.RLock()
+	defer cf.db.mu.RUnlock()
+
+	if cf.isDropped() {
+		return nil, ErrColumnFamilyNotFound
+	}
+
+	stat := &ColumnFamilyStat{
+		KeyNumber:       uint(cf.index.Size()),
+		ReclaimableSize: cf.reclaimSize,
+	}
+	return stat, nil
+}
+
+// Backup writes the live records of the column family to a DB engine in a given directory,
+// where they are kept in a column family of the same name and options
+//
+// Expired keys and keys of other column families are not written, and the write timestamps of records are kept.
+func (cf *ColumnFamily) Backup(directory string) error {
+	opts := cf.db.options
+	opts.Directory = directory
+	if err := checkDBOptions(opts); err != nil {
+		return err
+	}
+
+	cf.db.mu.RLock()
+	defer cf.db.mu.RUnlock()
+
+	if cf.isDropped() {
+		return ErrColumnFamilyNotFound
+	}
+
+	backup, err := Launch(opts)
+	if err != nil {
+		return err
+	}
+	if err := cf.writeTo(backup); err != nil {
+		_ = backup.Close()
+		return err
+	}
+	if err := backup.Sync(); err != nil {
+		_ = backup.Close()
+		return err
+	}
+	return backup.Close()
+}
+
+// writeTo writes the live records of the column family to a column family of the same name in another DB engine
+//
+// The caller must hold the lock of the DB engine of the column family.
+func (cf *ColumnFamily) writeTo(backup *DB) error {
+	bcf, err := backup.CreateColumnFamily(cf.name, cf.options)
+	if err != nil {
+		return err
+	}
+
+	iter, err := cf.index.Iterator(false)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	backup.mu.Lock()
+	defer backup.mu.Unlock()
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		lr, err := cf.db.getLogRecordByPosition(iter.Value())
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if cf.isExpired(lr) {
+			continue
+		}
+
+		key := iter.Key()
+		lr.Key, lr.Family = data.EncodeKey(key, nonTranNo), bcf.id
+		lrp, err := backup.appendLogRecord(lr, false)
+		if err != nil {
+			return err
+		}
+		if err := bcf.updateIndex(key, lr.Type, lrp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compressValue compresses a value with DEFLATE
+func compressValue(value []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	w, err := flate.NewWriter(&buffer, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// decompressValue decompresses a value compressed by compressValue
+func decompressValue(value []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(value))
+	defer r.Close()
+	return io.ReadAll(r)
+}
@@ -0,0 +1,212 @@
+package baradb
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/saint-yellow/baradb/bloom"
+	"github.com/saint-yellow/baradb/data"
+	"github.com/saint-yellow/baradb/io_handler"
+)
+
+const (
+	bloomFilterPositionKey = "position"
+	bloomFilterKey         = "filter"
+
+	// bloomFilterMinCapacity Minimum number of keys which a Bloom filter is sized for
+	bloomFilterMinCapacity = 1024
+)
+
+// newBloomFilter constructs a Bloom filter sized for a given number of keys with room to grow
+func (db *DB) newBloomFilter(keyNumber int) *bloom.Filter {
+	capacity := 2 * keyNumber
+	if capacity < bloomFilterMinCapacity {
+		capacity = bloomFilterMinCapacity
+	}
+	return bloom.New(capacity, db.options.BloomFilterFalsePositiveRate)
+}
+
+// mayContain reports whether a key may exist in the DB engine, it is always true if the Bloom filter is disabled
+func (db *DB) mayContain(key []byte) bool {
+	return db.filter == nil || db.filter.MayContain(key)
+}
+
+// addToFilter adds a written key to the Bloom filter
+//
+// The filter is rebuilt in a larger size once it holds more keys than it is sized for,
+// so that its false-positive rate does not grow with the DB engine.
+// The filter is kept as it is if it can not be rebuilt, which only raises its false-positive rate.
+// The caller must hold the lock of the DB engine.
+func (db *DB) addToFilter(key []byte) {
+	if db.filter == nil {
+		return
+	}
+	// The filter is rebuilt before the key is added, since the key may not be published to the index yet
+	if db.filter.Count() >= db.filter.Capacity() {
+		_ = db.rebuildFilter()
+	}
+	db.filter.Add(key)
+}
+
+// rebuildFilter builds the Bloom filter from all keys in the index
+func (db *DB) rebuildFilter() error {
+	db.waitForPublishes()
+	filter := db.newBloomFilter(db.index.Size())
+	iter, err := db.index.Iterator(false)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		filter.Add(iter.Key())
+	}
+	db.filter = filter
+	return nil
+}
+
+// loadBloomFilter loads the Bloom filter persisted in the directory of the DB engine,
+// and adds keys written after the position it covers.
+//
+// The filter is rebuilt from the index if it is missing or unusable.
+func (db *DB) loadBloomFilter() error {
+	filter, position, err := readBloomFilter(db.options.Directory, db.cipher)
+	if err != nil || filter == nil || !db.isValidPosition(position) {
+		return db.rebuildFilter()
+	}
+
+	db.filter = filter
+	return db.addKeysFromDataFiles(position)
+}
+
+// isValidPosition reports whether a position points into an existing data file
+func (db *DB) isValidPosition(position *data.LogRecordPosition) bool {
+	file := db.getDataFile(position.FileID)
+	if file == nil {
+		return false
+	}
+	size, err := file.Size()
+	return err == nil && position.Offset <= size
+}
+
+// addKeysFromDataFiles adds keys of log records after a given position to the Bloom filter
+//
+// Keys of transactions which were not committed are added as well, which only causes false positives.
+func (db *DB) addKeysFromDataFiles(start *data.LogRecordPosition) error {
+	for _, fid := range db.fileIDs {
+		fileID := uint32(fid)
+		if fileID < start.FileID {
+			continue
+		}
+		file := db.getDataFile(fileID)
+
+		var offset int64 = 0
+		if fileID == start.FileID {
+			offset = start.Offset
+		}
+		for {
+			lr, n, err := file.ReadLogRecord(offset)
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			if (lr.Type == data.NormalLogRecord || lr.Type == data.MergeOperandLogRecord) && lr.Family == 0 {
+				key, _ := data.DecodeKey(lr.Key)
+				db.addToFilter(key)
+			}
+			offset += n
+		}
+	}
+	return nil
+}
+
+// saveBloomFilter persists the Bloom filter, which covers all data written to the DB engine so far
+//
+// The caller must hold the lock of the DB engine.
+func (db *DB) saveBloomFilter() error {
+	// Data in memory is gone once the DB engine is closed, so is the filter
+	if db.filter == nil || db.activeFile == nil || db.options.IOHandlerType == io_handler.InMemoryIOHandler {
+		return nil
+	}
+	position := &data.LogRecordPosition{
+		FileID: db.activeFile.FileID,
+		Offset: db.activeFile.WriteOffset,
+	}
+	return writeBloomFilter(db.options.Directory, db.cipher, db.filter, position)
+}
+
+// writeBloomFilter writes a Bloom filter which covers data files up to a given position to a directory
+func writeBloomFilter(directory string, cipher *data.Cipher, filter *bloom.Filter, position *data.LogRecordPosition) error {
+	// Write a temporary file then replace the filter file with it
+	tempFileName := data.BloomFilterFileName + ".tmp"
+	tempFilePath := filepath.Join(directory, tempFileName)
+	if err := os.RemoveAll(tempFilePath); err != nil {
+		return err
+	}
+	file, err := data.OpenIndexFile(directory, tempFileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	file.SetCipher(cipher)
+
+	lrs := []*data.LogRecord{
+		{Key: []byte(bloomFilterPositionKey), Value: data.EncodeLogRecordPosition(position)},
+		{Key: []byte(bloomFilterKey), Value: filter.Encode()},
+	}
+	for _, lr := range lrs {
+		elr, _, err := file.EncodeLogRecord(lr)
+		if err != nil {
+			return err
+		}
+		if err := file.Write(elr); err != nil {
+			return err
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFilePath, filepath.Join(directory, data.BloomFilterFileName))
+}
+
+// readBloomFilter reads a Bloom filter and the position it covers from a directory
+//
+// It returns a nil filter if there is no filter file.
+func readBloomFilter(directory string, cipher *data.Cipher) (*bloom.Filter, *data.LogRecordPosition, error) {
+	filePath := filepath.Join(directory, data.BloomFilterFileName)
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+
+	file, err := data.OpenIndexFile(directory, data.BloomFilterFileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	file.SetCipher(cipher)
+
+	lr, n, err := file.ReadLogRecord(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if string(lr.Key) != bloomFilterPositionKey {
+		return nil, nil, bloom.ErrInvalidFilter
+	}
+	position := data.DecodeLogRecordPosition(lr.Value)
+
+	lr, _, err = file.ReadLogRecord(n)
+	if err != nil {
+		return nil, nil, err
+	}
+	if string(lr.Key) != bloomFilterKey {
+		return nil, nil, bloom.ErrInvalidFilter
+	}
+	filter, err := bloom.Decode(lr.Value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return filter, position, nil
+}
@@ -0,0 +1,349 @@
+package baradb
+
+import (
+	"io"
+	"time"
+
+	"github.com/saint-yellow/baradb/data"
+)
+
+// version represents a version of a key kept in the history of the DB engine
+type version struct {
+	timestamp int64                   // Write timestamp of the version (unit: ns), it is 0 if unknown
+	position  *data.LogRecordPosition // Position of the log record of the version
+	deleted   bool                    // Whether the version is a deletion
+	chain     *operandChain           // Chain of merge operands which the version is resolved with, it is nil unless the version is a merge operand
+}
+
+// historyEnabled reports whether the DB engine keeps versions of keys
+func (db *DB) historyEnabled() bool {
+	return db.options.HistoryVersions > 0 || db.options.HistoryRetention > 0
+}
+
+// addVersion adds a version of a key to the history, and drops versions which are out of the retention policy
+//
+// A version which is not newer than the latest one is ignored, since it is a copy rewritten by a mergence.
+// A version without timestamp can not be ordered by time, so it replaces all versions before it.
+// The caller must hold the lock of the DB engine.
+func (db *DB) addVersion(key []byte, timestamp int64, lrp *data.LogRecordPosition, deleted bool) {
+	db.putVersion(key, &version{
+		timestamp: timestamp,
+		position:  lrp,
+		deleted:   deleted,
+	})
+}
+
+// addOperandVersion adds a version of a key which is a merge operand, see addVersion
+//
+// The version keeps the chain of the operand, so that it can be resolved after the chain is dropped by a later write.
+// The caller must hold the lock of the DB engine.
+func (db *DB) addOperandVersion(key []byte, timestamp int64, lrp *data.LogRecordPosition, chain *operandChain) {
+	db.putVersion(key, &version{
+		timestamp: timestamp,
+		position:  lrp,
+		chain:     chain,
+	})
+}
+
+// putVersion adds a version of a key to the history, see addVersion
+func (db *DB) putVersion(key []byte, v *version) {
+	if db.history == nil {
+		return
+	}
+
+	versions := db.history[string(key)]
+	if n := len(versions); n > 0 {
+		if v.timestamp != 0 && v.timestamp <= versions[n-1].timestamp {
+			return
+		}
+		if v.timestamp == 0 {
+			versions = nil
+		}
+	}
+	versions = append(versions, v)
+
+	versions = db.retainVersions(versions, time.Now().UnixNano())
+	if len(versions) == 0 {
+		delete(db.history, string(key))
+		return
+	}
+	db.history[string(key)] = versions
+}
+
+// retainVersions returns versions of a key which are kept by the retention policy at a given time, in a new slice if any is dropped
+//
+// Versions beyond the configured number are dropped, and so are versions replaced before the retention window,
+// but the version which was current at the beginning of the window is kept to answer reads at that time.
+// A deletion which is the only version left is dropped as well, since there is nothing to hide.
+func (db *DB) retainVersions(versions []*version, now int64) []*version {
+	start := 0
+	if n := db.options.HistoryVersions; n > 0 && len(versions) > n {
+		start = len(versions) - n
+	}
+	if retention := db.options.HistoryRetention; retention > 0 {
+		deadline := now - int64(retention)
+		for start < len(versions)-1 && versions[start+1].timestamp <= deadline {
+			start++
+		}
+	}
+	if start == len(versions)-1 && versions[start].deleted {
+		return nil
+	}
+	if start == 0 {
+		return versions
+	}
+	return append([]*version(nil), versions[start:]...)
+}
+
+// retainedPositions prunes the history by the retention policy, and returns positions of all retained versions,
+// including positions of the chains which retained merge operands are resolved with
+//
+// The caller must hold the lock of the DB engine.
+func (db *DB) retainedPositions() map[data.LogRecordPosition]struct{} {
+	if db.history == nil {
+		return nil
+	}
+
+	now := time.Now().UnixNano()
+	positions := make(map[data.LogRecordPosition]struct{})
+	for key, versions := range db.history {
+		versions = db.retainVersions(versions, now)
+		if len(versions) == 0 {
+			delete(db.history, key)
+			continue
+		}
+		db.history[key] = versions
+		for _, v := range versions {
+			positions[*v.position] = struct{}{}
+			if v.chain == nil {
+				continue
+			}
+			if v.chain.base != nil {
+				positions[*v.chain.base] = struct{}{}
+			}
+			for _, p := range v.chain.operands {
+				positions[*p] = struct{}{}
+				if *p == *v.position {
+					break
+				}
+			}
+		}
+	}
+	return positions
+}
+
+// loadHistory builds the history of keys from all data files
+//
+// Unlike the index, the history is neither persisted nor covered by the hint file,
+// so all data files are read at startup, including merged ones which keep retained versions.
+func (db *DB) loadHistory() error {
+	db.history = make(map[string][]*version)
+
+	// Chains of merge operands are rebuilt as well, since they may have been dropped by later writes
+	chains := newOperandChains()
+
+	transactionRecords := make(map[uint64][]*data.TransactionRecord)
+	for _, fid := range db.fileIDs {
+		fileID := uint32(fid)
+		file := db.getDataFile(fileID)
+
+		var offset int64 = 0
+		for {
+			lr, n, err := file.ReadLogRecord(offset)
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+
+			lrp := &data.LogRecordPosition{
+				FileID: fileID,
+				Offset: offset,
+				Size:   uint32(n),
+			}
+			if lr.Timestamp > db.lastTimestamp {
+				db.lastTimestamp = lr.Timestamp
+			}
+
+			// Versions written by a transaction are added once the transaction is finished
+			lrKey, tranNo := data.DecodeKey(lr.Key)
+			switch {
+			case lr.Family != 0:
+				// Column families have no history
+			case lr.Type == data.RangeTombstoneLogRecord:
+				for key := range db.history {
+					if inRange([]byte(key), lrKey, lr.Value) {
+						db.addVersion([]byte(key), lr.Timestamp, lrp, true)
+					}
+				}
+				chains.deleteRange(lrKey, lr.Value)
+			case tranNo == nonTranNo:
+				if chain := chains.apply(lrKey, lr.Type, lrp); chain != nil {
+					db.addOperandVersion(lrKey, lr.Timestamp, lrp, chain)
+					break
+				}
+				db.addVersion(lrKey, lr.Timestamp, lrp, lr.Type == data.DeletedLogRecord)
+			case lr.Type == data.TransactionFinishedLogRecord:
+				for _, tr := range transactionRecords[tranNo] {
+					chains.apply(tr.Log.Key, tr.Log.Type, tr.Position)
+					db.addVersion(tr.Log.Key, tr.Log.Timestamp, tr.Position, tr.Log.Type == data.DeletedLogRecord)
+				}
+				delete(transactionRecords, tranNo)
+			default:
+				lr.Key = lrKey
+				tr := &data.TransactionRecord{
+					Log:      lr,
+					Position: lrp,
+				}
+				transactionRecords[tranNo] = append(transactionRecords[tranNo], tr)
+			}
+
+			offset += n
+		}
+	}
+
+	return nil
+}
+
+// GetAt Reads data from the DB engine by a given key as it was at a given time
+//
+// It requires the history of keys, see HistoryVersions and HistoryRetention of DBOptions.
+// It returns ErrKeyNotFound if the key did not exist at that time, or its versions at that time are no longer retained.
+func (db *DB) GetAt(key []byte, at time.Time) ([]byte, error) {
+	if !db.historyEnabled() {
+		return nil, ErrHistoryDisabled
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+
+	timestamp := at.UnixNano()
+	versions := db.retainVersions(db.history[string(key)], time.Now().UnixNano())
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if v.timestamp > timestamp {
+			continue
+		}
+		if v.deleted {
+			return nil, ErrKeyNotFound
+		}
+		return db.getValueOfVersion(v)
+	}
+
+	return nil, ErrKeyNotFound
+}
+
+// HistoryIterator iterates over retained versions of a key from the newest to the oldest
+type HistoryIterator struct {
+	db       *DB
+	versions []*version // Versions of the key when the iterator was created
+	index    int        // Index of the current version
+}
+
+// History returns an iterator over retained versions of a given key, including deletions
+//
+// It requires the history of keys, see HistoryVersions and HistoryRetention of DBOptions.
+func (db *DB) History(key []byte) (*HistoryIterator, error) {
+	if !db.historyEnabled() {
+		return nil, ErrHistoryDisabled
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+
+	versions := db.retainVersions(db.history[string(key)], time.Now().UnixNano())
+	it := &HistoryIterator{
+		db:       db,
+		versions: append([]*version(nil), versions...),
+	}
+	it.Rewind()
+	return it, nil
+}
+
+// Rewind moves the iterator to the newest version
+func (it *HistoryIterator) Rewind() {
+	it.index = len(it.versions) - 1
+}
+
+// Next moves the iterator to the next older version
+func (it *HistoryIterator) Next() {
+	it.index--
+}
+
+// Valid reports whether the iterator points to a version
+func (it *HistoryIterator) Valid() bool {
+	return it.index >= 0 && it.index < len(it.versions)
+}
+
+// Timestamp returns when the current version was written, it is the zero time if unknown
+func (it *HistoryIterator) Timestamp() time.Time {
+	timestamp := it.versions[it.index].timestamp
+	if timestamp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, timestamp)
+}
+
+// Deleted reports whether the current version is a deletion
+func (it *HistoryIterator) Deleted() bool {
+	return it.versions[it.index].deleted
+}
+
+// Value returns the value of the current version, or ErrKeyNotFound if it is a deletion
+func (it *HistoryIterator) Value() ([]byte, error) {
+	v := it.versions[it.index]
+	if v.deleted {
+		return nil, ErrKeyNotFound
+	}
+
+	it.db.mu.RLock()
+	defer it.db.mu.RUnlock()
+
+	return it.db.getValueOfVersion(v)
+}
+
+// getValueOfVersion gets the value of a version, a merge operand is resolved with the chain kept by the version
+//
+// The caller must hold the lock or the read lock of the DB engine.
+func (db *DB) getValueOfVersion(v *version) ([]byte, error) {
+	if v.chain == nil {
+		return db.getValueByPosition(v.position)
+	}
+	if db.cache != nil {
+		if value, ok := db.cache.Get(v.position.FileID, v.position.Offset); ok {
+			return value, nil
+		}
+	}
+
+	file := db.getDataFile(v.position.FileID)
+	if file == nil {
+		return nil, ErrFileNotFound
+	}
+	lr, err := file.ReadLogRecordAt(v.position)
+	if err != nil {
+		return nil, err
+	}
+	value, err := db.resolveOperandChain(v.chain, lr, v.position)
+	if err != nil {
+		return nil, err
+	}
+
+	if db.cache != nil {
+		db.cache.Put(v.position.FileID, v.position.Offset, value)
+	}
+	return value, nil
+}
+
+// Close closes the iterator
+func (it *HistoryIterator) Close() {
+	it.versions = nil
+}
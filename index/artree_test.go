@@ -17,60 +17,78 @@ func TestARTree_new(t *testing.T) {
 }
 
 func TestARTree_Put(t *testing.T) {
+	var err error
 	tree := newARTree()
 
 	var lrp *data.LogRecordPosition
 
-	lrp = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
+	lrp, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
+	assert.Nil(t, err)
 	assert.Nil(t, lrp)
 
-	lrp = tree.Put([]byte("14"), &data.LogRecordPosition{FileID: 514, Offset: 514})
+	lrp, err = tree.Put([]byte("14"), &data.LogRecordPosition{FileID: 514, Offset: 514})
+	assert.Nil(t, err)
 	assert.Nil(t, lrp)
 
-	lrp = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 14, Offset: 51})
+	lrp, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 14, Offset: 51})
+	assert.Nil(t, err)
 	assert.NotNil(t, lrp)
 }
 
 func TestARTree_Get(t *testing.T) {
+	var err error
 	tree := newARTree()
 
-	tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
-	lrp := tree.Get([]byte("114"))
+	_, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
+	assert.Nil(t, err)
+	lrp, err := tree.Get([]byte("114"))
+	assert.Nil(t, err)
 	assert.True(t, lrp.FileID == uint32(114) && lrp.Offset == int64(114))
 
-	tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 1140, Offset: 1140})
-	lrp = tree.Get([]byte("114"))
+	_, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 1140, Offset: 1140})
+	assert.Nil(t, err)
+	lrp, err = tree.Get([]byte("114"))
+	assert.Nil(t, err)
 	assert.True(t, lrp.FileID == uint32(1140) && lrp.Offset == int64(1140))
 
-	lrp = tree.Get([]byte("514"))
+	lrp, err = tree.Get([]byte("514"))
+	assert.Nil(t, err)
 	assert.Nil(t, lrp)
 }
 
 func TestARTree_Delete(t *testing.T) {
+	var err error
 	tree := newARTree()
 
 	var lrp *data.LogRecordPosition
 	var ok bool
-	tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
-	lrp = tree.Get([]byte("114"))
+	_, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
+	assert.Nil(t, err)
+	lrp, err = tree.Get([]byte("114"))
+	assert.Nil(t, err)
 	assert.NotNil(t, lrp)
-	lrp, ok = tree.Delete([]byte("114"))
+	lrp, ok, err = tree.Delete([]byte("114"))
+	assert.Nil(t, err)
 	assert.NotNil(t, lrp)
 	assert.True(t, ok)
-	lrp, ok = tree.Delete([]byte("114"))
+	lrp, ok, err = tree.Delete([]byte("114"))
+	assert.Nil(t, err)
 	assert.Nil(t, lrp)
 	assert.False(t, ok)
 }
 
 func TestARTree_Size(t *testing.T) {
+	var err error
 	tree := newARTree()
 	assert.Zero(t, tree.Size())
 
-	tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
+	_, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
+	assert.Nil(t, err)
 	assert.Positive(t, tree.Size())
 	assert.Equal(t, 1, tree.Size())
 
-	tree.Delete([]byte("114"))
+	_, _, err = tree.Delete([]byte("114"))
+	assert.Nil(t, err)
 	assert.Zero(t, tree.Size())
 }
 
@@ -78,12 +96,15 @@ func TestARTreeIterator_new(t *testing.T) {
 	tree := newARTree()
 
 	// The index has no key
-	iter1 := tree.Iterator(false)
+	iter1, err := tree.Iterator(false)
+	assert.Nil(t, err)
 	assert.False(t, iter1.Valid())
 
 	// The index has one key
-	tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
-	iter2 := tree.Iterator(false)
+	_, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
+	assert.Nil(t, err)
+	iter2, err := tree.Iterator(false)
+	assert.Nil(t, err)
 	assert.True(t, iter2.Valid())
 	assert.NotNil(t, iter2.Key())
 	assert.NotNil(t, iter2.Value())
@@ -92,14 +113,17 @@ func TestARTreeIterator_new(t *testing.T) {
 
 	// The indexe has more keys
 	for i := 1; i < 20; i++ {
-		tree.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: 114})
+		_, err = tree.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: 114})
+		assert.Nil(t, err)
 	}
-	iter3 := tree.Iterator(false)
+	iter3, err := tree.Iterator(false)
+	assert.Nil(t, err)
 	for iter3.Rewind(); iter3.Valid(); iter3.Next() {
 		assert.NotNil(t, iter3.Key())
 		assert.NotNil(t, iter3.Value())
 	}
-	iter4 := tree.Iterator(true)
+	iter4, err := tree.Iterator(true)
+	assert.Nil(t, err)
 	for iter4.Rewind(); iter4.Valid(); iter4.Next() {
 		assert.NotNil(t, iter4.Key())
 		assert.NotNil(t, iter4.Value())
@@ -107,13 +131,16 @@ func TestARTreeIterator_new(t *testing.T) {
 }
 
 func TestARTreeIterator_Seek(t *testing.T) {
+	var err error
 	tree := newARTree()
 
 	for i := 1; i <= 10; i++ {
-		tree.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: 514})
+		_, err = tree.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: 514})
+		assert.Nil(t, err)
 	}
 
-	iter1 := tree.Iterator(false)
+	iter1, err := tree.Iterator(false)
+	assert.Nil(t, err)
 	defer iter1.Close()
 	var index int = 1
 	for iter1.Seek([]byte("aaa")); iter1.Valid(); iter1.Next() {
@@ -124,7 +151,8 @@ func TestARTreeIterator_Seek(t *testing.T) {
 		}
 	}
 
-	iter2 := tree.Iterator(true)
+	iter2, err := tree.Iterator(true)
+	assert.Nil(t, err)
 	defer iter2.Close()
 	for iter2.Seek([]byte("zzz")); iter2.Valid(); iter2.Next() {
 		// From 10 to 1
@@ -24,7 +24,7 @@ func newARTree() *arTree {
 }
 
 // Put stores location of the corresponding data of the key in the index
-func (t *arTree) Put(key []byte, position *data.LogRecordPosition) *data.LogRecordPosition {
+func (t *arTree) Put(key []byte, position *data.LogRecordPosition) (*data.LogRecordPosition, error) {
 	t.lock.Lock()
 	oldValue, updated := t.tree.Insert(key, position)
 	t.lock.Unlock()
@@ -33,24 +33,24 @@ func (t *arTree) Put(key []byte, position *data.LogRecordPosition) *data.LogReco
 	if updated {
 		lrp = oldValue.(*data.LogRecordPosition)
 	}
-	return lrp
+	return lrp, nil
 }
 
 // Get gets the location of the corresponding data af the key in the index
-func (t *arTree) Get(key []byte) *data.LogRecordPosition {
+func (t *arTree) Get(key []byte) (*data.LogRecordPosition, error) {
 	t.lock.RLock()
 	defer t.lock.RUnlock()
 
 	value, found := t.tree.Search(key)
 	if !found {
-		return nil
+		return nil, nil
 	}
 
-	return value.(*data.LogRecordPosition)
+	return value.(*data.LogRecordPosition), nil
 }
 
 // Delete deletes the location of the corresponding data of the key in the index
-func (t *arTree) Delete(key []byte) (*data.LogRecordPosition, bool) {
+func (t *arTree) Delete(key []byte) (*data.LogRecordPosition, bool, error) {
 	t.lock.Lock()
 	oldValue, deleted := t.tree.Delete(key)
 	t.lock.Unlock()
@@ -59,7 +59,7 @@ func (t *arTree) Delete(key []byte) (*data.LogRecordPosition, bool) {
 	if deleted {
 		lrp = oldValue.(*data.LogRecordPosition)
 	}
-	return lrp, deleted
+	return lrp, deleted, nil
 }
 
 // Size returns how many key/value pairs in the index
@@ -71,11 +71,11 @@ func (t *arTree) Size() int {
 }
 
 // Iterator returns an iterator
-func (t *arTree) Iterator(reverse bool) Iterator {
+func (t *arTree) Iterator(reverse bool) (Iterator, error) {
 	t.lock.RLock()
 	defer t.lock.RUnlock()
 
-	return newARTreeIterator(t.tree, reverse)
+	return newARTreeIterator(t.tree, reverse), nil
 }
 
 func (t *arTree) Close() error {
@@ -2,6 +2,7 @@ package index
 
 import (
 	"path/filepath"
+	"sync/atomic"
 
 	"go.etcd.io/bbolt"
 
@@ -10,37 +11,49 @@ import (
 
 const BPlusTreeIndexFileName = "bplustree-index"
 
-var IndexBucketName = []byte("baradb-index")
+var (
+	IndexBucketName    = []byte("baradb-index")
+	MetadataBucketName = []byte("baradb-metadata")
+)
 
 // bplusTree represents a B+ Tree index
 type bplusTree struct {
 	tree *bbolt.DB
+	size int64 // Number of keys in the index, which is counted at opening to avoid failures of reading it
 }
 
-func newBPlusTree(directory string, syncWrites bool) *bplusTree {
+func newBPlusTree(directory string, syncWrites bool) (*bplusTree, error) {
 	opts := bbolt.DefaultOptions
 	opts.NoSync = !syncWrites
 	db, err := bbolt.Open(filepath.Join(directory, BPlusTreeIndexFileName), 0644, opts)
 	if err != nil {
-		panic("Failed to open a B+ tree")
+		return nil, wrapError(err)
 	}
 
+	var size int
 	err = db.Update(func(tx *bbolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(IndexBucketName)
+		bucket, err := tx.CreateBucketIfNotExists(IndexBucketName)
+		if err != nil {
+			return err
+		}
+		size = bucket.Stats().KeyN
+		_, err = tx.CreateBucketIfNotExists(MetadataBucketName)
 		return err
 	})
 	if err != nil {
-		panic("Failed to create a bucket in a B+ tree")
+		db.Close()
+		return nil, wrapError(err)
 	}
 
 	t := &bplusTree{
 		tree: db,
+		size: int64(size),
 	}
-	return t
+	return t, nil
 }
 
 // Put stores location of the corresponding data of the key in the index
-func (t *bplusTree) Put(key []byte, position *data.LogRecordPosition) *data.LogRecordPosition {
+func (t *bplusTree) Put(key []byte, position *data.LogRecordPosition) (*data.LogRecordPosition, error) {
 	var oldValue []byte
 	err := t.tree.Update(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(IndexBucketName)
@@ -48,17 +61,18 @@ func (t *bplusTree) Put(key []byte, position *data.LogRecordPosition) *data.LogR
 		return bucket.Put(key, data.EncodeLogRecordPosition(position))
 	})
 	if err != nil {
-		panic("Failed to put a value to a B+ tree")
+		return nil, wrapError(err)
 	}
 
 	if len(oldValue) > 0 {
-		return data.DecodeLogRecordPosition(oldValue)
+		return data.DecodeLogRecordPosition(oldValue), nil
 	}
-	return nil
+	atomic.AddInt64(&t.size, 1)
+	return nil, nil
 }
 
 // Get gets the location of the corresponding data af the key in the index
-func (t *bplusTree) Get(key []byte) *data.LogRecordPosition {
+func (t *bplusTree) Get(key []byte) (*data.LogRecordPosition, error) {
 	var lrp *data.LogRecordPosition
 	err := t.tree.View(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(IndexBucketName)
@@ -69,13 +83,13 @@ func (t *bplusTree) Get(key []byte) *data.LogRecordPosition {
 		return nil
 	})
 	if err != nil {
-		panic("Failed to get a value from a B+ tree")
+		return nil, wrapError(err)
 	}
-	return lrp
+	return lrp, nil
 }
 
 // Delete deletes the location of the corresponding data of the key in the index
-func (t *bplusTree) Delete(key []byte) (*data.LogRecordPosition, bool) {
+func (t *bplusTree) Delete(key []byte) (*data.LogRecordPosition, bool, error) {
 	var ok bool
 	var oldValue []byte
 	err := t.tree.Update(func(tx *bbolt.Tx) error {
@@ -88,35 +102,58 @@ func (t *bplusTree) Delete(key []byte) (*data.LogRecordPosition, bool) {
 		return nil
 	})
 	if err != nil {
-		panic("Failed to delete a value from a B+ tree")
+		return nil, false, wrapError(err)
 	}
 
 	var lrp *data.LogRecordPosition
 	if ok {
 		lrp = data.DecodeLogRecordPosition(oldValue)
+		atomic.AddInt64(&t.size, -1)
 	}
-	return lrp, ok
+	return lrp, ok, nil
 }
 
 // Size returns how many key/value pairs in the index
 func (t *bplusTree) Size() int {
-	var size int
+	return int(atomic.LoadInt64(&t.size))
+}
+
+// PutMetadata stores a value of metadata in a bucket apart from the index
+func (t *bplusTree) PutMetadata(key, value []byte) error {
+	err := t.tree.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(MetadataBucketName).Put(key, value)
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+	return nil
+}
+
+// GetMetadata returns a value of metadata from a bucket apart from the index
+func (t *bplusTree) GetMetadata(key []byte) ([]byte, error) {
+	var value []byte
 	err := t.tree.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(IndexBucketName)
-		size = bucket.Stats().KeyN
+		if v := tx.Bucket(MetadataBucketName).Get(key); v != nil {
+			// The value is only valid during the transaction
+			value = make([]byte, len(v))
+			copy(value, v)
+		}
 		return nil
 	})
 	if err != nil {
-		panic("Failed to get size of a B+ tree")
+		return nil, wrapError(err)
 	}
-	return size
+	return value, nil
 }
 
 // Iterator returns an iterator
-func (t *bplusTree) Iterator(reverse bool) Iterator {
+func (t *bplusTree) Iterator(reverse bool) (Iterator, error) {
 	return newBPlusTreeIterator(t.tree, reverse)
 }
 
 func (t *bplusTree) Close() error {
-	return t.tree.Close()
+	if err := t.tree.Close(); err != nil {
+		return wrapError(err)
+	}
+	return nil
 }
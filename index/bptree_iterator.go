@@ -14,10 +14,10 @@ type bplusTreeIterator struct {
 	currentValue []byte
 }
 
-func newBPlusTreeIterator(tree *bbolt.DB, reverse bool) *bplusTreeIterator {
+func newBPlusTreeIterator(tree *bbolt.DB, reverse bool) (*bplusTreeIterator, error) {
 	tx, err := tree.Begin(false)
 	if err != nil {
-		panic("Failed to begin a transaction")
+		return nil, wrapError(err)
 	}
 	cursor := tx.Bucket(IndexBucketName).Cursor()
 	iter := &bplusTreeIterator{
@@ -26,7 +26,7 @@ func newBPlusTreeIterator(tree *bbolt.DB, reverse bool) *bplusTreeIterator {
 		reverse: reverse,
 	}
 	iter.Rewind()
-	return iter
+	return iter, nil
 }
 
 func (iter *bplusTreeIterator) Rewind() {
@@ -61,9 +61,9 @@ func (iter *bplusTreeIterator) Value() *data.LogRecordPosition {
 	return data.DecodeLogRecordPosition(iter.currentValue)
 }
 
+// Close ends the read-only transaction of the iterator
+//
+// Rolling back a read-only transaction only fails if it has ended, so the error is ignored.
 func (iter *bplusTreeIterator) Close() {
-	err := iter.tx.Rollback()
-	if err != nil {
-		panic("Failed to rollback a transaction")
-	}
+	_ = iter.tx.Rollback()
 }
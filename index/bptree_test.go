@@ -27,7 +27,8 @@ func TestBPlusTree_New(t *testing.T) {
 	makeDirectory()
 	defer removeDirectory()
 
-	tree := newBPlusTree(directory, false)
+	tree, err := newBPlusTree(directory, false)
+	assert.Nil(t, err)
 	assert.NotNil(t, tree)
 }
 
@@ -35,12 +36,15 @@ func TestBPlusTree_Put(t *testing.T) {
 	makeDirectory()
 	defer removeDirectory()
 
-	tree := newBPlusTree(directory, false)
+	tree, err := newBPlusTree(directory, false)
+	assert.Nil(t, err)
 
 	var lrp *data.LogRecordPosition
-	lrp = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 0})
+	lrp, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 0})
+	assert.Nil(t, err)
 	assert.Nil(t, lrp)
-	lrp = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 1})
+	lrp, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 1})
+	assert.Nil(t, err)
 	assert.NotNil(t, lrp)
 }
 
@@ -48,16 +52,22 @@ func TestBPlusTree_Get(t *testing.T) {
 	makeDirectory()
 	defer removeDirectory()
 
-	tree := newBPlusTree(directory, false)
+	tree, err := newBPlusTree(directory, false)
+	assert.Nil(t, err)
 
 	var lrp *data.LogRecordPosition
-	lrp = tree.Get([]byte("114"))
+	lrp, err = tree.Get([]byte("114"))
+	assert.Nil(t, err)
 	assert.Nil(t, lrp)
-	tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 2})
-	lrp = tree.Get([]byte("114"))
+	_, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 2})
+	assert.Nil(t, err)
+	lrp, err = tree.Get([]byte("114"))
+	assert.Nil(t, err)
 	assert.True(t, lrp.FileID == uint32(114) && lrp.Offset == int64(2))
-	tree.Put([]byte("144"), &data.LogRecordPosition{FileID: 114, Offset: 3})
-	lrp = tree.Get([]byte("114"))
+	_, err = tree.Put([]byte("144"), &data.LogRecordPosition{FileID: 114, Offset: 3})
+	assert.Nil(t, err)
+	lrp, err = tree.Get([]byte("114"))
+	assert.Nil(t, err)
 	assert.True(t, lrp.FileID == uint32(114) && lrp.Offset == int64(2))
 }
 
@@ -65,18 +75,23 @@ func TestBPlusTree_Delete(t *testing.T) {
 	makeDirectory()
 	defer removeDirectory()
 
-	tree := newBPlusTree(directory, false)
+	tree, err := newBPlusTree(directory, false)
+	assert.Nil(t, err)
 
 	var ok bool
 	var lrp *data.LogRecordPosition
-	lrp, ok = tree.Delete([]byte("114"))
+	lrp, ok, err = tree.Delete([]byte("114"))
+	assert.Nil(t, err)
 	assert.Nil(t, lrp)
 	assert.False(t, ok)
-	tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 4})
-	lrp, ok = tree.Delete([]byte("114"))
+	_, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 4})
+	assert.Nil(t, err)
+	lrp, ok, err = tree.Delete([]byte("114"))
+	assert.Nil(t, err)
 	assert.NotNil(t, lrp)
 	assert.True(t, ok)
-	lrp, ok = tree.Delete([]byte("114"))
+	lrp, ok, err = tree.Delete([]byte("114"))
+	assert.Nil(t, err)
 	assert.Nil(t, lrp)
 	assert.False(t, ok)
 }
@@ -85,13 +100,16 @@ func TestBPlusTree_Size(t *testing.T) {
 	makeDirectory()
 	defer removeDirectory()
 
-	tree := newBPlusTree(directory, false)
+	tree, err := newBPlusTree(directory, false)
+	assert.Nil(t, err)
 	assert.Zero(t, tree.Size())
 
-	tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 5})
+	_, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 5})
+	assert.Nil(t, err)
 	assert.True(t, tree.Size() == 1)
 
-	tree.Delete([]byte("114"))
+	_, _, err = tree.Delete([]byte("114"))
+	assert.Nil(t, err)
 	assert.Zero(t, tree.Size())
 }
 
@@ -100,9 +118,11 @@ func TestBPlusTreeIterator_New1(t *testing.T) {
 	defer removeDirectory()
 
 	// The index has no key
-	tree := newBPlusTree(directory, false)
+	tree, err := newBPlusTree(directory, false)
+	assert.Nil(t, err)
 
-	iter1 := tree.Iterator(false)
+	iter1, err := tree.Iterator(false)
+	assert.Nil(t, err)
 	defer iter1.Close()
 	assert.False(t, iter1.Valid())
 }
@@ -112,10 +132,13 @@ func TestBPlusTreeIterator_New2(t *testing.T) {
 	defer removeDirectory()
 
 	// The index has one key
-	tree := newBPlusTree(directory, false)
-	tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
+	tree, err := newBPlusTree(directory, false)
+	assert.Nil(t, err)
+	_, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
+	assert.Nil(t, err)
 
-	iter2 := tree.Iterator(false)
+	iter2, err := tree.Iterator(false)
+	assert.Nil(t, err)
 	defer iter2.Close()
 
 	assert.True(t, iter2.Valid())
@@ -129,17 +152,20 @@ func TestBPlusTreeIterator_New3(t *testing.T) {
 	makeDirectory()
 	defer removeDirectory()
 
-	tree := newBPlusTree(directory, false)
+	tree, err := newBPlusTree(directory, false)
+	assert.Nil(t, err)
 
 	// The index has more keys
 	var count int = 20
 	for i := 1; i <= count; i++ {
-		tree.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: int64(i)})
+		_, err = tree.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: int64(i)})
+		assert.Nil(t, err)
 	}
 
 	var index int = 1
 
-	iter3 := tree.Iterator(false)
+	iter3, err := tree.Iterator(false)
+	assert.Nil(t, err)
 	defer iter3.Close()
 	for iter3.Rewind(); iter3.Valid(); iter3.Next() {
 		assert.True(t, strings.HasSuffix(string(iter3.Key()), fmt.Sprintf("%d", index)))
@@ -148,7 +174,8 @@ func TestBPlusTreeIterator_New3(t *testing.T) {
 			index++
 		}
 	}
-	iter4 := tree.Iterator(true)
+	iter4, err := tree.Iterator(true)
+	assert.Nil(t, err)
 	defer iter4.Close()
 	for iter4.Rewind(); iter4.Valid(); iter4.Next() {
 		assert.True(t, strings.HasSuffix(string(iter4.Key()), fmt.Sprintf("%d", index)))
@@ -161,13 +188,16 @@ func TestBPlusTreeIterator_Seek(t *testing.T) {
 	makeDirectory()
 	defer removeDirectory()
 
-	tree := newBPlusTree(directory, false)
+	tree, err := newBPlusTree(directory, false)
+	assert.Nil(t, err)
 
 	for i := 1; i <= 10; i++ {
-		tree.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: 514})
+		_, err = tree.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: 514})
+		assert.Nil(t, err)
 	}
 
-	iter1 := tree.Iterator(false)
+	iter1, err := tree.Iterator(false)
+	assert.Nil(t, err)
 	defer iter1.Close()
 	var index int = 1
 	for iter1.Seek([]byte("aaa")); iter1.Valid(); iter1.Next() {
@@ -178,7 +208,8 @@ func TestBPlusTreeIterator_Seek(t *testing.T) {
 		}
 	}
 
-	iter2 := tree.Iterator(true)
+	iter2, err := tree.Iterator(true)
+	assert.Nil(t, err)
 	defer iter2.Close()
 	for iter2.Seek([]byte("zzz")); iter2.Valid(); iter2.Next() {
 		// From 10 to 1
@@ -186,3 +217,64 @@ func TestBPlusTreeIterator_Seek(t *testing.T) {
 		index--
 	}
 }
+
+func TestBPlusTree_Metadata(t *testing.T) {
+	makeDirectory()
+	defer removeDirectory()
+
+	tree, err := newBPlusTree(directory, false)
+	assert.Nil(t, err)
+
+	value, err := tree.GetMetadata([]byte("tran-no"))
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+
+	err = tree.PutMetadata([]byte("tran-no"), []byte("114"))
+	assert.Nil(t, err)
+	// Metadata is not counted as keys of the index
+	assert.Zero(t, tree.Size())
+
+	tree.Close()
+	tree, err = newBPlusTree(directory, false)
+	assert.Nil(t, err)
+	defer tree.Close()
+	value, err = tree.GetMetadata([]byte("tran-no"))
+	assert.Nil(t, err)
+	assert.Equal(t, "114", string(value))
+}
+
+func TestBPlusTree_Errors(t *testing.T) {
+	makeDirectory()
+	defer removeDirectory()
+
+	// The number of keys is counted again after reopening
+	tree, err := newBPlusTree(directory, false)
+	assert.Nil(t, err)
+	for i := 1; i <= 10; i++ {
+		_, err = tree.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: int64(i)})
+		assert.Nil(t, err)
+	}
+	_, _, err = tree.Delete(utils.NewKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, 9, tree.Size())
+	assert.Nil(t, tree.Close())
+	tree, err = newBPlusTree(directory, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, tree.Size())
+
+	// Failures of I/O are returned once the file is closed
+	assert.Nil(t, tree.Close())
+	_, err = tree.Put(utils.NewKey(1), &data.LogRecordPosition{FileID: 114, Offset: 1})
+	assert.ErrorIs(t, err, ErrIndexIOFailed)
+	_, err = tree.Get(utils.NewKey(1))
+	assert.ErrorIs(t, err, ErrIndexIOFailed)
+	_, _, err = tree.Delete(utils.NewKey(1))
+	assert.ErrorIs(t, err, ErrIndexIOFailed)
+	_, err = tree.Iterator(false)
+	assert.ErrorIs(t, err, ErrIndexIOFailed)
+
+	// A file which is not a B+ tree is corrupted
+	assert.Nil(t, os.WriteFile(filepath.Join(directory, BPlusTreeIndexFileName), make([]byte, 64*1024), 0644))
+	_, err = newBPlusTree(directory, false)
+	assert.ErrorIs(t, err, ErrIndexCorrupted)
+}
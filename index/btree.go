@@ -40,7 +40,7 @@ func newBTree() *bTree {
 // Put puts a given key and its corresponding position to a B tree index
 //
 // It returns the old postion if the given key already exists in the index and nil otherwise.
-func (bt *bTree) Put(key []byte, position *data.LogRecordPosition) *data.LogRecordPosition {
+func (bt *bTree) Put(key []byte, position *data.LogRecordPosition) (*data.LogRecordPosition, error) {
 	x := &bTreeItem{
 		key:      key,
 		position: position,
@@ -49,30 +49,35 @@ func (bt *bTree) Put(key []byte, position *data.LogRecordPosition) *data.LogReco
 	oldItem := bt.tree.ReplaceOrInsert(x)
 	bt.lock.Unlock()
 	if oldItem == nil {
-		return nil
+		return nil, nil
 	}
-	return oldItem.(*bTreeItem).position
+	return oldItem.(*bTreeItem).position, nil
 }
 
 // Get returns corresponding position of the given key from the index
-func (bt *bTree) Get(key []byte) *data.LogRecordPosition {
+func (bt *bTree) Get(key []byte) (*data.LogRecordPosition, error) {
 	x := &bTreeItem{
 		key: key,
 	}
+	bt.lock.RLock()
 	y := bt.tree.Get(x)
+	bt.lock.RUnlock()
 	if y == nil {
-		return nil
+		return nil, nil
 	}
-	return y.(*bTreeItem).position
+	return y.(*bTreeItem).position, nil
 }
 
 // Size returns how many key/value pairs in the BTree
 func (bt *bTree) Size() int {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
+
 	return bt.tree.Len()
 }
 
 // Delete deletes a key from the B tree index
-func (bt *bTree) Delete(key []byte) (*data.LogRecordPosition, bool) {
+func (bt *bTree) Delete(key []byte) (*data.LogRecordPosition, bool, error) {
 	x := &bTreeItem{
 		key: key,
 	}
@@ -80,20 +85,16 @@ func (bt *bTree) Delete(key []byte) (*data.LogRecordPosition, bool) {
 	y := bt.tree.Delete(x)
 	bt.lock.Unlock()
 	if y == nil {
-		return nil, false
+		return nil, false, nil
 	}
-	return y.(*bTreeItem).position, true
+	return y.(*bTreeItem).position, true, nil
 }
 
-func (bt *bTree) Iterator(reverse bool) Iterator {
-	if bt.tree == nil {
-		return nil
-	}
-
-	bt.lock.Lock()
-	defer bt.lock.Unlock()
+func (bt *bTree) Iterator(reverse bool) (Iterator, error) {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
 
-	return newBTreeIterator(bt.tree, reverse)
+	return newBTreeIterator(bt.tree, reverse), nil
 }
 
 func (bt *bTree) Close() error {
@@ -12,20 +12,24 @@ import (
 )
 
 func TestBTree_Put(t *testing.T) {
+	var err error
 	bt := newBTree()
 
 	var lrp *data.LogRecordPosition
 
 	// Put a nil key
-	lrp = bt.Put(nil, &data.LogRecordPosition{FileID: 1, Offset: 100})
+	lrp, err = bt.Put(nil, &data.LogRecordPosition{FileID: 1, Offset: 100})
+	assert.Nil(t, err)
 	assert.Nil(t, lrp)
 
 	// Put a non-nil key and a value
-	lrp = bt.Put([]byte("a"), &data.LogRecordPosition{FileID: 2, Offset: 10})
+	lrp, err = bt.Put([]byte("a"), &data.LogRecordPosition{FileID: 2, Offset: 10})
+	assert.Nil(t, err)
 	assert.Nil(t, lrp)
 
 	// Update the value of a key
-	lrp = bt.Put([]byte("a"), &data.LogRecordPosition{FileID: 3, Offset: 30})
+	lrp, err = bt.Put([]byte("a"), &data.LogRecordPosition{FileID: 3, Offset: 30})
+	assert.Nil(t, err)
 	assert.True(t, lrp.FileID == 2)
 	assert.True(t, lrp.Offset == 10)
 }
@@ -33,19 +37,24 @@ func TestBTree_Put(t *testing.T) {
 func TestBTree_Get(t *testing.T) {
 	bt := newBTree()
 
-	res1 := bt.Put(nil, &data.LogRecordPosition{FileID: 1, Offset: 100})
+	res1, err := bt.Put(nil, &data.LogRecordPosition{FileID: 1, Offset: 100})
+	assert.Nil(t, err)
 	assert.Nil(t, res1)
 
-	pos1 := bt.Get(nil)
+	pos1, err := bt.Get(nil)
+	assert.Nil(t, err)
 	assert.Equal(t, uint32(1), pos1.FileID)
 	assert.Equal(t, int64(100), pos1.Offset)
 
-	res2 := bt.Put([]byte("a"), &data.LogRecordPosition{FileID: 2, Offset: 10})
+	res2, err := bt.Put([]byte("a"), &data.LogRecordPosition{FileID: 2, Offset: 10})
+	assert.Nil(t, err)
 	assert.Nil(t, res2)
-	res3 := bt.Put([]byte("a"), &data.LogRecordPosition{FileID: 2, Offset: 99})
+	res3, err := bt.Put([]byte("a"), &data.LogRecordPosition{FileID: 2, Offset: 99})
+	assert.Nil(t, err)
 	assert.NotNil(t, res3)
 
-	pos2 := bt.Get([]byte("a"))
+	pos2, err := bt.Get([]byte("a"))
+	assert.Nil(t, err)
 	assert.Equal(t, uint32(2), pos2.FileID)
 	assert.Equal(t, int64(99), pos2.Offset)
 }
@@ -53,17 +62,21 @@ func TestBTree_Get(t *testing.T) {
 func TestBTree_Delete(t *testing.T) {
 	bt := newBTree()
 
-	res1 := bt.Put(nil, &data.LogRecordPosition{FileID: 114, Offset: 514})
+	res1, err := bt.Put(nil, &data.LogRecordPosition{FileID: 114, Offset: 514})
+	assert.Nil(t, err)
 	assert.Nil(t, res1)
 
-	res2, ok2 := bt.Delete(nil)
+	res2, ok2, err := bt.Delete(nil)
+	assert.Nil(t, err)
 	assert.NotNil(t, res2)
 	assert.True(t, ok2)
 
-	res3 := bt.Put([]byte("homo"), &data.LogRecordPosition{FileID: 114, Offset: 1919})
+	res3, err := bt.Put([]byte("homo"), &data.LogRecordPosition{FileID: 114, Offset: 1919})
+	assert.Nil(t, err)
 	assert.Nil(t, res3)
 
-	res4, ok4 := bt.Delete([]byte("homo"))
+	res4, ok4, err := bt.Delete([]byte("homo"))
+	assert.Nil(t, err)
 	assert.NotNil(t, res4)
 	assert.True(t, ok4)
 }
@@ -72,12 +85,15 @@ func TestBTreeIterator_New(t *testing.T) {
 	bt1 := newBTree()
 
 	// The index has no key
-	bti1 := bt1.Iterator(false)
+	bti1, err := bt1.Iterator(false)
+	assert.Nil(t, err)
 	assert.False(t, bti1.Valid())
 
 	// The index has one key
-	bt1.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
-	bti2 := bt1.Iterator(false)
+	_, err = bt1.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
+	assert.Nil(t, err)
+	bti2, err := bt1.Iterator(false)
+	assert.Nil(t, err)
 	assert.True(t, bti2.Valid())
 	assert.NotNil(t, bti2.Key())
 	assert.NotNil(t, bti2.Value())
@@ -86,14 +102,17 @@ func TestBTreeIterator_New(t *testing.T) {
 
 	// The indexe has more keys
 	for i := 1; i < 20; i++ {
-		bt1.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: 114})
+		_, err = bt1.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: 114})
+		assert.Nil(t, err)
 	}
-	bti3 := bt1.Iterator(false)
+	bti3, err := bt1.Iterator(false)
+	assert.Nil(t, err)
 	for bti3.Rewind(); bti3.Valid(); bti3.Next() {
 		assert.NotNil(t, bti3.Key())
 		assert.NotNil(t, bti3.Value())
 	}
-	bti4 := bt1.Iterator(true)
+	bti4, err := bt1.Iterator(true)
+	assert.Nil(t, err)
 	for bti4.Rewind(); bti4.Valid(); bti4.Next() {
 		assert.NotNil(t, bti4.Key())
 		assert.NotNil(t, bti4.Value())
@@ -101,12 +120,15 @@ func TestBTreeIterator_New(t *testing.T) {
 }
 
 func TestBTreeIterator_Seek(t *testing.T) {
+	var err error
 	bt1 := newBTree()
 	for i := 1; i <= 10; i++ {
-		bt1.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: 514})
+		_, err = bt1.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: 514})
+		assert.Nil(t, err)
 	}
 
-	bti1 := bt1.Iterator(false)
+	bti1, err := bt1.Iterator(false)
+	assert.Nil(t, err)
 	var index int = 1
 	for bti1.Seek([]byte("aaa")); bti1.Valid(); bti1.Next() {
 		// From 1 to 10
@@ -116,7 +138,8 @@ func TestBTreeIterator_Seek(t *testing.T) {
 		}
 	}
 
-	bti2 := bt1.Iterator(true)
+	bti2, err := bt1.Iterator(true)
+	assert.Nil(t, err)
 	for bti2.Seek([]byte("zzz")); bti2.Valid(); bti2.Next() {
 		// From 10 to 1
 		assert.True(t, strings.HasSuffix(string(bti2.Key()), fmt.Sprintf("%d", index)))
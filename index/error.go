@@ -0,0 +1,31 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/saint-yellow/baradb/data"
+)
+
+var (
+	ErrUnsupportedIndexType = errors.New("unsupported index type")
+	ErrKeyReaderRequired    = errors.New("a fingerprint index requires a key reader")
+	ErrIndexCorrupted       = errors.New("the index is corrupted")
+	ErrIndexIOFailed        = errors.New("failed to access the storage of the index")
+)
+
+// wrapError marks an error of the storage of an index as corruption, or as a failure of I/O otherwise
+func wrapError(err error) error {
+	switch {
+	case errors.Is(err, ErrIndexCorrupted), errors.Is(err, ErrIndexIOFailed):
+		return err
+	case errors.Is(err, data.ErrInvalidCRC), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, bbolt.ErrInvalid), errors.Is(err, bbolt.ErrChecksum), errors.Is(err, bbolt.ErrVersionMismatch):
+		return fmt.Errorf("%w: %w", ErrIndexCorrupted, err)
+	default:
+		return fmt.Errorf("%w: %w", ErrIndexIOFailed, err)
+	}
+}
@@ -0,0 +1,267 @@
+package index
+
+import (
+	"bytes"
+	"hash/maphash"
+	"sort"
+	"sync"
+
+	"github.com/saint-yellow/baradb/data"
+)
+
+// fingerprintEntry is a compact form of a log record's position
+type fingerprintEntry struct {
+	fileID uint32
+	size   uint32
+	offset int64
+}
+
+func newFingerprintEntry(lrp *data.LogRecordPosition) fingerprintEntry {
+	return fingerprintEntry{
+		fileID: lrp.FileID,
+		size:   lrp.Size,
+		offset: lrp.Offset,
+	}
+}
+
+func (e fingerprintEntry) position() *data.LogRecordPosition {
+	return &data.LogRecordPosition{
+		FileID: e.fileID,
+		Offset: e.offset,
+		Size:   e.size,
+	}
+}
+
+// fingerprintIndex represents a memory-efficient index
+//
+// It only keeps a 64-bit fingerprint of every key and a compact position in memory.
+// Since different keys may share a fingerprint, the full key is read from the data file to confirm a match.
+// GetUnconfirmed skips the read unless the fingerprint is shared, so that a caller which reads the log record anyway
+// confirms the key without an extra disk read.
+// Put and Delete of an indexed fingerprint read the key, since an overwrite has to be told from a new colliding key.
+type fingerprintIndex struct {
+	entries     map[uint64]fingerprintEntry   // The first entry of every fingerprint
+	collisions  map[uint64][]fingerprintEntry // Other entries whose keys share a fingerprint with the first one
+	size        int                           // Number of keys in the index
+	lock        *sync.RWMutex
+	readKey     KeyReader
+	fingerprint func([]byte) uint64
+}
+
+func newFingerprintIndex(readKey KeyReader) (*fingerprintIndex, error) {
+	if readKey == nil {
+		return nil, ErrKeyReaderRequired
+	}
+
+	seed := maphash.MakeSeed()
+	f := &fingerprintIndex{
+		entries:    make(map[uint64]fingerprintEntry),
+		collisions: make(map[uint64][]fingerprintEntry),
+		lock:       new(sync.RWMutex),
+		readKey:    readKey,
+		fingerprint: func(key []byte) uint64 {
+			return maphash.Bytes(seed, key)
+		},
+	}
+	return f, nil
+}
+
+// matches reports whether the log record of the given entry has the given key
+func (f *fingerprintIndex) matches(e fingerprintEntry, key []byte) (bool, error) {
+	k, err := f.readKey(e.position())
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(k, key), nil
+}
+
+// find returns the index of the entry of the given key in the colliding entries of its fingerprint,
+// where -1 means the first entry, and whether the entry is found
+func (f *fingerprintIndex) find(fp uint64, key []byte) (int, bool, error) {
+	e, ok := f.entries[fp]
+	if !ok {
+		return 0, false, nil
+	}
+	if ok, err := f.matches(e, key); err != nil || ok {
+		return -1, ok, err
+	}
+
+	for i, c := range f.collisions[fp] {
+		if ok, err := f.matches(c, key); err != nil || ok {
+			return i, ok, err
+		}
+	}
+	return 0, false, nil
+}
+
+// Put stores location of the corresponding data of the key in the index
+func (f *fingerprintIndex) Put(key []byte, position *data.LogRecordPosition) (*data.LogRecordPosition, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	fp := f.fingerprint(key)
+	newEntry := newFingerprintEntry(position)
+
+	i, found, err := f.find(fp, key)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !found:
+		if _, ok := f.entries[fp]; !ok {
+			f.entries[fp] = newEntry
+		} else {
+			f.collisions[fp] = append(f.collisions[fp], newEntry)
+		}
+		f.size++
+		return nil, nil
+	case i < 0:
+		e := f.entries[fp]
+		f.entries[fp] = newEntry
+		return e.position(), nil
+	default:
+		c := f.collisions[fp][i]
+		f.collisions[fp][i] = newEntry
+		return c.position(), nil
+	}
+}
+
+// GetUnconfirmed gets the location of the corresponding data of the key in the index,
+// and only confirms the key if its fingerprint is shared by other keys
+func (f *fingerprintIndex) GetUnconfirmed(key []byte) (*data.LogRecordPosition, bool, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	fp := f.fingerprint(key)
+	e, ok := f.entries[fp]
+	if !ok {
+		return nil, true, nil
+	}
+	if len(f.collisions[fp]) == 0 {
+		return e.position(), false, nil
+	}
+
+	i, found, err := f.find(fp, key)
+	if err != nil || !found {
+		return nil, true, err
+	}
+	if i < 0 {
+		return e.position(), true, nil
+	}
+	return f.collisions[fp][i].position(), true, nil
+}
+
+// Get gets the location of the corresponding data af the key in the index
+func (f *fingerprintIndex) Get(key []byte) (*data.LogRecordPosition, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	fp := f.fingerprint(key)
+	i, found, err := f.find(fp, key)
+	if err != nil || !found {
+		return nil, err
+	}
+	if i < 0 {
+		return f.entries[fp].position(), nil
+	}
+	return f.collisions[fp][i].position(), nil
+}
+
+// Delete deletes the location of the corresponding data of the key in the index
+func (f *fingerprintIndex) Delete(key []byte) (*data.LogRecordPosition, bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	fp := f.fingerprint(key)
+	i, found, err := f.find(fp, key)
+	if err != nil || !found {
+		return nil, false, err
+	}
+
+	collisions := f.collisions[fp]
+	if i < 0 {
+		e := f.entries[fp]
+		// Promote a colliding entry to be the first one
+		if len(collisions) > 0 {
+			f.entries[fp] = collisions[0]
+			f.setCollisions(fp, collisions[1:])
+		} else {
+			delete(f.entries, fp)
+		}
+		f.size--
+		return e.position(), true, nil
+	}
+
+	c := collisions[i]
+	f.setCollisions(fp, append(collisions[:i:i], collisions[i+1:]...))
+	f.size--
+	return c.position(), true, nil
+}
+
+// setCollisions replaces colliding entries of a fingerprint
+func (f *fingerprintIndex) setCollisions(fp uint64, collisions []fingerprintEntry) {
+	if len(collisions) == 0 {
+		delete(f.collisions, fp)
+		return
+	}
+	f.collisions[fp] = collisions
+}
+
+// Size returns how many key/value pairs in the index
+func (f *fingerprintIndex) Size() int {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.size
+}
+
+// Iterator returns an iterator
+//
+// Since the index does not keep keys, all keys are read from data files and sorted,
+// which makes creating an iterator expensive.
+func (f *fingerprintIndex) Iterator(reverse bool) (Iterator, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	values := make([]*bTreeItem, 0, f.size)
+	collect := func(e fingerprintEntry) error {
+		lrp := e.position()
+		key, err := f.readKey(lrp)
+		if err != nil {
+			return err
+		}
+		values = append(values, &bTreeItem{
+			key:      key,
+			position: lrp,
+		})
+		return nil
+	}
+	for fp, e := range f.entries {
+		if err := collect(e); err != nil {
+			return nil, err
+		}
+		for _, c := range f.collisions[fp] {
+			if err := collect(c); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		if reverse {
+			return bytes.Compare(values[i].key, values[j].key) > 0
+		}
+		return bytes.Compare(values[i].key, values[j].key) < 0
+	})
+
+	iter := &bTreeIterator{
+		currentIndex: 0,
+		reverse:      reverse,
+		values:       values,
+	}
+	return iter, nil
+}
+
+func (f *fingerprintIndex) Close() error {
+	return nil
+}
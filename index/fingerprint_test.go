@@ -0,0 +1,235 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/saint-yellow/baradb/data"
+	"github.com/saint-yellow/baradb/utils"
+)
+
+// fakeDataFiles simulates data files from which a fingerprint index reads keys
+type fakeDataFiles map[string][]byte
+
+func (files fakeDataFiles) write(key []byte, lrp *data.LogRecordPosition) *data.LogRecordPosition {
+	files[fmt.Sprintf("%d-%d", lrp.FileID, lrp.Offset)] = key
+	return lrp
+}
+
+func (files fakeDataFiles) readKey(lrp *data.LogRecordPosition) ([]byte, error) {
+	key, ok := files[fmt.Sprintf("%d-%d", lrp.FileID, lrp.Offset)]
+	if !ok {
+		return nil, errors.New("log record not found")
+	}
+	return key, nil
+}
+
+func TestFingerprintIndex_Put(t *testing.T) {
+	files := make(fakeDataFiles)
+	f, err := newFingerprintIndex(files.readKey)
+	assert.Nil(t, err)
+
+	var lrp *data.LogRecordPosition
+	lrp, err = f.Put([]byte("114"), files.write([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 0}))
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+	lrp, err = f.Put([]byte("114"), files.write([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 1}))
+	assert.Nil(t, err)
+	assert.NotNil(t, lrp)
+	assert.Equal(t, int64(0), lrp.Offset)
+	assert.Equal(t, 1, f.Size())
+}
+
+func TestFingerprintIndex_Get(t *testing.T) {
+	files := make(fakeDataFiles)
+	f, err := newFingerprintIndex(files.readKey)
+	assert.Nil(t, err)
+
+	lrp, err := f.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+	_, err = f.Put([]byte("114"), files.write([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 2, Size: 14}))
+	assert.Nil(t, err)
+	lrp, err = f.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(114), lrp.FileID)
+	assert.Equal(t, int64(2), lrp.Offset)
+	assert.Equal(t, uint32(14), lrp.Size)
+	lrp, err = f.Get([]byte("514"))
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+}
+
+func TestFingerprintIndex_Delete(t *testing.T) {
+	files := make(fakeDataFiles)
+	f, err := newFingerprintIndex(files.readKey)
+	assert.Nil(t, err)
+
+	var ok bool
+	var lrp *data.LogRecordPosition
+	lrp, ok, err = f.Delete([]byte("114"))
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+	assert.False(t, ok)
+	_, err = f.Put([]byte("114"), files.write([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 4}))
+	assert.Nil(t, err)
+	lrp, ok, err = f.Delete([]byte("114"))
+	assert.Nil(t, err)
+	assert.NotNil(t, lrp)
+	assert.True(t, ok)
+	lrp, ok, err = f.Delete([]byte("114"))
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+	assert.False(t, ok)
+	assert.Zero(t, f.Size())
+}
+
+func TestFingerprintIndex_Collisions(t *testing.T) {
+	files := make(fakeDataFiles)
+	f, err := newFingerprintIndex(files.readKey)
+	assert.Nil(t, err)
+	// Every key shares the same fingerprint
+	f.fingerprint = func([]byte) uint64 {
+		return 114514
+	}
+
+	count := 10
+	for i := 1; i <= count; i++ {
+		key := utils.NewKey(i)
+		lrp, err := f.Put(key, files.write(key, &data.LogRecordPosition{FileID: 1, Offset: int64(i)}))
+		assert.Nil(t, err)
+		assert.Nil(t, lrp)
+	}
+	assert.Equal(t, count, f.Size())
+	assert.Equal(t, count-1, len(f.collisions[114514]))
+
+	for i := 1; i <= count; i++ {
+		lrp, err := f.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(i), lrp.Offset)
+	}
+	lrp, err := f.Get(utils.NewKey(count + 1))
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+
+	// Delete the first entry, then a colliding one takes its place
+	lrp, ok, err := f.Delete(utils.NewKey(1))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), lrp.Offset)
+	lrp, ok, err = f.Delete(utils.NewKey(5))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(5), lrp.Offset)
+	assert.Equal(t, count-2, f.Size())
+	for i := 2; i <= count; i++ {
+		lrp, err := f.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+		if i == 5 {
+			assert.Nil(t, lrp)
+			continue
+		}
+		assert.Equal(t, int64(i), lrp.Offset)
+	}
+}
+
+func TestFingerprintIndex_GetUnconfirmed(t *testing.T) {
+	files := make(fakeDataFiles)
+	reads := 0
+	f, err := newFingerprintIndex(func(lrp *data.LogRecordPosition) ([]byte, error) {
+		reads++
+		return files.readKey(lrp)
+	})
+	assert.Nil(t, err)
+	fingerprints := map[string]uint64{"114": 1, "514": 2, "1919": 2}
+	f.fingerprint = func(key []byte) uint64 {
+		return fingerprints[string(key)]
+	}
+
+	lrp, confirmed, err := f.GetUnconfirmed([]byte("114"))
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+	assert.True(t, confirmed)
+
+	// A fingerprint of a single key is not confirmed, so no key is read
+	_, err = f.Put([]byte("114"), files.write([]byte("114"), &data.LogRecordPosition{FileID: 1, Offset: 1}))
+	assert.Nil(t, err)
+	reads = 0
+	lrp, confirmed, err = f.GetUnconfirmed([]byte("114"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), lrp.Offset)
+	assert.False(t, confirmed)
+	assert.Zero(t, reads)
+
+	// A shared fingerprint is confirmed by reading keys
+	_, err = f.Put([]byte("514"), files.write([]byte("514"), &data.LogRecordPosition{FileID: 1, Offset: 2}))
+	assert.Nil(t, err)
+	_, err = f.Put([]byte("1919"), files.write([]byte("1919"), &data.LogRecordPosition{FileID: 1, Offset: 3}))
+	assert.Nil(t, err)
+	reads = 0
+	lrp, confirmed, err = f.GetUnconfirmed([]byte("1919"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), lrp.Offset)
+	assert.True(t, confirmed)
+	assert.Positive(t, reads)
+}
+
+func TestFingerprintIndexIterator(t *testing.T) {
+	files := make(fakeDataFiles)
+	f, err := newFingerprintIndex(files.readKey)
+	assert.Nil(t, err)
+
+	iter1, err := f.Iterator(false)
+	assert.Nil(t, err)
+	assert.False(t, iter1.Valid())
+
+	count := 20
+	for i := 1; i <= count; i++ {
+		key := utils.NewKey(i)
+		_, err = f.Put(key, files.write(key, &data.LogRecordPosition{FileID: 1, Offset: int64(i)}))
+		assert.Nil(t, err)
+	}
+
+	// Keys are read from data files and sorted
+	index := 1
+	iter2, err := f.Iterator(false)
+	assert.Nil(t, err)
+	for iter2.Rewind(); iter2.Valid(); iter2.Next() {
+		assert.Equal(t, utils.NewKey(index), iter2.Key())
+		assert.Equal(t, int64(index), iter2.Value().Offset)
+		index++
+	}
+	assert.Equal(t, count+1, index)
+
+	iter3, err := f.Iterator(true)
+	assert.Nil(t, err)
+	for iter3.Seek(utils.NewKey(10)); iter3.Valid(); iter3.Next() {
+		index--
+	}
+	assert.Equal(t, 11, index)
+}
+
+func TestFingerprintIndex_Errors(t *testing.T) {
+	_, err := newFingerprintIndex(nil)
+	assert.Equal(t, ErrKeyReaderRequired, err)
+
+	// Failures of reading keys are returned
+	files := make(fakeDataFiles)
+	f, err := newFingerprintIndex(files.readKey)
+	assert.Nil(t, err)
+	_, err = f.Put([]byte("114"), files.write([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 0}))
+	assert.Nil(t, err)
+	delete(files, "114-0")
+	_, err = f.Get([]byte("114"))
+	assert.NotNil(t, err)
+	_, err = f.Put([]byte("114"), files.write([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 1}))
+	assert.NotNil(t, err)
+	_, _, err = f.Delete([]byte("114"))
+	assert.NotNil(t, err)
+	_, err = f.Iterator(false)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, f.Size())
+}
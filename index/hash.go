@@ -0,0 +1,309 @@
+package index
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/saint-yellow/baradb/data"
+)
+
+const HashIndexFileName = "hash-index"
+
+// Types of records in the journal of a hash index
+//
+// They are apart from types of log records in data files, which are added as the data format evolves.
+// The metadata type takes the largest value which flags of log records leave.
+const (
+	hashCompactedRecord data.LogRecordType = 0    // hashCompactedRecord A record which stores a key and its position, written as a hint record by the compaction
+	hashEntryRecord     data.LogRecordType = 1    // hashEntryRecord A record which stores a key and its position
+	hashDeletedRecord   data.LogRecordType = 2    // hashDeletedRecord A record which deletes a key
+	hashMetadataRecord  data.LogRecordType = 0x0f // hashMetadataRecord A record which stores metadata
+)
+
+// hashIndexCompactionFactor indicates how many times the journal of a hash index may be larger than its live entries
+// before it gets compacted
+const hashIndexCompactionFactor = 2
+
+// hashIndex represents a persistent hash index
+//
+// Entries live in a hash table in memory, so Put, Get and Delete are O(1).
+// Every modification is appended to a journal on the disk,
+// so a DB engine can restore the index from the journal instead of replaying its data files.
+//
+// A hash index keeps no order of its keys, so its iterator scans keys in an unspecified order.
+type hashIndex struct {
+	entries    map[string]*data.LogRecordPosition
+	metadata   map[string][]byte
+	lock       *sync.RWMutex
+	directory  string         // directory where the journal is stored in
+	journal    *data.DataFile // append-only journal of the modifications
+	records    int            // number of records in the journal
+	syncWrites bool           // whether sync the journal after every modification
+	cipher     *data.Cipher   // encrypts records in the journal, it is nil if encryption is disabled
+}
+
+func newHashIndex(directory string, syncWrites bool, cipher *data.Cipher) (*hashIndex, error) {
+	h := &hashIndex{
+		entries:    make(map[string]*data.LogRecordPosition),
+		metadata:   make(map[string][]byte),
+		lock:       new(sync.RWMutex),
+		directory:  directory,
+		syncWrites: syncWrites,
+		cipher:     cipher,
+	}
+
+	journal, err := data.OpenIndexFile(directory, HashIndexFileName)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	journal.SetCipher(cipher)
+	h.journal = journal
+
+	if err := h.load(); err != nil {
+		journal.Close()
+		return nil, wrapError(err)
+	}
+
+	if h.needCompaction() {
+		if err := h.compact(); err != nil {
+			h.journal.Close()
+			return nil, wrapError(err)
+		}
+	}
+
+	return h, nil
+}
+
+// load replays the journal to restore the entries
+func (h *hashIndex) load() error {
+	var offset int64 = 0
+	for {
+		lr, n, err := h.journal.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+
+		key := string(lr.Key)
+		switch lr.Type {
+		case hashCompactedRecord, hashEntryRecord:
+			h.entries[key] = data.DecodeLogRecordPosition(lr.Value)
+		case hashDeletedRecord:
+			delete(h.entries, key)
+		case hashMetadataRecord:
+			h.metadata[key] = lr.Value
+		default:
+			return fmt.Errorf("%w: unknown type %d of a record in the journal", ErrIndexCorrupted, lr.Type)
+		}
+
+		h.records++
+		offset += n
+	}
+	h.journal.WriteOffset = offset
+
+	// Discard a torn record at the end of the journal, which was being appended when the DB engine crashed,
+	// since the journal is opened for appending and later records would follow it
+	size, err := h.journal.Size()
+	if err != nil {
+		return err
+	}
+	if size > offset {
+		return h.journal.Truncate(offset)
+	}
+	return nil
+}
+
+// needCompaction reports whether the journal holds too many outdated records
+func (h *hashIndex) needCompaction() bool {
+	return h.records > hashIndexCompactionFactor*(len(h.entries)+len(h.metadata))
+}
+
+// compact rewrites the journal with the live entries only
+func (h *hashIndex) compact() error {
+	tempFileName := HashIndexFileName + ".tmp"
+	tempFilePath := filepath.Join(h.directory, tempFileName)
+	if err := os.RemoveAll(tempFilePath); err != nil {
+		return err
+	}
+
+	tempFile, err := data.OpenIndexFile(h.directory, tempFileName)
+	if err != nil {
+		return err
+	}
+	tempFile.SetCipher(h.cipher)
+	for key, lrp := range h.entries {
+		if err := data.WriteHintRecord(tempFile, []byte(key), lrp); err != nil {
+			return err
+		}
+	}
+	for key, value := range h.metadata {
+		elr, _, err := tempFile.EncodeLogRecord(&data.LogRecord{
+			Key:   []byte(key),
+			Value: value,
+			Type:  hashMetadataRecord,
+		})
+		if err != nil {
+			return err
+		}
+		if err := tempFile.Write(elr); err != nil {
+			return err
+		}
+	}
+	if err := tempFile.Sync(); err != nil {
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+
+	if err := h.journal.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFilePath, filepath.Join(h.directory, HashIndexFileName)); err != nil {
+		return err
+	}
+
+	journal, err := data.OpenIndexFile(h.directory, HashIndexFileName)
+	if err != nil {
+		return err
+	}
+	journal.SetCipher(h.cipher)
+	h.journal = journal
+	h.records = len(h.entries) + len(h.metadata)
+	return nil
+}
+
+// appendRecord appends a modification to the journal
+func (h *hashIndex) appendRecord(lr *data.LogRecord) error {
+	elr, _, err := h.journal.EncodeLogRecord(lr)
+	if err != nil {
+		return err
+	}
+	if err := h.journal.Write(elr); err != nil {
+		return err
+	}
+	h.records++
+
+	if h.syncWrites {
+		return h.journal.Sync()
+	}
+	return nil
+}
+
+// Put stores location of the corresponding data of the key in the index
+func (h *hashIndex) Put(key []byte, position *data.LogRecordPosition) (*data.LogRecordPosition, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	err := h.appendRecord(&data.LogRecord{
+		Key:   key,
+		Value: data.EncodeLogRecordPosition(position),
+		Type:  hashEntryRecord,
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	oldValue := h.entries[string(key)]
+	h.entries[string(key)] = position
+	return oldValue, nil
+}
+
+// Get gets the location of the corresponding data af the key in the index
+func (h *hashIndex) Get(key []byte) (*data.LogRecordPosition, error) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return h.entries[string(key)], nil
+}
+
+// Delete deletes the location of the corresponding data of the key in the index
+func (h *hashIndex) Delete(key []byte) (*data.LogRecordPosition, bool, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	oldValue, ok := h.entries[string(key)]
+	if !ok {
+		return nil, false, nil
+	}
+
+	err := h.appendRecord(&data.LogRecord{
+		Key:  key,
+		Type: hashDeletedRecord,
+	})
+	if err != nil {
+		return nil, false, wrapError(err)
+	}
+
+	delete(h.entries, string(key))
+	return oldValue, true, nil
+}
+
+// Size returns how many key/value pairs in the index
+func (h *hashIndex) Size() int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return len(h.entries)
+}
+
+// PutMetadata stores a value of metadata, which is journaled as well as entries
+func (h *hashIndex) PutMetadata(key, value []byte) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	err := h.appendRecord(&data.LogRecord{
+		Key:   key,
+		Value: value,
+		Type:  hashMetadataRecord,
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+
+	h.metadata[string(key)] = value
+	return nil
+}
+
+// GetMetadata returns a value of metadata
+func (h *hashIndex) GetMetadata(key []byte) ([]byte, error) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return h.metadata[string(key)], nil
+}
+
+// Iterator returns an iterator
+//
+// The iterator scans keys in an unspecified order, and the order does not change if it is reversed.
+func (h *hashIndex) Iterator(reverse bool) (Iterator, error) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return newHashIndexIterator(h.entries, reverse), nil
+}
+
+// Close compacts the journal if necessary and closes it
+func (h *hashIndex) Close() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.needCompaction() {
+		if err := h.compact(); err != nil {
+			return wrapError(err)
+		}
+	}
+
+	if err := h.journal.Sync(); err != nil {
+		return wrapError(err)
+	}
+	if err := h.journal.Close(); err != nil {
+		return wrapError(err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package index
+
+import (
+	"bytes"
+
+	"github.com/saint-yellow/baradb/data"
+)
+
+// An iterator of a hash index
+//
+// It scans a snapshot of the index in an unspecified order.
+type hashIndexIterator struct {
+	currentIndex int          // current iterated location
+	reverse      bool         // whether enable reverse iteration
+	values       []*bTreeItem // locations
+}
+
+func newHashIndexIterator(entries map[string]*data.LogRecordPosition, reverse bool) *hashIndexIterator {
+	values := make([]*bTreeItem, 0, len(entries))
+	for key, lrp := range entries {
+		values = append(values, &bTreeItem{
+			key:      []byte(key),
+			position: lrp,
+		})
+	}
+
+	iter := &hashIndexIterator{
+		currentIndex: 0,
+		reverse:      reverse,
+		values:       values,
+	}
+	return iter
+}
+
+func (iter *hashIndexIterator) Rewind() {
+	iter.currentIndex = 0
+}
+
+// Seek moves to the first key in the scan which is greater than or equal to the given key,
+// or less than or equal to it when the iterator is reversed.
+//
+// Since the scan is unordered, keys after the found one are not guaranteed to match this condition.
+func (iter *hashIndexIterator) Seek(key []byte) {
+	for iter.currentIndex = 0; iter.Valid(); iter.Next() {
+		cmp := bytes.Compare(iter.values[iter.currentIndex].key, key)
+		if (!iter.reverse && cmp >= 0) || (iter.reverse && cmp <= 0) {
+			break
+		}
+	}
+}
+
+func (iter *hashIndexIterator) Next() {
+	iter.currentIndex += 1
+}
+
+func (iter *hashIndexIterator) Valid() bool {
+	return iter.currentIndex >= 0 && iter.currentIndex < len(iter.values)
+}
+
+func (iter *hashIndexIterator) Key() []byte {
+	return iter.values[iter.currentIndex].key
+}
+
+func (iter *hashIndexIterator) Value() *data.LogRecordPosition {
+	return iter.values[iter.currentIndex].position
+}
+
+func (iter *hashIndexIterator) Close() {
+	iter.values = nil
+}
@@ -0,0 +1,272 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/saint-yellow/baradb/data"
+	"github.com/saint-yellow/baradb/utils"
+)
+
+var hashIndexDirectory string = filepath.Join(os.TempDir(), "baradb-hash")
+
+func makeHashIndexDirectory() {
+	_ = os.MkdirAll(hashIndexDirectory, os.ModePerm)
+}
+
+func removeHashIndexDirectory() {
+	_ = os.RemoveAll(hashIndexDirectory)
+}
+
+func TestHashIndex_New(t *testing.T) {
+	makeHashIndexDirectory()
+	defer removeHashIndexDirectory()
+
+	h, err := newHashIndex(hashIndexDirectory, false, nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, h)
+	assert.FileExists(t, filepath.Join(hashIndexDirectory, HashIndexFileName))
+}
+
+func TestHashIndex_Put(t *testing.T) {
+	makeHashIndexDirectory()
+	defer removeHashIndexDirectory()
+
+	h, err := newHashIndex(hashIndexDirectory, false, nil)
+	assert.Nil(t, err)
+
+	var lrp *data.LogRecordPosition
+	lrp, err = h.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 0})
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+	lrp, err = h.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 1})
+	assert.Nil(t, err)
+	assert.NotNil(t, lrp)
+	assert.Equal(t, int64(0), lrp.Offset)
+}
+
+func TestHashIndex_Get(t *testing.T) {
+	makeHashIndexDirectory()
+	defer removeHashIndexDirectory()
+
+	h, err := newHashIndex(hashIndexDirectory, false, nil)
+	assert.Nil(t, err)
+
+	var lrp *data.LogRecordPosition
+	lrp, err = h.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+	_, err = h.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 2})
+	assert.Nil(t, err)
+	lrp, err = h.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.True(t, lrp.FileID == uint32(114) && lrp.Offset == int64(2))
+	_, err = h.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 3})
+	assert.Nil(t, err)
+	lrp, err = h.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.True(t, lrp.FileID == uint32(114) && lrp.Offset == int64(3))
+}
+
+func TestHashIndex_Delete(t *testing.T) {
+	makeHashIndexDirectory()
+	defer removeHashIndexDirectory()
+
+	h, err := newHashIndex(hashIndexDirectory, false, nil)
+	assert.Nil(t, err)
+
+	var ok bool
+	var lrp *data.LogRecordPosition
+	lrp, ok, err = h.Delete([]byte("114"))
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+	assert.False(t, ok)
+	_, err = h.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 4})
+	assert.Nil(t, err)
+	lrp, ok, err = h.Delete([]byte("114"))
+	assert.Nil(t, err)
+	assert.NotNil(t, lrp)
+	assert.True(t, ok)
+	lrp, ok, err = h.Delete([]byte("114"))
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+	assert.False(t, ok)
+}
+
+func TestHashIndex_Persistence(t *testing.T) {
+	makeHashIndexDirectory()
+	defer removeHashIndexDirectory()
+
+	h1, err := newHashIndex(hashIndexDirectory, false, nil)
+	assert.Nil(t, err)
+	for i := 1; i <= 100; i++ {
+		_, err = h1.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 1, Offset: int64(i)})
+		assert.Nil(t, err)
+	}
+	// Overwrite and delete some keys to make the journal compactable
+	for i := 1; i <= 100; i++ {
+		_, err = h1.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 2, Offset: int64(i)})
+		assert.Nil(t, err)
+	}
+	for i := 51; i <= 100; i++ {
+		_, _, err = h1.Delete(utils.NewKey(i))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, h1.Close())
+
+	// The journal is compacted when the index is closed
+	h2, err := newHashIndex(hashIndexDirectory, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 50, h2.Size())
+	assert.Equal(t, 50, h2.records)
+	for i := 1; i <= 50; i++ {
+		lrp, err := h2.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(2), lrp.FileID)
+		assert.Equal(t, int64(i), lrp.Offset)
+	}
+	for i := 51; i <= 100; i++ {
+		lrp, err := h2.Get(utils.NewKey(i))
+		assert.Nil(t, err)
+		assert.Nil(t, lrp)
+	}
+	assert.Nil(t, h2.Close())
+}
+
+func TestHashIndex_TornRecord(t *testing.T) {
+	makeHashIndexDirectory()
+	defer removeHashIndexDirectory()
+
+	h1, err := newHashIndex(hashIndexDirectory, false, nil)
+	assert.Nil(t, err)
+	for i := 1; i <= 10; i++ {
+		_, err = h1.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 1, Offset: int64(i)})
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, h1.Close())
+
+	// Crash while a record is being appended, so only a part of it is in the journal
+	elr, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   utils.NewKey(11),
+		Value: data.EncodeLogRecordPosition(&data.LogRecordPosition{FileID: 1, Offset: 11}),
+		Type:  hashEntryRecord,
+	})
+	file, err := os.OpenFile(filepath.Join(hashIndexDirectory, HashIndexFileName), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = file.Write(elr[:len(elr)-3])
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	// The torn record is discarded, and records appended after the relaunch are read by the next one
+	h2, err := newHashIndex(hashIndexDirectory, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, h2.Size())
+	_, err = h2.Put(utils.NewKey(12), &data.LogRecordPosition{FileID: 1, Offset: 12})
+	assert.Nil(t, err)
+	assert.Nil(t, h2.Close())
+
+	h3, err := newHashIndex(hashIndexDirectory, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 11, h3.Size())
+	lrp, err := h3.Get(utils.NewKey(12))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(12), lrp.Offset)
+	lrp, err = h3.Get(utils.NewKey(11))
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+	assert.Nil(t, h3.Close())
+}
+
+func TestHashIndexIterator(t *testing.T) {
+	makeHashIndexDirectory()
+	defer removeHashIndexDirectory()
+
+	h, err := newHashIndex(hashIndexDirectory, false, nil)
+	assert.Nil(t, err)
+
+	// The index has no key
+	iter1, err := h.Iterator(false)
+	assert.Nil(t, err)
+	assert.False(t, iter1.Valid())
+	iter1.Close()
+
+	// The index has more keys, which are scanned in an unspecified order
+	count := 20
+	for i := 1; i <= count; i++ {
+		_, err = h.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: int64(i)})
+		assert.Nil(t, err)
+	}
+	iter2, err := h.Iterator(false)
+	assert.Nil(t, err)
+	defer iter2.Close()
+	scanned := make(map[string]bool)
+	for iter2.Rewind(); iter2.Valid(); iter2.Next() {
+		assert.NotNil(t, iter2.Value())
+		scanned[string(iter2.Key())] = true
+	}
+	assert.Equal(t, count, len(scanned))
+
+	// Seek a key exists in the index
+	iter2.Seek(utils.NewKey(count))
+	assert.True(t, iter2.Valid())
+	assert.GreaterOrEqual(t, string(iter2.Key()), string(utils.NewKey(count)))
+}
+
+func TestHashIndex_Metadata(t *testing.T) {
+	makeHashIndexDirectory()
+	defer removeHashIndexDirectory()
+
+	h1, err := newHashIndex(hashIndexDirectory, false, nil)
+	assert.Nil(t, err)
+	value, err := h1.GetMetadata([]byte("tran-no"))
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+
+	for i := 1; i <= 10; i++ {
+		err = h1.PutMetadata([]byte("tran-no"), []byte(fmt.Sprintf("%d", i)))
+		assert.Nil(t, err)
+	}
+	assert.Zero(t, h1.Size())
+	assert.Nil(t, h1.Close())
+
+	// Metadata survives the compaction of the journal
+	h2, err := newHashIndex(hashIndexDirectory, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, h2.records)
+	value, err = h2.GetMetadata([]byte("tran-no"))
+	assert.Nil(t, err)
+	assert.Equal(t, "10", string(value))
+	assert.Nil(t, h2.Close())
+}
+
+func TestHashIndex_RecordTypes(t *testing.T) {
+	makeHashIndexDirectory()
+	defer removeHashIndexDirectory()
+
+	// Types of records in the journal do not take types of log records in data files
+	for _, lrType := range []data.LogRecordType{
+		data.TransactionFinishedLogRecord, data.MergeOperandLogRecord, data.RangeTombstoneLogRecord,
+	} {
+		assert.NotEqual(t, hashMetadataRecord, lrType)
+	}
+
+	// A record of an unknown type is regarded as corruption rather than an entry
+	journal, err := data.OpenIndexFile(hashIndexDirectory, HashIndexFileName)
+	assert.Nil(t, err)
+	elr, _, err := journal.EncodeLogRecord(&data.LogRecord{
+		Key:   []byte("tran-no"),
+		Value: []byte("1"),
+		Type:  data.MergeOperandLogRecord,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, journal.Write(elr))
+	assert.Nil(t, journal.Close())
+
+	_, err = newHashIndex(hashIndexDirectory, false, nil)
+	assert.ErrorIs(t, err, ErrIndexCorrupted)
+	assert.NotErrorIs(t, err, ErrIndexIOFailed)
+}
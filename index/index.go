@@ -8,24 +8,26 @@ import (
 //
 // An index stores key/value pairs.
 // A key is the key of a log record, and a value is a log record's position in a data file in a disk.
+//
+// Errors of an index which stores its entries in a file wrap ErrIndexIOFailed or ErrIndexCorrupted.
 type Index interface {
 	// Put stores a given key and its value in the index
 	//
 	// It may replaces the old value if the given already exists
 	//
 	// It returns the old value if the given key already exists and nil otherwise
-	Put([]byte, *data.LogRecordPosition) *data.LogRecordPosition
+	Put([]byte, *data.LogRecordPosition) (*data.LogRecordPosition, error)
 
 	// Get returns the value of the given key from the index
 	//
 	// It returns a value if the given key already exists and nil otherwise
-	Get([]byte) *data.LogRecordPosition
+	Get([]byte) (*data.LogRecordPosition, error)
 
 	// Delete deletes the value of the given key in the index
 	//
 	// It returns the deleted value and a boolean value true if the key exists
 	// Otherwise, it returns nil and a boolean value false
-	Delete([]byte) (*data.LogRecordPosition, bool)
+	Delete([]byte) (*data.LogRecordPosition, bool, error)
 
 	// Size returns how many key/value pairs in the index
 	Size() int
@@ -33,31 +35,84 @@ type Index interface {
 	// Iterator creates an iterator of the index
 	//
 	// The iterator supports reversed iteration if the given boolean value is true
-	Iterator(bool) Iterator
+	Iterator(bool) (Iterator, error)
 
 	// Close closes the index
 	Close() error
 }
 
+// MetadataStore is implemented by a persistent index which is able to keep metadata of a DB engine alongside its entries
+type MetadataStore interface {
+	// PutMetadata stores a value of metadata by a given key
+	PutMetadata([]byte, []byte) error
+
+	// GetMetadata returns the value of metadata by a given key
+	//
+	// It returns nil if the key does not exist
+	GetMetadata([]byte) ([]byte, error)
+}
+
+// UnconfirmedGetter is implemented by an index which does not keep keys, and can look up a key without reading it
+type UnconfirmedGetter interface {
+	// GetUnconfirmed is like Get, but the returned value may belong to another key unless the key is confirmed
+	//
+	// It returns the value and a boolean value true if the key is confirmed,
+	// otherwise the caller should compare the key of the log record at the returned position with the given key,
+	// and the given key does not exist if they are different.
+	GetUnconfirmed([]byte) (*data.LogRecordPosition, bool, error)
+}
+
 // IndexType enum
 type IndexType = int8
 
 const (
-	Btree  IndexType = iota + 1 // Btree B Tree index
-	ARtree                        // ARtree Adaptive Radix Tree index
-	BPtree                        // BPtree B+ Tree index
+	Btree        IndexType = iota + 1 // Btree B Tree index
+	ARtree                            // ARtree Adaptive Radix Tree index
+	BPtree                            // BPtree B+ Tree index
+	Hash                              // Hash persistent hash index, whose iterator is unordered
+	Fingerprint                       // Fingerprint memory-efficient index which only keeps hashes of keys in memory
+	ShardedBtree                      // ShardedBtree concurrent index which partitions keys across many B trees
 )
 
+// KeyReader reads the full key of the log record at a given position
+type KeyReader = func(*data.LogRecordPosition) ([]byte, error)
+
 // New A simple factory menthod for creating an index
-func New(t IndexType, d string, syncWrites bool) Index {
+func New(t IndexType, options IndexOptions) (Index, error) {
 	switch t {
 	case Btree:
-		return newBTree()
+		return newBTree(), nil
 	case ARtree:
-		return newARTree()
+		return newARTree(), nil
 	case BPtree:
-		return newBPlusTree(d, syncWrites)
+		return newBPlusTree(options.Directory, options.SyncWrites)
+	case Hash:
+		return newHashIndex(options.Directory, options.SyncWrites, options.Cipher)
+	case Fingerprint:
+		return newFingerprintIndex(options.KeyReader)
+	case ShardedBtree:
+		return newShardedBTree(), nil
 	default:
-		panic("Unsupported index type")
+		return nil, ErrUnsupportedIndexType
 	}
 }
+
+// FileName returns the name of the file where an index of the given type persists itself
+//
+// It returns an empty string if the index only lives in memory
+func FileName(t IndexType) string {
+	switch t {
+	case BPtree:
+		return BPlusTreeIndexFileName
+	case Hash:
+		return HashIndexFileName
+	default:
+		return ""
+	}
+}
+
+// IsPersistent reports whether an index of the given type persists itself,
+// so that it does not need to be rebuilt from data files
+func IsPersistent(t IndexType) bool {
+	return FileName(t) != ""
+}
@@ -0,0 +1,18 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	idx, err := New(Btree, IndexOptions{})
+	assert.Nil(t, err)
+	assert.NotNil(t, idx)
+
+	_, err = New(Fingerprint, IndexOptions{})
+	assert.Equal(t, ErrKeyReaderRequired, err)
+	_, err = New(IndexType(114), IndexOptions{})
+	assert.Equal(t, ErrUnsupportedIndexType, err)
+}
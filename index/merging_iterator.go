@@ -0,0 +1,122 @@
+package index
+
+import (
+	"bytes"
+	"container/heap"
+
+	"github.com/saint-yellow/baradb/data"
+)
+
+// mergingIterator merges many ordered iterators into a single ordered one
+//
+// Keys of the merged iterators are supposed to be disjoint.
+type mergingIterator struct {
+	iterators []Iterator // merged iterators
+	reverse   bool       // whether enable reverse iteration
+	heap      *iteratorHeap
+}
+
+func newMergingIterator(iterators []Iterator, reverse bool) *mergingIterator {
+	iter := &mergingIterator{
+		iterators: iterators,
+		reverse:   reverse,
+	}
+	iter.Rewind()
+	return iter
+}
+
+// init collects valid iterators into the heap
+func (iter *mergingIterator) init() {
+	h := &iteratorHeap{
+		reverse: iter.reverse,
+	}
+	for _, it := range iter.iterators {
+		if it.Valid() {
+			h.items = append(h.items, it)
+		}
+	}
+	heap.Init(h)
+	iter.heap = h
+}
+
+func (iter *mergingIterator) Rewind() {
+	for _, it := range iter.iterators {
+		it.Rewind()
+	}
+	iter.init()
+}
+
+func (iter *mergingIterator) Seek(key []byte) {
+	for _, it := range iter.iterators {
+		it.Seek(key)
+	}
+	iter.init()
+}
+
+func (iter *mergingIterator) Next() {
+	if !iter.Valid() {
+		return
+	}
+
+	top := iter.heap.items[0]
+	top.Next()
+	if top.Valid() {
+		heap.Fix(iter.heap, 0)
+	} else {
+		heap.Pop(iter.heap)
+	}
+}
+
+func (iter *mergingIterator) Valid() bool {
+	return iter.heap != nil && len(iter.heap.items) > 0
+}
+
+func (iter *mergingIterator) Key() []byte {
+	return iter.heap.items[0].Key()
+}
+
+func (iter *mergingIterator) Value() *data.LogRecordPosition {
+	return iter.heap.items[0].Value()
+}
+
+func (iter *mergingIterator) Close() {
+	for _, it := range iter.iterators {
+		it.Close()
+	}
+	iter.heap = nil
+}
+
+// iteratorHeap orders iterators by their current keys
+//
+// It implements [heap.Interface](container/heap)
+type iteratorHeap struct {
+	items   []Iterator
+	reverse bool
+}
+
+func (h *iteratorHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *iteratorHeap) Less(i, j int) bool {
+	cmp := bytes.Compare(h.items[i].Key(), h.items[j].Key())
+	if h.reverse {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+func (h *iteratorHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+func (h *iteratorHeap) Push(x any) {
+	h.items = append(h.items, x.(Iterator))
+}
+
+func (h *iteratorHeap) Pop() any {
+	n := len(h.items)
+	x := h.items[n-1]
+	h.items = h.items[:n-1]
+	return x
+}
@@ -1,9 +1,17 @@
 package index
 
+import (
+	"time"
+
+	"github.com/saint-yellow/baradb/data"
+)
+
 // Options options of an iterator of an index
 type IteratorOptions struct {
-	Prefix  []byte // Traverses an iterator's keys with a specified non-nil prefix
-	Reverse bool   // Traverses an iterator reversely if true
+	Prefix         []byte    // Traverses an iterator's keys with a specified non-nil prefix
+	Reverse        bool      // Traverses an iterator reversely if true
+	ModifiedSince  time.Time // Traverses keys whose values are written at or after the time if it is not zero
+	ModifiedBefore time.Time // Traverses keys whose values are written before the time if it is not zero
 }
 
 // DefaultOptions default options of an iterator of an index
@@ -11,3 +19,11 @@ var DefaultIteratorOptions = IteratorOptions{
 	Prefix:  nil,
 	Reverse: false,
 }
+
+// IndexOptions options of an index
+type IndexOptions struct {
+	Directory  string       // Directory where a persistent index stores its file
+	SyncWrites bool         // Whether a persistent index syncs its file after every modification
+	KeyReader  KeyReader    // Reads full keys from data files for an index which does not keep keys in memory
+	Cipher     *data.Cipher // Encrypts the file of a persistent index, it is nil if encryption is disabled
+}
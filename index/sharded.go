@@ -0,0 +1,76 @@
+package index
+
+import (
+	"hash/maphash"
+
+	"github.com/saint-yellow/baradb/data"
+)
+
+// shardNumber Number of shards in a sharded index
+const shardNumber = 32
+
+// shardedBTree represents a concurrent index
+//
+// Keys are partitioned across many B trees by their hashes, and every B tree is guarded by its own lock,
+// so operations on different shards do not block each other.
+// Its iterator merges iterators of all shards to keep keys ordered.
+type shardedBTree struct {
+	shards [shardNumber]*bTree
+	seed   maphash.Seed
+}
+
+func newShardedBTree() *shardedBTree {
+	t := &shardedBTree{
+		seed: maphash.MakeSeed(),
+	}
+	for i := range t.shards {
+		t.shards[i] = newBTree()
+	}
+	return t
+}
+
+// shard returns the shard where the given key belongs to
+func (t *shardedBTree) shard(key []byte) *bTree {
+	return t.shards[maphash.Bytes(t.seed, key)%shardNumber]
+}
+
+// Put stores location of the corresponding data of the key in the index
+func (t *shardedBTree) Put(key []byte, position *data.LogRecordPosition) (*data.LogRecordPosition, error) {
+	return t.shard(key).Put(key, position)
+}
+
+// Get gets the location of the corresponding data af the key in the index
+func (t *shardedBTree) Get(key []byte) (*data.LogRecordPosition, error) {
+	return t.shard(key).Get(key)
+}
+
+// Delete deletes the location of the corresponding data of the key in the index
+func (t *shardedBTree) Delete(key []byte) (*data.LogRecordPosition, bool, error) {
+	return t.shard(key).Delete(key)
+}
+
+// Size returns how many key/value pairs in the index
+func (t *shardedBTree) Size() int {
+	var size int
+	for _, s := range t.shards {
+		size += s.Size()
+	}
+	return size
+}
+
+// Iterator returns an iterator which merges snapshots of all shards
+func (t *shardedBTree) Iterator(reverse bool) (Iterator, error) {
+	iterators := make([]Iterator, len(t.shards))
+	for i, s := range t.shards {
+		iter, err := s.Iterator(reverse)
+		if err != nil {
+			return nil, err
+		}
+		iterators[i] = iter
+	}
+	return newMergingIterator(iterators, reverse), nil
+}
+
+func (t *shardedBTree) Close() error {
+	return nil
+}
@@ -0,0 +1,154 @@
+package index
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/saint-yellow/baradb/data"
+	"github.com/saint-yellow/baradb/utils"
+)
+
+func TestShardedBTree_Put(t *testing.T) {
+	var err error
+	tree := newShardedBTree()
+
+	var lrp *data.LogRecordPosition
+	lrp, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+	lrp, err = tree.Put([]byte("14"), &data.LogRecordPosition{FileID: 514, Offset: 514})
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+	lrp, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 14, Offset: 51})
+	assert.Nil(t, err)
+	assert.NotNil(t, lrp)
+	assert.Equal(t, 2, tree.Size())
+}
+
+func TestShardedBTree_Get(t *testing.T) {
+	var err error
+	tree := newShardedBTree()
+
+	_, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
+	assert.Nil(t, err)
+	lrp, err := tree.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.True(t, lrp.FileID == uint32(114) && lrp.Offset == int64(114))
+
+	_, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 1140, Offset: 1140})
+	assert.Nil(t, err)
+	lrp, err = tree.Get([]byte("114"))
+	assert.Nil(t, err)
+	assert.True(t, lrp.FileID == uint32(1140) && lrp.Offset == int64(1140))
+
+	lrp, err = tree.Get([]byte("514"))
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+}
+
+func TestShardedBTree_Delete(t *testing.T) {
+	tree := newShardedBTree()
+
+	lrp, ok, err := tree.Delete([]byte("114"))
+	assert.Nil(t, err)
+	assert.Nil(t, lrp)
+	assert.False(t, ok)
+
+	_, err = tree.Put([]byte("114"), &data.LogRecordPosition{FileID: 114, Offset: 114})
+	assert.Nil(t, err)
+	lrp, ok, err = tree.Delete([]byte("114"))
+	assert.Nil(t, err)
+	assert.NotNil(t, lrp)
+	assert.True(t, ok)
+	assert.Zero(t, tree.Size())
+}
+
+func TestShardedBTreeIterator(t *testing.T) {
+	tree := newShardedBTree()
+
+	// The index has no key
+	iter1, err := tree.Iterator(false)
+	assert.Nil(t, err)
+	assert.False(t, iter1.Valid())
+	iter1.Close()
+
+	// Keys spread over shards are iterated in order
+	count := 100
+	for i := 1; i <= count; i++ {
+		_, err = tree.Put(utils.NewKey(i), &data.LogRecordPosition{FileID: 114, Offset: int64(i)})
+		assert.Nil(t, err)
+	}
+
+	index := 1
+	iter2, err := tree.Iterator(false)
+	assert.Nil(t, err)
+	defer iter2.Close()
+	for iter2.Rewind(); iter2.Valid(); iter2.Next() {
+		assert.Equal(t, utils.NewKey(index), iter2.Key())
+		assert.Equal(t, int64(index), iter2.Value().Offset)
+		index++
+	}
+	assert.Equal(t, count+1, index)
+
+	index = 50
+	for iter2.Seek(utils.NewKey(index)); iter2.Valid(); iter2.Next() {
+		assert.Equal(t, utils.NewKey(index), iter2.Key())
+		index++
+	}
+	assert.Equal(t, count+1, index)
+
+	index = 50
+	iter3, err := tree.Iterator(true)
+	assert.Nil(t, err)
+	defer iter3.Close()
+	for iter3.Seek(utils.NewKey(index)); iter3.Valid(); iter3.Next() {
+		assert.Equal(t, utils.NewKey(index), iter3.Key())
+		index--
+	}
+	assert.Zero(t, index)
+}
+
+// TestIndexes_Concurrency reads and writes in-memory indexes concurrently, it is expected to be run with -race
+func TestIndexes_Concurrency(t *testing.T) {
+	indexes := map[string]Index{
+		"btree":   newBTree(),
+		"artree":  newARTree(),
+		"sharded": newShardedBTree(),
+	}
+
+	for name, idx := range indexes {
+		t.Run(name, func(t *testing.T) {
+			wg := new(sync.WaitGroup)
+			workers, count := 8, 200
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < count; i++ {
+						key := utils.NewKey(w*count + i)
+						_, err := idx.Put(key, &data.LogRecordPosition{FileID: uint32(w), Offset: int64(i)})
+						assert.Nil(t, err)
+						lrp, err := idx.Get(key)
+						assert.Nil(t, err)
+						assert.NotNil(t, lrp)
+						if i%2 == 0 {
+							_, _, err = idx.Delete(key)
+							assert.Nil(t, err)
+						}
+						_ = idx.Size()
+					}
+					iter, err := idx.Iterator(false)
+					assert.Nil(t, err)
+					for iter.Rewind(); iter.Valid(); iter.Next() {
+						_ = iter.Key()
+					}
+					iter.Close()
+				}(w)
+			}
+			wg.Wait()
+			assert.Equal(t, workers*count/2, idx.Size())
+		})
+	}
+}
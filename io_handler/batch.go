@@ -0,0 +1,56 @@
+package io_handler
+
+import "sync"
+
+// maxConcurrentReads Maximum number of reads issued concurrently by a batch
+const maxConcurrentReads = 16
+
+// ReadRequest represents a read in a batch
+type ReadRequest struct {
+	Buffer []byte // Buffer to read data into
+	Offset int64  // Offset to read data from
+	N      int    // Number of bytes read
+	Err    error  // Error of the read
+}
+
+// BatchReader is implemented by I/O handlers which read many positions of a file in a batch
+type BatchReader interface {
+	// ReadBatch Read data for every single request, results are stored in the requests
+	ReadBatch([]*ReadRequest)
+}
+
+// ReadBatch Read data for every single request with an I/O handler
+//
+// The I/O handler serves the requests itself if it is a BatchReader, otherwise the requests are read one by one.
+func ReadBatch(handler IOHandler, requests []*ReadRequest) {
+	if br, ok := handler.(BatchReader); ok {
+		br.ReadBatch(requests)
+		return
+	}
+	for _, r := range requests {
+		r.N, r.Err = handler.Read(r.Buffer, r.Offset)
+	}
+}
+
+// readConcurrently Read data for requests concurrently with a given read function
+func readConcurrently(requests []*ReadRequest, read func([]byte, int64) (int, error)) {
+	if len(requests) == 1 {
+		requests[0].N, requests[0].Err = read(requests[0].Buffer, requests[0].Offset)
+		return
+	}
+
+	wg := new(sync.WaitGroup)
+	tokens := make(chan struct{}, maxConcurrentReads)
+	for _, r := range requests {
+		wg.Add(1)
+		tokens <- struct{}{}
+		go func(r *ReadRequest) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			r.N, r.Err = read(r.Buffer, r.Offset)
+		}(r)
+	}
+	wg.Wait()
+}
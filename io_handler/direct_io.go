@@ -0,0 +1,126 @@
+package io_handler
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// directIOAlignment Alignment of offsets, sizes and buffers of direct reads (unit: B)
+const directIOAlignment = 4096
+
+// directIO represents an I/O handler which reads a file with direct I/O, bypassing the page cache
+//
+// Direct reads require aligned offsets, sizes and buffers, so every read covers whole aligned blocks
+// and copies the requested bytes out of them.
+// Writes go through the page cache since appended log records are not aligned,
+// and the kernel writes back cached pages before direct reads of them.
+//
+// Reads fall back to buffered I/O if the platform or the filesystem does not support direct I/O.
+type directIO struct {
+	fd       *os.File    // File descriptor for buffered writes and fallback reads
+	direct   *os.File    // File descriptor for direct reads, it is nil if direct I/O is not supported
+	fallback atomic.Bool // Whether direct reads have been rejected by the filesystem
+}
+
+// newDirectIO initializes a direct I/O handler
+func newDirectIO(filePath string) (*directIO, error) {
+	fd, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, DataFilePermission)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &directIO{fd: fd}
+	direct, err := openDirectFile(filePath)
+	if err == nil {
+		d.direct = direct
+	}
+	return d, nil
+}
+
+// alignedBuffer allocates a buffer whose address is aligned for direct I/O
+func alignedBuffer(size int) []byte {
+	b := make([]byte, size+directIOAlignment)
+	shift := 0
+	if remainder := int(uintptr(unsafe.Pointer(&b[0])) & (directIOAlignment - 1)); remainder != 0 {
+		shift = directIOAlignment - remainder
+	}
+	return b[shift : shift+size]
+}
+
+// Read Read corresponding data from the specific position of a file
+func (d *directIO) Read(b []byte, offset int64) (int, error) {
+	if d.direct == nil || d.fallback.Load() || len(b) == 0 {
+		return d.fd.ReadAt(b, offset)
+	}
+
+	start := offset &^ (directIOAlignment - 1)
+	end := (offset + int64(len(b)) + directIOAlignment - 1) &^ (directIOAlignment - 1)
+	buffer := alignedBuffer(int(end - start))
+	n, err := d.direct.ReadAt(buffer, start)
+	if err != nil && err != io.EOF {
+		if errors.Is(err, syscall.EINVAL) {
+			// The filesystem rejects direct reads
+			d.fallback.Store(true)
+			return d.fd.ReadAt(b, offset)
+		}
+		return 0, err
+	}
+
+	skipped := int(offset - start)
+	if n <= skipped {
+		return 0, io.EOF
+	}
+	copied := copy(b, buffer[skipped:n])
+	if copied < len(b) {
+		return copied, io.EOF
+	}
+	return copied, nil
+}
+
+// ReadBatch Read data for every single request concurrently
+func (d *directIO) ReadBatch(requests []*ReadRequest) {
+	readConcurrently(requests, d.Read)
+}
+
+// Write Write data to a file
+func (d *directIO) Write(b []byte) (int, error) {
+	return d.fd.Write(b)
+}
+
+// Patch Overwrite data at the specific position of a file
+func (d *directIO) Patch(b []byte, offset int64) error {
+	return patchFile(d.fd, b, offset)
+}
+
+// Sync Persistent data
+func (d *directIO) Sync() error {
+	return d.fd.Sync()
+}
+
+// Truncate Discard data after the given size of a file
+func (d *directIO) Truncate(size int64) error {
+	return d.fd.Truncate(size)
+}
+
+// Close Close a file
+func (d *directIO) Close() error {
+	if d.direct != nil {
+		if err := d.direct.Close(); err != nil {
+			return err
+		}
+	}
+	return d.fd.Close()
+}
+
+// Size Get the size of a data file (unit: B)
+func (d *directIO) Size() (int64, error) {
+	stat, err := d.fd.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
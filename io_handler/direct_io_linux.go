@@ -0,0 +1,11 @@
+package io_handler
+
+import (
+	"os"
+	"syscall"
+)
+
+// openDirectFile opens a file for direct reads
+func openDirectFile(filePath string) (*os.File, error) {
+	return os.OpenFile(filePath, os.O_RDONLY|syscall.O_DIRECT, DataFilePermission)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package io_handler
+
+import (
+	"errors"
+	"os"
+)
+
+// openDirectFile opens a file for direct reads, which is not supported on this platform
+func openDirectFile(filePath string) (*os.File, error) {
+	return nil, errors.New("direct I/O is not supported on this platform")
+}
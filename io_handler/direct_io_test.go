@@ -0,0 +1,83 @@
+package io_handler
+
+import (
+	"io"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectIO_ReadAndWrite(t *testing.T) {
+	d, err := newDirectIO(filePath)
+	defer destroyFile()
+	assert.Nil(t, err)
+
+	b1 := make([]byte, 6)
+	n, err := d.Read(b1, 0)
+	assert.Zero(t, n)
+	assert.Equal(t, io.EOF, err)
+
+	// Write data across an aligned block
+	block := make([]byte, directIOAlignment-3)
+	d.Write(block)
+	d.Write([]byte("114514"))
+	d.Write([]byte("1919810"))
+
+	n, err = d.Read(b1, int64(len(block)))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+	assert.Equal(t, []byte("114514"), b1)
+
+	b2 := make([]byte, 10)
+	n, err = d.Read(b2, int64(len(block))+6)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []byte("1919810"), b2[:n])
+
+	size, _ := d.Size()
+	assert.Equal(t, int64(len(block)+13), size)
+	assert.Nil(t, d.Sync())
+
+	// Reads fall back to buffered I/O
+	d.fallback.Store(true)
+	n, err = d.Read(b1, int64(len(block)))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("114514"), b1[:n])
+	assert.Nil(t, d.Close())
+}
+
+func TestAlignedBuffer(t *testing.T) {
+	for _, size := range []int{1, directIOAlignment, 3 * directIOAlignment} {
+		b := alignedBuffer(size)
+		assert.Equal(t, size, len(b))
+		assert.Zero(t, uintptr(unsafe.Pointer(&b[0]))%directIOAlignment)
+	}
+}
+
+func TestReadBatch(t *testing.T) {
+	defer destroyFile()
+
+	for _, ioHandlerType := range []IOHandlerType{FileIOHandler, InMemoryIOHandler, DirectIOHandler} {
+		handler, err := New(ioHandlerType, filePath)
+		assert.Nil(t, err)
+		for i := 0; i < 100; i++ {
+			handler.Write([]byte{byte(i)})
+		}
+
+		requests := make([]*ReadRequest, 0)
+		for i := 0; i < 100; i += 10 {
+			requests = append(requests, &ReadRequest{Buffer: make([]byte, 2), Offset: int64(i)})
+		}
+		requests = append(requests, &ReadRequest{Buffer: make([]byte, 2), Offset: 114})
+		ReadBatch(handler, requests)
+
+		for i, r := range requests[:len(requests)-1] {
+			assert.Nil(t, r.Err)
+			assert.Equal(t, 2, r.N)
+			assert.Equal(t, []byte{byte(i * 10), byte(i*10 + 1)}, r.Buffer)
+		}
+		assert.Equal(t, io.EOF, requests[len(requests)-1].Err)
+		assert.Nil(t, handler.Close())
+		destroyFile()
+	}
+}
@@ -0,0 +1,11 @@
+package io_handler
+
+import "errors"
+
+var (
+	ErrUnsupportedIOHandlerType = errors.New("unsupported I/O handler type")
+	ErrInvalidIOHandlerType     = errors.New("invalid I/O handler type")
+	ErrInjectedFault            = errors.New("injected I/O fault")
+	ErrTornWrite                = errors.New("injected torn write")
+	ErrOperationUnsupported     = errors.New("the operation is not supported by the I/O handler")
+)
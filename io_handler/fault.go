@@ -0,0 +1,182 @@
+package io_handler
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+type faultKind = int8
+
+const (
+	writeFault faultKind = iota + 1
+	tornWriteFault
+	syncFault
+	readFault
+)
+
+// fault describes a fault to be injected once
+type fault struct {
+	kind     faultKind
+	fileName string // Name of the file where the fault is injected, any file if it is empty
+	offset   int64  // Offset where the fault is injected, ignored by sync faults
+}
+
+// FaultInjector constructs I/O handlers which inject faults into another type of I/O handlers,
+// which is useful to exercise recovery from failed or torn writes.
+//
+// Register its New method as a constructor of a custom I/O handler type to use it:
+//
+//	injector := io_handler.NewFaultInjector(io_handler.FileIOHandler)
+//	io_handler.Register(customType, injector.New)
+//
+// Every fault is injected once, by the first operation which reaches it.
+type FaultInjector struct {
+	backend IOHandlerType
+	faults  []*fault
+	lock    *sync.Mutex
+}
+
+// NewFaultInjector constructs a FaultInjector which wraps a given type of I/O handlers
+func NewFaultInjector(backend IOHandlerType) *FaultInjector {
+	return &FaultInjector{
+		backend: backend,
+		lock:    new(sync.Mutex),
+	}
+}
+
+// New constructs an I/O handler which injects faults, it satisfies Constructor
+func (fi *FaultInjector) New(filePath string) (IOHandler, error) {
+	inner, err := New(fi.backend, filePath)
+	if err != nil {
+		return nil, err
+	}
+	size, err := inner.Size()
+	if err != nil {
+		return nil, err
+	}
+	f := &faultyIO{
+		inner:       inner,
+		injector:    fi,
+		fileName:    filepath.Base(filePath),
+		writeOffset: size,
+	}
+	return f, nil
+}
+
+// FailWriteAt makes a write which covers the offset of a file fail without writing anything
+func (fi *FaultInjector) FailWriteAt(fileName string, offset int64) {
+	fi.add(&fault{kind: writeFault, fileName: fileName, offset: offset})
+}
+
+// TearWriteAt makes a write which covers the offset of a file only write bytes before the offset
+func (fi *FaultInjector) TearWriteAt(fileName string, offset int64) {
+	fi.add(&fault{kind: tornWriteFault, fileName: fileName, offset: offset})
+}
+
+// FailReadAt makes a read which covers the offset of a file fail
+func (fi *FaultInjector) FailReadAt(fileName string, offset int64) {
+	fi.add(&fault{kind: readFault, fileName: fileName, offset: offset})
+}
+
+// FailSync makes the next sync of a file fail
+func (fi *FaultInjector) FailSync(fileName string) {
+	fi.add(&fault{kind: syncFault, fileName: fileName})
+}
+
+// Clear removes all faults which have not been injected
+func (fi *FaultInjector) Clear() {
+	fi.lock.Lock()
+	defer fi.lock.Unlock()
+
+	fi.faults = nil
+}
+
+func (fi *FaultInjector) add(f *fault) {
+	fi.lock.Lock()
+	defer fi.lock.Unlock()
+
+	fi.faults = append(fi.faults, f)
+}
+
+// take removes and returns the first fault of a kind in a file which lies in [offset, offset+size)
+func (fi *FaultInjector) take(kind faultKind, fileName string, offset, size int64) *fault {
+	fi.lock.Lock()
+	defer fi.lock.Unlock()
+
+	for i, f := range fi.faults {
+		if f.kind != kind || (f.fileName != "" && f.fileName != fileName) {
+			continue
+		}
+		if kind != syncFault && (f.offset < offset || f.offset >= offset+size) {
+			continue
+		}
+		fi.faults = append(fi.faults[:i], fi.faults[i+1:]...)
+		return f
+	}
+	return nil
+}
+
+// faultyIO represents an I/O handler which injects faults into another one
+type faultyIO struct {
+	inner       IOHandler
+	injector    *FaultInjector
+	fileName    string
+	writeOffset int64 // Offset of the next write
+}
+
+// Read Read corresponding data from the specific position of a file
+func (f *faultyIO) Read(b []byte, offset int64) (int, error) {
+	if f.injector.take(readFault, f.fileName, offset, int64(len(b))) != nil {
+		return 0, ErrInjectedFault
+	}
+	return f.inner.Read(b, offset)
+}
+
+// Write Write data to a file
+func (f *faultyIO) Write(b []byte) (int, error) {
+	size := int64(len(b))
+	if f.injector.take(writeFault, f.fileName, f.writeOffset, size) != nil {
+		return 0, ErrInjectedFault
+	}
+	if tf := f.injector.take(tornWriteFault, f.fileName, f.writeOffset, size); tf != nil {
+		n, err := f.inner.Write(b[:tf.offset-f.writeOffset])
+		f.writeOffset += int64(n)
+		if err != nil {
+			return n, err
+		}
+		return n, ErrTornWrite
+	}
+
+	n, err := f.inner.Write(b)
+	f.writeOffset += int64(n)
+	return n, err
+}
+
+// Sync Persistent data
+func (f *faultyIO) Sync() error {
+	if f.injector.take(syncFault, f.fileName, 0, 0) != nil {
+		return ErrInjectedFault
+	}
+	return f.inner.Sync()
+}
+
+// Truncate Discard data after the given size of a file
+func (f *faultyIO) Truncate(size int64) error {
+	if err := f.inner.Truncate(size); err != nil {
+		return err
+	}
+	if size < f.writeOffset {
+		f.writeOffset = size
+	}
+	return nil
+}
+
+// Close Close a file
+func (f *faultyIO) Close() error {
+	return f.inner.Close()
+}
+
+// Size Get the size of a data file (unit: B)
+func (f *faultyIO) Size() (int64, error) {
+	return f.inner.Size()
+}
@@ -0,0 +1,60 @@
+package io_handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultInjector_Write(t *testing.T) {
+	injector := NewFaultInjector(InMemoryIOHandler)
+	f, err := injector.New(filePath)
+	assert.Nil(t, err)
+
+	// A failed write writes nothing
+	injector.FailWriteAt("", 3)
+	n, err := f.Write([]byte("114514"))
+	assert.Equal(t, ErrInjectedFault, err)
+	assert.Zero(t, n)
+
+	// The fault is injected once
+	n, err = f.Write([]byte("114514"))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+
+	// A torn write only writes bytes before the offset
+	injector.TearWriteAt("baradb-114514.data", 9)
+	n, err = f.Write([]byte("1919810"))
+	assert.Equal(t, ErrTornWrite, err)
+	assert.Equal(t, 3, n)
+	size, _ := f.Size()
+	assert.Equal(t, int64(9), size)
+
+	// Faults in other files are not injected
+	injector.FailWriteAt("another.data", 9)
+	assert.Nil(t, f.Truncate(6))
+	n, err = f.Write([]byte("1919810"))
+	assert.Nil(t, err)
+	assert.Equal(t, 7, n)
+	injector.Clear()
+}
+
+func TestFaultInjector_ReadAndSync(t *testing.T) {
+	injector := NewFaultInjector(InMemoryIOHandler)
+	f, _ := injector.New(filePath)
+	f.Write([]byte("1145141919810"))
+
+	injector.FailReadAt("", 8)
+	b := make([]byte, 6)
+	_, err := f.Read(b, 0)
+	assert.Nil(t, err)
+	_, err = f.Read(b, 6)
+	assert.Equal(t, ErrInjectedFault, err)
+	_, err = f.Read(b, 6)
+	assert.Nil(t, err)
+
+	injector.FailSync("")
+	assert.Equal(t, ErrInjectedFault, f.Sync())
+	assert.Nil(t, f.Sync())
+	assert.Nil(t, f.Close())
+}
@@ -22,10 +22,20 @@ func (fio *fileIO) Read(data []byte, offset int64) (int, error) {
 	return fio.fd.ReadAt(data, offset)
 }
 
+// ReadBatch Read data for every single request concurrently
+func (fio *fileIO) ReadBatch(requests []*ReadRequest) {
+	readConcurrently(requests, fio.Read)
+}
+
 func (fio *fileIO) Write(data []byte) (int, error) {
 	return fio.fd.Write(data)
 }
 
+// Patch Overwrite data at the specific position of a file
+func (fio *fileIO) Patch(b []byte, offset int64) error {
+	return patchFile(fio.fd, b, offset)
+}
+
 func (fio *fileIO) Sync() error {
 	return fio.fd.Sync()
 }
@@ -34,6 +44,10 @@ func (fio *fileIO) Close() error {
 	return fio.fd.Close()
 }
 
+func (fio *fileIO) Truncate(size int64) error {
+	return fio.fd.Truncate(size)
+}
+
 func (fio *fileIO) Size() (int64, error) {
 	stat, err := fio.fd.Stat()
 	if err != nil {
@@ -2,6 +2,7 @@ package io_handler
 
 import (
 	"io/fs"
+	"sync"
 )
 
 // DataFilePermission permission of every single data file
@@ -19,6 +20,14 @@ type IOHandler interface {
 	Close() error
 	// Size Get the size of a data file (unit: B)
 	Size() (int64, error)
+	// Truncate Discard data after the given size of a file
+	Truncate(int64) error
+}
+
+// Sealer is implemented by an I/O handler which reserves space beyond the data of a file
+type Sealer interface {
+	// Seal releases the reserved space, since no more data is written to the file
+	Seal() error
 }
 
 type IOHandlerType = int8
@@ -26,16 +35,67 @@ type IOHandlerType = int8
 const (
 	FileIOHandler IOHandlerType = iota + 1
 	MemoryMappedIOHandler
+	InMemoryIOHandler
+	WritableMemoryMappedIOHandler
+	DirectIOHandler
 )
 
-// New Constructs an IOHandler, such as FileIO
-func New(t IOHandlerType, filePath string) (IOHandler, error) {
-	switch t {
-	case FileIOHandler:
+// Constructor constructs an IOHandler for a file with a given path
+type Constructor = func(filePath string) (IOHandler, error)
+
+var (
+	registry     = make(map[IOHandlerType]Constructor)
+	registryLock = new(sync.RWMutex)
+)
+
+func init() {
+	_ = Register(FileIOHandler, func(filePath string) (IOHandler, error) {
 		return newFileIO(filePath)
-	case MemoryMappedIOHandler:
+	})
+	_ = Register(MemoryMappedIOHandler, func(filePath string) (IOHandler, error) {
 		return newMemoryMappedIO(filePath)
-	default:
-		panic("Unsupproted I/O handler type")
+	})
+	_ = Register(InMemoryIOHandler, func(filePath string) (IOHandler, error) {
+		return newMemoryIO(filePath)
+	})
+	_ = Register(WritableMemoryMappedIOHandler, func(filePath string) (IOHandler, error) {
+		return newWritableMemoryMappedIO(filePath)
+	})
+	_ = Register(DirectIOHandler, func(filePath string) (IOHandler, error) {
+		return newDirectIO(filePath)
+	})
+}
+
+// Register registers a constructor of IOHandlers with a type, the previous constructor of the type is replaced
+func Register(t IOHandlerType, constructor Constructor) error {
+	if t <= 0 || constructor == nil {
+		return ErrInvalidIOHandlerType
+	}
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry[t] = constructor
+	return nil
+}
+
+// IsRegistered reports whether a type of IOHandlers is registered
+func IsRegistered(t IOHandlerType) bool {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	_, ok := registry[t]
+	return ok
+}
+
+// New Constructs an IOHandler of a registered type, such as FileIO
+func New(t IOHandlerType, filePath string) (IOHandler, error) {
+	registryLock.RLock()
+	constructor, ok := registry[t]
+	registryLock.RUnlock()
+
+	if !ok {
+		return nil, ErrUnsupportedIOHandlerType
 	}
+	return constructor(filePath)
 }
@@ -0,0 +1,44 @@
+package io_handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	defer destroyFile()
+
+	for _, ioHandlerType := range []IOHandlerType{FileIOHandler, MemoryMappedIOHandler, InMemoryIOHandler} {
+		handler, err := New(ioHandlerType, filePath)
+		assert.Nil(t, err)
+		assert.NotNil(t, handler)
+		assert.Nil(t, handler.Close())
+	}
+
+	handler, err := New(114, filePath)
+	assert.Equal(t, ErrUnsupportedIOHandlerType, err)
+	assert.Nil(t, handler)
+}
+
+func TestRegister(t *testing.T) {
+	var customIOHandler IOHandlerType = 114
+	assert.False(t, IsRegistered(customIOHandler))
+
+	err := Register(customIOHandler, func(filePath string) (IOHandler, error) {
+		return newMemoryIO(filePath)
+	})
+	assert.Nil(t, err)
+	assert.True(t, IsRegistered(customIOHandler))
+
+	handler, err := New(customIOHandler, filePath)
+	assert.Nil(t, err)
+	assert.IsType(t, &memoryIO{}, handler)
+
+	assert.Equal(t, ErrInvalidIOHandlerType, Register(0, newFileIOConstructor))
+	assert.Equal(t, ErrInvalidIOHandlerType, Register(customIOHandler, nil))
+}
+
+func newFileIOConstructor(filePath string) (IOHandler, error) {
+	return newFileIO(filePath)
+}
@@ -0,0 +1,96 @@
+package io_handler
+
+import (
+	"io"
+	"sync"
+)
+
+// memoryIO represents an I/O handler which keeps a file in memory
+//
+// Nothing is written to the disk, and the data is discarded once the file is closed,
+// so it suits tests and ephemeral caches.
+type memoryIO struct {
+	data []byte
+	lock *sync.RWMutex
+}
+
+// newMemoryIO initializes an in-memory I/O handler, the file path is not used
+func newMemoryIO(filePath string) (*memoryIO, error) {
+	m := &memoryIO{
+		lock: new(sync.RWMutex),
+	}
+	return m, nil
+}
+
+// Read Read corresponding data from the specific position of a file
+func (m *memoryIO) Read(b []byte, offset int64) (int, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if offset >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, m.data[offset:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// View Get n bytes from the specific position of a file without copying
+func (m *memoryIO) View(offset int64, n int) ([]byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return view(m.data, offset, n)
+}
+
+// Write Write data to a file
+func (m *memoryIO) Write(b []byte) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.data = append(m.data, b...)
+	return len(b), nil
+}
+
+// Patch Overwrite data at the specific position of a file
+func (m *memoryIO) Patch(b []byte, offset int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return patchMemory(m.data, b, offset)
+}
+
+// Sync Persistent data, there is nothing to do
+func (m *memoryIO) Sync() error {
+	return nil
+}
+
+// Truncate Discard data after the given size of a file
+func (m *memoryIO) Truncate(size int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if size < int64(len(m.data)) {
+		m.data = m.data[:size]
+	}
+	return nil
+}
+
+// Close Close a file and discard its data
+func (m *memoryIO) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.data = nil
+	return nil
+}
+
+// Size Get the size of a data file (unit: B)
+func (m *memoryIO) Size() (int64, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return int64(len(m.data)), nil
+}
@@ -0,0 +1,78 @@
+package io_handler
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryIO_ReadAndWrite(t *testing.T) {
+	m, err := newMemoryIO(filePath)
+	assert.Nil(t, err)
+	assert.NoFileExists(t, filePath)
+
+	b1 := make([]byte, 6)
+	n, err := m.Read(b1, 0)
+	assert.Zero(t, n)
+	assert.Equal(t, io.EOF, err)
+
+	m.Write([]byte("114514"))
+	m.Write([]byte("1919810"))
+
+	n, err = m.Read(b1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+	assert.Equal(t, []byte("114514"), b1)
+
+	b2 := make([]byte, 10)
+	n, err = m.Read(b2, 6)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 7, n)
+	assert.Equal(t, []byte("1919810"), b2[:n])
+
+	size, err := m.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(13), size)
+	assert.Nil(t, m.Sync())
+}
+
+func TestMemoryIO_Truncate(t *testing.T) {
+	m, _ := newMemoryIO(filePath)
+	m.Write([]byte("1145141919810"))
+
+	assert.Nil(t, m.Truncate(6))
+	size, _ := m.Size()
+	assert.Equal(t, int64(6), size)
+
+	m.Write([]byte("364364"))
+	b := make([]byte, 12)
+	_, err := m.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("114514364364"), b)
+
+	// The data is discarded after the file is closed
+	assert.Nil(t, m.Close())
+	size, _ = m.Size()
+	assert.Zero(t, size)
+}
+
+func TestMemoryIO_View(t *testing.T) {
+	m, _ := newMemoryIO("")
+	var _ Viewer = m
+
+	_, err := m.View(0, 1)
+	assert.Equal(t, io.EOF, err)
+
+	m.Write([]byte("114514"))
+	b, err := m.View(3, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "514", string(b))
+
+	b, err = m.View(6, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, b)
+
+	_, err = m.View(-1, 3)
+	assert.Equal(t, io.EOF, err)
+}
@@ -33,14 +33,19 @@ func (m *memoryMappedIO) Read(b []byte, n int64) (int, error) {
 	return m.readerAt.ReadAt(b, n)
 }
 
-// Write Write data to a file
+// Write Write data to a file, which is not supported by a read-only mapping
 func (m *memoryMappedIO) Write(b []byte) (int, error) {
-	panic("Operation unsupported")
+	return 0, ErrOperationUnsupported
 }
 
-// Sync Persistent data
+// Sync Persistent data, which is not supported by a read-only mapping
 func (m *memoryMappedIO) Sync() error {
-	panic("Operation unsupported")
+	return ErrOperationUnsupported
+}
+
+// Truncate Discard data after the given size of a file, which is not supported by a read-only mapping
+func (m *memoryMappedIO) Truncate(size int64) error {
+	return ErrOperationUnsupported
 }
 
 // Close Close a file
@@ -41,6 +41,17 @@ func TestMemoryMappedIO_Read(t *testing.T) {
 	assert.Equal(t, "1919810", string(b2))
 }
 
+func TestMemoryMappedIO_Write(t *testing.T) {
+	mmap, _ := newMemoryMappedIO(filePath)
+	defer destroyFile()
+
+	n, err := mmap.Write([]byte("114514"))
+	assert.Zero(t, n)
+	assert.Equal(t, ErrOperationUnsupported, err)
+	assert.Equal(t, ErrOperationUnsupported, mmap.Sync())
+	assert.Equal(t, ErrOperationUnsupported, mmap.Truncate(0))
+}
+
 func TestMemoryMappedIO_Close(t *testing.T) {
 	mmap, _ := newMemoryMappedIO(filePath)
 	defer destroyFile()
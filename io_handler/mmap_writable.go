@@ -0,0 +1,227 @@
+//go:build unix
+
+package io_handler
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// minMappingSize Minimum size of the mapping of a writable memory-mapped file (unit: B)
+const minMappingSize int64 = 1024 * 1024
+
+// writableMemoryMappedIO represents a memory-mapped I/O handler which supports writes
+//
+// The file is preallocated and mapped in a larger size than its data, so that writes are copied to the mapping,
+// and the mapping grows when it runs out of space.
+// Reads are served from the mapping as well, so neither reads nor writes need system calls.
+//
+// The preallocated space is truncated when the file is sealed or closed.
+// If the DB engine crashes before that, then the space is filled with zeros, which are read as the end of the file.
+type writableMemoryMappedIO struct {
+	fd   *os.File
+	data []byte // The mapping, whose length is the size of the preallocated file
+	size int64  // Size of the written data
+	lock *sync.RWMutex
+}
+
+// newWritableMemoryMappedIO initializes a writable memory-mapped I/O handler
+func newWritableMemoryMappedIO(filePath string) (*writableMemoryMappedIO, error) {
+	fd, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, DataFilePermission)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &writableMemoryMappedIO{
+		fd:   fd,
+		size: stat.Size(),
+		lock: new(sync.RWMutex),
+	}
+
+	// Preallocate an empty file since it is going to be written
+	capacity := stat.Size()
+	if capacity == 0 {
+		capacity = minMappingSize
+	}
+	if err := m.remap(capacity); err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// remap allocates the file in a given size and maps it again with the size
+//
+// The space is allocated before the file is mapped, so that a full disk fails here rather than a later write to the mapping.
+// The previous mapping is kept if the file can not be allocated or mapped.
+func (m *writableMemoryMappedIO) remap(capacity int64) error {
+	if capacity > int64(len(m.data)) {
+		if err := preallocate(m.fd, capacity); err != nil {
+			return err
+		}
+	}
+
+	var data []byte
+	if capacity > 0 {
+		var err error
+		data, err = unix.Mmap(int(m.fd.Fd()), 0, int(capacity), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.data != nil {
+		if err := unix.Munmap(m.data); err != nil {
+			_ = unix.Munmap(data)
+			return err
+		}
+	}
+	m.data = data
+	return nil
+}
+
+// Read Read corresponding data from the specific position of a file
+func (m *writableMemoryMappedIO) Read(b []byte, offset int64) (int, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if offset >= m.size {
+		return 0, io.EOF
+	}
+	n := copy(b, m.data[offset:m.size])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// View Get n bytes from the specific position of a file without copying, the returned slice refers to the mapping
+func (m *writableMemoryMappedIO) View(offset int64, n int) ([]byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return view(m.data[:m.size], offset, n)
+}
+
+// Write Write data to a file
+func (m *writableMemoryMappedIO) Write(b []byte) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	required := m.size + int64(len(b))
+	if required > int64(len(m.data)) {
+		capacity := int64(len(m.data))
+		if capacity < minMappingSize {
+			capacity = minMappingSize
+		}
+		for capacity < required {
+			capacity *= 2
+		}
+		if err := m.remap(capacity); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(m.data[m.size:], b)
+	m.size += int64(n)
+	return n, nil
+}
+
+// Patch Overwrite data at the specific position of a file
+func (m *writableMemoryMappedIO) Patch(b []byte, offset int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return patchMemory(m.data[:m.size], b, offset)
+}
+
+// Sync Persistent data
+//
+// The mapping is flushed to the file, then the file is synced, so that its metadata is persisted as well.
+func (m *writableMemoryMappedIO) Sync() error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if len(m.data) > 0 {
+		if err := unix.Msync(m.data, unix.MS_SYNC); err != nil {
+			return err
+		}
+	}
+	return m.fd.Sync()
+}
+
+// Truncate Discard data after the given size of a file
+//
+// The discarded data is zeroed, so that it is not read as log records after a crash.
+func (m *writableMemoryMappedIO) Truncate(size int64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if size >= m.size {
+		return nil
+	}
+	discarded := m.data[size:m.size]
+	for i := range discarded {
+		discarded[i] = 0
+	}
+	m.size = size
+	return nil
+}
+
+// Seal Release the preallocated space, since no more data is written to a file
+//
+// The file is truncated to the size of its data and mapped in the size.
+// It grows again if data is written after all.
+func (m *writableMemoryMappedIO) Seal() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if int64(len(m.data)) == m.size {
+		return nil
+	}
+	if err := unix.Msync(m.data, unix.MS_SYNC); err != nil {
+		return err
+	}
+	if err := m.remap(m.size); err != nil {
+		return err
+	}
+	if err := m.fd.Truncate(m.size); err != nil {
+		return err
+	}
+	return m.fd.Sync()
+}
+
+// Close Close a file, the preallocated space is truncated
+func (m *writableMemoryMappedIO) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.data != nil {
+		if err := unix.Munmap(m.data); err != nil {
+			return err
+		}
+		m.data = nil
+	}
+	if err := m.fd.Truncate(m.size); err != nil {
+		return err
+	}
+	if err := m.fd.Sync(); err != nil {
+		return err
+	}
+	return m.fd.Close()
+}
+
+// Size Get the size of a data file (unit: B)
+func (m *writableMemoryMappedIO) Size() (int64, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.size, nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package io_handler
+
+// writableMemoryMappedIO is not supported on this platform
+type writableMemoryMappedIO struct {
+	IOHandler
+}
+
+// newWritableMemoryMappedIO initializes a writable memory-mapped I/O handler, which is not supported on this platform
+func newWritableMemoryMappedIO(filePath string) (*writableMemoryMappedIO, error) {
+	return nil, ErrUnsupportedIOHandlerType
+}
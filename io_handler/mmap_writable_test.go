@@ -0,0 +1,167 @@
+//go:build unix
+
+package io_handler
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritableMemoryMappedIO_New(t *testing.T) {
+	m, err := newWritableMemoryMappedIO(filePath)
+	defer destroyFile()
+	assert.Nil(t, err)
+	assert.NotNil(t, m)
+
+	// The empty file is preallocated
+	stat, _ := os.Stat(filePath)
+	assert.Equal(t, minMappingSize, stat.Size())
+	size, _ := m.Size()
+	assert.Zero(t, size)
+	assert.Nil(t, m.Close())
+}
+
+func TestWritableMemoryMappedIO_ReadAndWrite(t *testing.T) {
+	m, _ := newWritableMemoryMappedIO(filePath)
+	defer destroyFile()
+
+	b1 := make([]byte, 6)
+	n, err := m.Read(b1, 0)
+	assert.Zero(t, n)
+	assert.Equal(t, io.EOF, err)
+
+	m.Write([]byte("114514"))
+	m.Write([]byte("1919810"))
+
+	n, err = m.Read(b1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+	assert.Equal(t, []byte("114514"), b1)
+
+	b2 := make([]byte, 10)
+	n, err = m.Read(b2, 6)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []byte("1919810"), b2[:n])
+	assert.Nil(t, m.Sync())
+}
+
+func TestWritableMemoryMappedIO_Growth(t *testing.T) {
+	m, _ := newWritableMemoryMappedIO(filePath)
+	defer destroyFile()
+
+	// Write more data than the preallocated space
+	chunk := make([]byte, 64*1024)
+	for i := range chunk {
+		chunk[i] = byte(i)
+	}
+	count := int(3*minMappingSize) / len(chunk)
+	for i := 0; i < count; i++ {
+		n, err := m.Write(chunk)
+		assert.Nil(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+	size, _ := m.Size()
+	assert.Equal(t, int64(count*len(chunk)), size)
+
+	b := make([]byte, len(chunk))
+	_, err := m.Read(b, size-int64(len(chunk)))
+	assert.Nil(t, err)
+	assert.Equal(t, chunk, b)
+
+	// The preallocated space is truncated after the file is closed
+	assert.Nil(t, m.Close())
+	stat, _ := os.Stat(filePath)
+	assert.Equal(t, size, stat.Size())
+
+	// Data is kept after the file is opened again
+	m, _ = newWritableMemoryMappedIO(filePath)
+	reopenedSize, _ := m.Size()
+	assert.Equal(t, size, reopenedSize)
+	_, err = m.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, chunk, b)
+	assert.Nil(t, m.Close())
+}
+
+func TestWritableMemoryMappedIO_Truncate(t *testing.T) {
+	m, _ := newWritableMemoryMappedIO(filePath)
+	defer destroyFile()
+
+	m.Write([]byte("1145141919810"))
+	assert.Nil(t, m.Truncate(6))
+	m.Write([]byte("364"))
+
+	b := make([]byte, 13)
+	n, err := m.Read(b, 0)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []byte("114514364"), b[:n])
+
+	// The discarded data is zeroed
+	assert.Equal(t, make([]byte, 4), m.data[9:13])
+	assert.Nil(t, m.Close())
+}
+
+func TestWritableMemoryMappedIO_View(t *testing.T) {
+	m, _ := newWritableMemoryMappedIO(filePath)
+	defer destroyFile()
+
+	var _ Viewer = m
+	m.Write([]byte("114514"))
+	m.Write([]byte("1919810"))
+
+	b, err := m.View(6, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, "1919810", string(b))
+	assert.Equal(t, 7, cap(b))
+
+	// The view refers to the mapping
+	assert.True(t, &b[0] == &m.data[6])
+
+	// Preallocated space after the data is not viewable
+	_, err = m.View(6, 8)
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, m.Close())
+}
+
+func TestWritableMemoryMappedIO_Preallocation(t *testing.T) {
+	m, _ := newWritableMemoryMappedIO(filePath)
+	defer destroyFile()
+
+	// The preallocated space is allocated rather than sparse
+	var stat syscall.Stat_t
+	assert.Nil(t, syscall.Stat(filePath, &stat))
+	assert.Equal(t, minMappingSize, stat.Blocks*512)
+	assert.Nil(t, m.Close())
+}
+
+func TestWritableMemoryMappedIO_Seal(t *testing.T) {
+	m, _ := newWritableMemoryMappedIO(filePath)
+	defer destroyFile()
+
+	var _ Sealer = m
+	m.Write([]byte("114514"))
+	assert.Nil(t, m.Sync())
+
+	// The preallocated space is truncated once the file is sealed
+	assert.Nil(t, m.Seal())
+	stat, _ := os.Stat(filePath)
+	assert.Equal(t, int64(6), stat.Size())
+	b := make([]byte, 6)
+	_, err := m.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "114514", string(b))
+
+	// The file grows again if it is written after all
+	m.Write([]byte("1919810"))
+	b = make([]byte, 13)
+	_, err = m.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "1145141919810", string(b))
+	assert.Nil(t, m.Close())
+	stat, _ = os.Stat(filePath)
+	assert.Equal(t, int64(13), stat.Size())
+}
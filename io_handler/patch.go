@@ -0,0 +1,45 @@
+package io_handler
+
+import (
+	"io"
+	"os"
+)
+
+// Patcher is implemented by I/O handlers which can overwrite data already written to a file
+type Patcher interface {
+	// Patch Overwrite data at the specific position of a file, the data must not extend beyond the end of the file
+	Patch(b []byte, offset int64) error
+}
+
+// patchFile overwrites data at the specific position of a file on the disk
+//
+// Files are opened in append mode for writes, where positional writes are not allowed,
+// so the file is opened again without it.
+func patchFile(fd *os.File, b []byte, offset int64) error {
+	stat, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	if offset < 0 || offset+int64(len(b)) > stat.Size() {
+		return io.ErrShortWrite
+	}
+
+	patchFd, err := os.OpenFile(fd.Name(), os.O_WRONLY, DataFilePermission)
+	if err != nil {
+		return err
+	}
+	if _, err := patchFd.WriteAt(b, offset); err != nil {
+		_ = patchFd.Close()
+		return err
+	}
+	return patchFd.Close()
+}
+
+// patchMemory overwrites data at the specific position of a byte array
+func patchMemory(data []byte, b []byte, offset int64) error {
+	if offset < 0 || offset+int64(len(b)) > int64(len(data)) {
+		return io.ErrShortWrite
+	}
+	copy(data[offset:], b)
+	return nil
+}
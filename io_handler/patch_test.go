@@ -0,0 +1,36 @@
+package io_handler
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatcher_Patch(t *testing.T) {
+	types := []IOHandlerType{FileIOHandler, DirectIOHandler, InMemoryIOHandler, WritableMemoryMappedIOHandler}
+	for _, ioHandlerType := range types {
+		handler, err := New(ioHandlerType, filePath)
+		assert.Nil(t, err)
+		patcher, ok := handler.(Patcher)
+		assert.True(t, ok)
+
+		handler.Write([]byte("000000"))
+		assert.Nil(t, patcher.Patch([]byte("114"), 0))
+		assert.Nil(t, patcher.Patch([]byte("514"), 3))
+
+		// Data can not be patched beyond the end of the file
+		assert.Equal(t, io.ErrShortWrite, patcher.Patch([]byte("1919"), 3))
+		assert.Equal(t, io.ErrShortWrite, patcher.Patch([]byte("1"), -1))
+
+		// Patched data is read, and the next write is still appended
+		handler.Write([]byte("1919810"))
+		b := make([]byte, 13)
+		n, err := handler.Read(b, 0)
+		assert.Nil(t, err)
+		assert.Equal(t, "1145141919810", string(b[:n]))
+
+		assert.Nil(t, handler.Close())
+		destroyFile()
+	}
+}
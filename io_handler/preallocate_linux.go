@@ -0,0 +1,18 @@
+package io_handler
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate allocates the space of a file up to a given size, so that writes to its mapping do not run out of disk space
+//
+// A file system which does not support allocation gets a sparse file instead.
+func preallocate(fd *os.File, size int64) error {
+	err := unix.Fallocate(int(fd.Fd()), 0, 0, size)
+	if err == unix.EOPNOTSUPP {
+		return fd.Truncate(size)
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build unix && !linux
+
+package io_handler
+
+import "os"
+
+// preallocate extends a file to a given size, the file is sparse since allocation is not supported on this platform
+func preallocate(fd *os.File, size int64) error {
+	return fd.Truncate(size)
+}
@@ -0,0 +1,19 @@
+package io_handler
+
+import "io"
+
+// Viewer is implemented by I/O handlers which keep data of a file in memory and expose it without copying
+type Viewer interface {
+	// View Get n bytes from the specific position of a file, the returned slice refers to the memory of the I/O handler
+	//
+	// The slice is only valid until the file is written, truncated or closed, and it must not be modified.
+	View(offset int64, n int) ([]byte, error)
+}
+
+// view returns a slice of data in a range, or io.EOF if the range is beyond the data
+func view(data []byte, offset int64, n int) ([]byte, error) {
+	if offset < 0 || n < 0 || offset+int64(n) > int64(len(data)) {
+		return nil, io.EOF
+	}
+	return data[offset : offset+int64(n) : offset+int64(n)], nil
+}
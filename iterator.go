@@ -2,6 +2,8 @@ package baradb
 
 import (
 	"bytes"
+	"context"
+	"time"
 
 	"github.com/saint-yellow/baradb/index"
 )
@@ -11,36 +13,80 @@ type Iterator struct {
 	indexIterator index.Iterator        // iterator of an index
 	db            *DB                   // DB engine
 	options       index.IteratorOptions // options of an iterator of an index
+	ctx           context.Context       // context which stops the iteration once it is done
+	err           error                 // error of the iterator of the index if it failed to be initialized
 }
 
 // NewItrerator initializes an iterator of DB engine
+//
+// The iterator is invalid if the iterator of the index fails to be initialized, see Err.
 func (db *DB) NewItrerator(options index.IteratorOptions) *Iterator {
+	// An index which does not keep keys reads them from data files, which are rotated under the lock
+	db.mu.RLock()
+	indexIterator, err := db.index.Iterator(options.Reverse)
+	db.mu.RUnlock()
 	iterator := &Iterator{
-		indexIterator: db.index.Iterator(options.Reverse),
+		indexIterator: indexIterator,
 		db:            db,
 		options:       options,
+		ctx:           context.Background(),
+		err:           classifyError(err),
 	}
 
 	return iterator
 }
 
+// NewIteratorContext is like NewItrerator, but the iterator becomes invalid once the context is done, see Err
+//
+// It returns the error of the context if the context is done before the iterator is initialized.
+func (db *DB) NewIteratorContext(ctx context.Context, options index.IteratorOptions) (*Iterator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	iterator := db.NewItrerator(options)
+	if iterator.err != nil {
+		return nil, iterator.err
+	}
+	iterator.ctx = ctx
+	return iterator, nil
+}
+
 func (it *Iterator) Rewind() {
+	if it.err != nil {
+		return
+	}
 	it.indexIterator.Rewind()
 	it.skipToNext()
 }
 
 func (it *Iterator) Seek(key []byte) {
+	if it.err != nil {
+		return
+	}
 	it.indexIterator.Seek(key)
 	it.skipToNext()
 }
 
 func (it *Iterator) Next() {
+	if it.err != nil {
+		return
+	}
 	it.indexIterator.Next()
 	it.skipToNext()
 }
 
 func (it *Iterator) Valid() bool {
-	return it.indexIterator.Valid()
+	return it.err == nil && it.ctx.Err() == nil && it.indexIterator.Valid()
+}
+
+// Err returns the error of the iterator of the index if it failed to be initialized,
+// or the error of the context of the iterator if the context is done
+func (it *Iterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.ctx.Err()
 }
 
 func (it *Iterator) Key() []byte {
@@ -48,6 +94,9 @@ func (it *Iterator) Key() []byte {
 }
 
 func (it *Iterator) Value() ([]byte, error) {
+	if err := it.ctx.Err(); err != nil {
+		return nil, err
+	}
 	lrp := it.indexIterator.Value()
 
 	it.db.mu.RLock()
@@ -56,21 +105,69 @@ func (it *Iterator) Value() ([]byte, error) {
 	return it.db.getValueByPosition(lrp)
 }
 
+// Meta returns metadata of the value of the current key
+func (it *Iterator) Meta() (*Meta, error) {
+	lrp := it.indexIterator.Value()
+
+	it.db.mu.RLock()
+	defer it.db.mu.RUnlock()
+
+	lr, err := it.db.getLogRecordByPosition(lrp)
+	if err != nil {
+		return nil, err
+	}
+	return newMeta(lr, lrp), nil
+}
+
 func (it *Iterator) Close() {
+	if it.err != nil {
+		return
+	}
 	it.indexIterator.Close()
 }
 
-// skipToNext skips keys if Prefix of IteratorOptions is not nil
+// skipToNext skips keys which do not match Prefix or the modification time window of IteratorOptions
 func (it *Iterator) skipToNext() {
 	prefixLength := len(it.options.Prefix)
-	if prefixLength == 0 {
+	inWindow := !it.options.ModifiedSince.IsZero() || !it.options.ModifiedBefore.IsZero()
+	if prefixLength == 0 && !inWindow {
 		return
 	}
 
-	for ; it.indexIterator.Valid(); it.indexIterator.Next() {
+	for ; it.Valid(); it.indexIterator.Next() {
 		key := it.indexIterator.Key()
-		if prefixLength <= len(key) && bytes.Equal(it.options.Prefix, key[:prefixLength]) {
+		if prefixLength > len(key) || !bytes.Equal(it.options.Prefix, key[:prefixLength]) {
+			continue
+		}
+		if !inWindow || it.isModifiedInWindow() {
 			break
 		}
 	}
 }
+
+// isModifiedInWindow reports whether the value of the current key was written in the modification time window
+//
+// A value whose timestamp is unknown is out of any window,
+// while a value which can not be read is kept so that Value reports the error.
+func (it *Iterator) isModifiedInWindow() bool {
+	lrp := it.indexIterator.Value()
+
+	it.db.mu.RLock()
+	lr, err := it.db.getLogRecordByPosition(lrp)
+	it.db.mu.RUnlock()
+	if err != nil {
+		return true
+	}
+	if lr.Timestamp == 0 {
+		return false
+	}
+
+	timestamp := time.Unix(0, lr.Timestamp)
+	if !it.options.ModifiedSince.IsZero() && timestamp.Before(it.options.ModifiedSince) {
+		return false
+	}
+	if !it.options.ModifiedBefore.IsZero() && !timestamp.Before(it.options.ModifiedBefore) {
+		return false
+	}
+	return true
+}
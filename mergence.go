@@ -1,29 +1,69 @@
 package baradb
 
 import (
+	"context"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"sync"
 
+	"github.com/saint-yellow/baradb/bloom"
 	"github.com/saint-yellow/baradb/data"
+	"github.com/saint-yellow/baradb/index"
+	"github.com/saint-yellow/baradb/io_handler"
+	"github.com/saint-yellow/baradb/metrics"
 	"github.com/saint-yellow/baradb/utils"
 )
 
 const (
 	mergenceFolderSuffix = "-merge"
 	mergedLogRecordKey   = "merged"
+
+	// mergenceReadSize Number of bytes of a data file which the mergence reads at a time (unit: B)
+	mergenceReadSize = 1024 * 1024
+
+	// mergenceReadConcurrency Number of data files which the mergence reads concurrently ahead of the log records it handles
+	mergenceReadConcurrency = 4
 )
 
+// mergenceBatch represents log records which are read at a time from a data file to be merged
+type mergenceBatch struct {
+	lrs   []*data.LogRecord
+	sizes []int64
+	err   error
+}
+
 // Merge clears invalid data files and generates hint files
 func (db *DB) Merge() error {
+	return db.MergeContext(context.Background())
+}
+
+// MergeContext is like Merge, but it stops between batches of log records and returns the error of the context once the context is done
+//
+// A mergence which is stopped leaves data files as they are, and what it has written is discarded.
+func (db *DB) MergeContext(ctx context.Context) (err error) {
+	defer db.startOperation(ctx, metrics.OperationMerge)(&err)
+	defer func() {
+		err = classifyError(err)
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	// The DB has no any data file
 	if db.activeFile == nil {
 		return nil
 	}
 
+	// Merged data files are moved into the directory of the DB at the next launch, which is impossible in memory
+	if db.options.IOHandlerType == io_handler.InMemoryIOHandler {
+		return ErrMergenceNotSupported
+	}
+
 	db.mu.Lock()
 
 	// The DB can only do mergence once in the same time
@@ -38,7 +78,7 @@ func (db *DB) Merge() error {
 		db.mu.Unlock()
 		return err
 	}
-	propagation := float64(db.reclaimSize) / float64(totalSize)
+	propagation := float64(db.reclaimSize.Load()) / float64(totalSize)
 	if db.options.MergenceThreshold != 0 && propagation < db.options.MergenceThreshold {
 		db.mu.Unlock()
 		return nil
@@ -50,7 +90,7 @@ func (db *DB) Merge() error {
 		db.mu.Unlock()
 		return err
 	}
-	if totalSize-db.reclaimSize >= availableSize {
+	if totalSize-db.reclaimSize.Load() >= availableSize {
 		return ErrNoMoreDiskSpace
 	}
 
@@ -64,9 +104,15 @@ func (db *DB) Merge() error {
 		db.mu.Unlock()
 		return err
 	}
+	if err := db.activeFile.Seal(); err != nil {
+		db.mu.Unlock()
+		return err
+	}
+
+	// Records of files to be merged are checked against the index
+	db.waitForPublishes()
 
 	// The current active data file will be inactive
-	nonMergedFileID := db.activeFile.FileID
 	db.inactiveFiles[db.activeFile.FileID] = db.activeFile
 
 	// Generate a new active data file
@@ -75,12 +121,24 @@ func (db *DB) Merge() error {
 		return err
 	}
 
+	// Data files before the new active one are merged, so they are replaced by merged ones at the next launch
+	nonMergedFileID := db.activeFile.FileID
+
 	// All the inactive data file are files to be merged
 	var filesToBeMerged []*data.DataFile
 	for _, file := range db.inactiveFiles {
 		filesToBeMerged = append(filesToBeMerged, file)
 	}
 
+	// Old versions retained by the history are kept as well as the latest ones
+	retainedPositions := db.retainedPositions()
+
+	// Log records of column families which are dropped during the mergence are kept until the next one
+	families := make(map[uint32]*ColumnFamily, len(db.familiesByID))
+	for id, cf := range db.familiesByID {
+		families[id] = cf
+	}
+
 	db.mu.Unlock()
 
 	// Sort the files to be merged by their FileIDs
@@ -104,6 +162,11 @@ func (db *DB) Merge() error {
 	mergenceOptions := db.options
 	mergenceOptions.Directory = md
 	mergenceOptions.SyncWrites = false
+	mergenceOptions.CheckpointInterval = 0
+	mergenceOptions.CheckpointAtClose = false
+	mergenceOptions.BloomFilterFalsePositiveRate = 0
+	mergenceOptions.HistoryVersions = 0
+	mergenceOptions.HistoryRetention = 0
 	tempDB, err := Launch(mergenceOptions)
 	if err != nil {
 		return err
@@ -115,36 +178,95 @@ func (db *DB) Merge() error {
 	if err != nil {
 		return err
 	}
+	hintFile.SetCipher(db.cipher)
+
+	// Rebuild the Bloom filter from the merged keys
+	var filter *bloom.Filter
+	if db.options.BloomFilterFalsePositiveRate > 0 {
+		filter = db.newBloomFilter(db.index.Size())
+	}
+
+	// Bytes of the files to be merged and bytes written by the mergence, whose difference is reclaimed
+	var mergedBytes, writtenBytes int64
 
-	// Handle every file to be merged
-	for _, file := range filesToBeMerged {
+	// Handle every file to be merged, whose log records are read in batches ahead of the mergence
+	done := make(chan struct{})
+	readers := new(sync.WaitGroup)
+	defer func() {
+		close(done)
+		readers.Wait()
+	}()
+	batches := readMergenceBatches(filesToBeMerged, done, readers)
+	for fi, file := range filesToBeMerged {
 		var offset int64 = 0
-		for {
-			lr, n, err := file.ReadLogRecord(offset)
-			if err != nil {
-				if err == io.EOF {
-					break
-				}
+		for batch := range batches[fi] {
+			if err := ctx.Err(); err != nil {
 				return err
 			}
+			if batch.err != nil {
+				return batch.err
+			}
 
-			lrKey, _ := data.DecodeKey(lr.Key)
-			lrp := db.index.Get(lrKey)
-			if lrp != nil && lrp.FileID == file.FileID && lrp.Offset == offset {
-				lr.Key = data.EncodeKey(lrKey, nonTranNo)
-				mlrp, err := tempDB.appendLogRecord(lr, false)
+			for i, lr := range batch.lrs {
+				n := batch.sizes[i]
+				mergedBytes += n
+
+				// Log records of dropped column families and expired ones are discarded
+				// An index which does not keep keys reads them from data files, which are rotated under the lock
+				lrKey, _ := data.DecodeKey(lr.Key)
+				var lrp *data.LogRecordPosition
+				db.mu.RLock()
+				if lr.Family == 0 {
+					lrp, err = db.index.Get(lrKey)
+				} else if cf, ok := families[lr.Family]; ok && !cf.isExpired(lr) {
+					lrp, err = cf.index.Get(lrKey)
+				}
+				db.mu.RUnlock()
 				if err != nil {
 					return err
 				}
+				position := data.LogRecordPosition{FileID: file.FileID, Offset: offset, Size: uint32(n)}
+				latest := lrp != nil && lrp.FileID == file.FileID && lrp.Offset == offset
+				_, retained := retainedPositions[position]
+
+				// Chains of merge operands in merged data files are collapsed into values
+				var collapsed, keep bool
+				if lr.Family == 0 && len(db.options.MergeOperators) > 0 {
+					var value []byte
+					collapsed, value, keep, err = db.collapseMergeOperands(lrKey, position, nonMergedFileID)
+					if err != nil {
+						return err
+					}
+					if collapsed {
+						lr.Value = value
+						lr.Type = data.NormalLogRecord
+					}
+				}
 
-				// Write the current position index to the hint file
-				if err := data.WriteHintRecord(hintFile, lrKey, mlrp); err != nil {
-					return err
+				if latest || retained || collapsed || keep {
+					// The write timestamp of the log record is kept
+					lr.Key = data.EncodeKey(lrKey, nonTranNo)
+					mlrp, err := tempDB.appendLogRecord(lr, false)
+					if err != nil {
+						return err
+					}
+					writtenBytes += int64(mlrp.Size)
+
+					// Only the latest version of a key is indexed, and column families rebuild their indexes from data files
+					if latest && lr.Family == 0 {
+						// Write the current position index to the hint file
+						if err := data.WriteHintRecord(hintFile, lrKey, mlrp); err != nil {
+							return err
+						}
+
+						if filter != nil {
+							filter.Add(lrKey)
+						}
+					}
 				}
 
+				offset += n
 			}
-
-			offset += n
 		}
 	}
 
@@ -156,6 +278,14 @@ func (db *DB) Merge() error {
 		return err
 	}
 
+	// The rebuilt filter covers the merged data files, data files which are not merged are added at the next launch
+	if filter != nil {
+		position := &data.LogRecordPosition{FileID: nonMergedFileID}
+		if err := writeBloomFilter(md, db.cipher, filter, position); err != nil {
+			return err
+		}
+	}
+
 	mergedFile, err := data.OpenMergedFile(md)
 	if err != nil {
 		return err
@@ -171,10 +301,67 @@ func (db *DB) Merge() error {
 	if err := mergedFile.Sync(); err != nil {
 		return err
 	}
+
+	if mergedBytes > writtenBytes {
+		db.instruments.reclaimedBytes.Add(uint64(mergedBytes - writtenBytes))
+	}
 	return nil
 }
 
 // getMergenceDiretory returns a directory for merging data
+// readMergenceBatches reads data files to be merged in batches of log records,
+// where up to mergenceReadConcurrency data files are read concurrently
+//
+// Batches of every data file are sent to a channel of the data file in order, which is closed after the last batch or an error.
+// Data files start to be read in order, so the mergence never waits for a data file which is not being read.
+// Reading stops once the done channel is closed, and every goroutine which reads is counted by the wait group.
+func readMergenceBatches(files []*data.DataFile, done <-chan struct{}, readers *sync.WaitGroup) []chan mergenceBatch {
+	batches := make([]chan mergenceBatch, len(files))
+	for i := range batches {
+		batches[i] = make(chan mergenceBatch, 1)
+	}
+
+	slots := make(chan struct{}, mergenceReadConcurrency)
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for i, file := range files {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+
+			readers.Add(1)
+			go func(file *data.DataFile, batches chan<- mergenceBatch) {
+				defer readers.Done()
+				defer func() { <-slots }()
+				defer close(batches)
+
+				var offset int64 = 0
+				for {
+					lrs, sizes, err := file.ReadLogRecordsFrom(offset, mergenceReadSize)
+					if err == io.EOF {
+						return
+					}
+					select {
+					case batches <- mergenceBatch{lrs: lrs, sizes: sizes, err: err}:
+					case <-done:
+						return
+					}
+					if err != nil {
+						return
+					}
+					for _, size := range sizes {
+						offset += size
+					}
+				}
+			}(file, batches[i])
+		}
+	}()
+	return batches
+}
+
 func (db *DB) getMergenceDiretory() string {
 	parentDirectory := path.Dir(db.options.Directory)
 	basename := path.Base(db.options.Directory)
@@ -202,7 +389,7 @@ func (db *DB) loadMergenceFiles() error {
 		if entry.Name() == data.MergedFileName {
 			mergenceFinished = true
 		}
-		if entry.Name() == data.TranNoFileName {
+		if entry.Name() == data.TranNoFileName || entry.Name() == index.FileName(db.options.IndexType) {
 			continue
 		}
 		mergedFileNames = append(mergedFileNames, entry.Name())
@@ -227,6 +414,27 @@ func (db *DB) loadMergenceFiles() error {
 		}
 	}
 
+	// Positions in the index checkpoint are outdated since the merged data files are replaced
+	checkpointFilePath := filepath.Join(db.options.Directory, data.CheckpointFileName)
+	if err := os.RemoveAll(checkpointFilePath); err != nil {
+		return err
+	}
+
+	// Positions in a persistent index are outdated since the merged data files are replaced,
+	// so the index has to be rebuilt
+	if index.IsPersistent(db.options.IndexType) {
+		indexFilePath := filepath.Join(db.options.Directory, index.FileName(db.options.IndexType))
+		if err := os.RemoveAll(indexFilePath); err != nil {
+			return err
+		}
+	}
+
+	// The Bloom filter covers positions of the merged data files, so it is replaced by the rebuilt one if any
+	bloomFilterFilePath := filepath.Join(db.options.Directory, data.BloomFilterFileName)
+	if err := os.RemoveAll(bloomFilterFilePath); err != nil {
+		return err
+	}
+
 	for _, fileName := range mergedFileNames {
 		srcPath := filepath.Join(md, fileName)
 		dstPath := filepath.Join(db.options.Directory, fileName)
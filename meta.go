@@ -0,0 +1,81 @@
+package baradb
+
+import (
+	"context"
+	"time"
+
+	"github.com/saint-yellow/baradb/data"
+	"github.com/saint-yellow/baradb/metrics"
+)
+
+// Meta represents metadata of a value in the DB engine
+type Meta struct {
+	Timestamp time.Time // When the value was written, it is the zero time if unknown
+	Size      uint32    // Size of the log record of the value on disk (unit: B)
+}
+
+// newMeta constructs metadata of a value from its log record
+func newMeta(lr *data.LogRecord, lrp *data.LogRecordPosition) *Meta {
+	meta := &Meta{Size: lrp.Size}
+	if lr.Timestamp != 0 {
+		meta.Timestamp = time.Unix(0, lr.Timestamp)
+	}
+	return meta
+}
+
+// timestampsEnabled reports whether the DB engine stores write timestamps in log records
+//
+// Log records are timestamped while any column family exists as well, since values of a column family may expire.
+func (db *DB) timestampsEnabled() bool {
+	return db.options.TimestampLogRecords || db.historyEnabled() || len(db.families) > 0
+}
+
+// nextTimestamp returns a write timestamp for a new log record, which is greater than all previous ones
+// even if the clock goes backwards, or 0 if log records are not timestamped
+//
+// The caller must hold the lock of the DB engine.
+func (db *DB) nextTimestamp() int64 {
+	if !db.timestampsEnabled() {
+		return 0
+	}
+
+	timestamp := time.Now().UnixNano()
+	if timestamp <= db.lastTimestamp {
+		timestamp = db.lastTimestamp + 1
+	}
+	db.lastTimestamp = timestamp
+	return timestamp
+}
+
+// GetWithMeta Reads data and its metadata from the DB engine by a given key
+//
+// The timestamp of the value is known only if it was written with TimestampLogRecords of DBOptions or the history enabled.
+func (db *DB) GetWithMeta(key []byte) (value []byte, meta *Meta, err error) {
+	defer db.startOperation(context.Background(), metrics.OperationGet)(&err)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if len(key) == 0 {
+		return nil, nil, ErrKeyIsEmpty
+	}
+
+	if !db.mayContain(key) {
+		return nil, nil, ErrKeyNotFound
+	}
+
+	lrp, lr, err := db.lookup(db.index, key)
+	if err != nil {
+		return nil, nil, classifyError(err)
+	}
+	if lrp == nil {
+		return nil, nil, ErrKeyNotFound
+	}
+
+	if lr == nil {
+		if lr, err = db.getLogRecordByPosition(lrp); err != nil {
+			return nil, nil, classifyError(err)
+		}
+	}
+	return lr.Value, newMeta(lr, lrp), nil
+}
@@ -0,0 +1,139 @@
+package baradb
+
+import (
+	"context"
+	"time"
+
+	"github.com/saint-yellow/baradb/metrics"
+)
+
+// metricPrefix is the prefix of names of metrics of the DB engine
+const metricPrefix = "baradb_"
+
+// operationInstruments measure an operation of the DB engine
+type operationInstruments struct {
+	count   metrics.Counter    // Number of calls of the operation
+	errors  metrics.Counter    // Number of calls which failed, a key which is not found is not a failure
+	latency *metrics.Histogram // Latencies of calls of the operation (unit: second)
+}
+
+// instruments measure the DB engine since it is launched
+type instruments struct {
+	operations     map[metrics.Operation]*operationInstruments // Instruments of operations, which are never modified after construction
+	reclaimedBytes metrics.Counter                             // Bytes of data files reclaimed by mergence
+	fileRotations  metrics.Counter                             // Number of active data files which are full and replaced by new ones
+}
+
+func newInstruments() *instruments {
+	ins := &instruments{
+		operations: make(map[metrics.Operation]*operationInstruments, len(metrics.Operations)),
+	}
+	for _, operation := range metrics.Operations {
+		ins.operations[operation] = &operationInstruments{
+			latency: metrics.NewHistogram(metrics.DefaultLatencyBuckets),
+		}
+	}
+	return ins
+}
+
+// startOperation records the start of an operation and calls the tracer if any,
+// and returns a function which records the end of the operation with the error it returns
+//
+// It is used as `defer db.startOperation(ctx, operation)(&err)` with a named error result.
+func (db *DB) startOperation(ctx context.Context, operation metrics.Operation) func(err *error) {
+	start := time.Now()
+	var endTrace func(error)
+	if db.options.Tracer != nil {
+		endTrace = db.options.Tracer.StartOperation(ctx, operation)
+	}
+
+	return func(err *error) {
+		oi := db.instruments.operations[operation]
+		oi.count.Inc()
+		if *err != nil && *err != ErrKeyNotFound {
+			oi.errors.Inc()
+		}
+		oi.latency.ObserveDuration(time.Since(start))
+		if endTrace != nil {
+			endTrace(*err)
+		}
+	}
+}
+
+// startSync records the start of a sync of a data file of the DB engine as a sync operation,
+// and returns a function which records the end of the sync with its error
+//
+// It is set as the sync tracer of data files, so that every sync is measured wherever it is issued.
+func (db *DB) startSync() func(error) {
+	end := db.startOperation(context.Background(), metrics.OperationSync)
+	return func(err error) {
+		end(&err)
+	}
+}
+
+// Metrics returns metrics of the DB engine since it is launched, which makes the DB engine a metrics.Collector
+//
+// Unlike Stat, it does not read the directory of the DB engine, so it is cheap enough to be scraped frequently.
+// Metrics can be exported in the Prometheus text format by metrics.Handler.
+func (db *DB) Metrics() []metrics.Metric {
+	var ms []metrics.Metric
+	ins := db.instruments
+
+	counter := func(name, help string, value uint64, labels ...metrics.Label) {
+		ms = append(ms, metrics.Metric{
+			Name:   metricPrefix + name,
+			Help:   help,
+			Type:   metrics.CounterType,
+			Labels: labels,
+			Value:  float64(value),
+		})
+	}
+	gauge := func(name, help string, value float64) {
+		ms = append(ms, metrics.Metric{
+			Name:  metricPrefix + name,
+			Help:  help,
+			Type:  metrics.GaugeType,
+			Value: value,
+		})
+	}
+	operationLabel := func(operation metrics.Operation) metrics.Label {
+		return metrics.Label{Name: "operation", Value: string(operation)}
+	}
+
+	for _, operation := range metrics.Operations {
+		counter("operations_total", "Number of operations.", ins.operations[operation].count.Value(), operationLabel(operation))
+	}
+	for _, operation := range metrics.Operations {
+		counter("operation_errors_total", "Number of failed operations.", ins.operations[operation].errors.Value(), operationLabel(operation))
+	}
+	for _, operation := range metrics.Operations {
+		ms = append(ms, metrics.Metric{
+			Name:      metricPrefix + "operation_duration_seconds",
+			Help:      "Latencies of operations in seconds.",
+			Type:      metrics.HistogramType,
+			Labels:    []metrics.Label{operationLabel(operation)},
+			Histogram: ins.operations[operation].latency.Snapshot(),
+		})
+	}
+	counter("merge_reclaimed_bytes_total", "Bytes of data files reclaimed by mergence.", ins.reclaimedBytes.Value())
+	counter("file_rotations_total", "Number of active data files replaced by new ones.", ins.fileRotations.Value())
+
+	db.mu.RLock()
+	dataFileNumber := len(db.inactiveFiles)
+	if db.activeFile != nil {
+		dataFileNumber++
+	}
+	gauge("keys", "Number of keys.", float64(db.index.Size()))
+	gauge("data_files", "Number of data files.", float64(dataFileNumber))
+	gauge("reclaimable_bytes", "Bytes of invalid data which can be reclaimed by mergence.", float64(db.reclaimSize.Load()))
+	db.mu.RUnlock()
+
+	if db.cache != nil {
+		cacheStat := db.cache.Stat()
+		counter("cache_hits_total", "Number of reads served by the value cache.", cacheStat.Hits)
+		counter("cache_misses_total", "Number of reads missed by the value cache.", cacheStat.Misses)
+		gauge("cache_size_bytes", "Memory occupied by the value cache in bytes.", float64(cacheStat.Size))
+	}
+
+	return ms
+}
@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Operation names an operation of a DB engine which is measured and traced
+type Operation string
+
+// Operations of a DB engine
+const (
+	OperationGet    Operation = "get"
+	OperationPut    Operation = "put"
+	OperationDelete Operation = "delete"
+	OperationCommit Operation = "commit"
+	OperationSync   Operation = "sync"
+	OperationMerge  Operation = "merge"
+)
+
+// Operations lists all operations of a DB engine
+var Operations = []Operation{
+	OperationGet,
+	OperationPut,
+	OperationDelete,
+	OperationCommit,
+	OperationSync,
+	OperationMerge,
+}
+
+// Tracer receives hook points around operations of a DB engine, for example to record spans of a tracing system
+//
+// StartOperation is called when an operation starts with the context of the operation,
+// which is context.Background() if the operation has no context.
+// The returned function is called once the operation ends with its error, it may be nil.
+// A tracer is called concurrently, so it should be safe for concurrent use.
+type Tracer interface {
+	StartOperation(ctx context.Context, operation Operation) func(err error)
+}
+
+// TracerFunc is an adapter which allows a function to be used as a Tracer
+type TracerFunc func(ctx context.Context, operation Operation) func(err error)
+
+func (f TracerFunc) StartOperation(ctx context.Context, operation Operation) func(err error) {
+	return f(ctx, operation)
+}
+
+// Counter represents a value which only increases, it is safe for concurrent use
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Add increases the counter by a given delta
+func (c *Counter) Add(delta uint64) {
+	c.value.Add(delta)
+}
+
+// Inc increases the counter by 1
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Value returns the current value of the counter
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+// DefaultLatencyBuckets are upper bounds of buckets of a histogram of latencies (unit: second), from 10µs to 10s
+var DefaultLatencyBuckets = []float64{
+	0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005,
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05,
+	0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// Histogram counts observed values in buckets, it is safe for concurrent use
+type Histogram struct {
+	bounds []float64       // Upper bounds of buckets in ascending order
+	counts []atomic.Uint64 // Number of values in every bucket, the last one is for values above all bounds
+	sum    atomic.Uint64   // Bits of the sum of observed values
+}
+
+// HistogramSnapshot represents values observed by a histogram at a moment
+type HistogramSnapshot struct {
+	Bounds []float64 // Upper bounds of buckets in ascending order
+	Counts []uint64  // Cumulative number of values not greater than every bound
+	Count  uint64    // Number of observed values
+	Sum    float64   // Sum of observed values
+}
+
+// NewHistogram constructs a histogram with buckets of given upper bounds
+func NewHistogram(bounds []float64) *Histogram {
+	sorted := append([]float64(nil), bounds...)
+	sort.Float64s(sorted)
+	return &Histogram{
+		bounds: sorted,
+		counts: make([]atomic.Uint64, len(sorted)+1),
+	}
+}
+
+// Observe adds a value to the histogram
+func (h *Histogram) Observe(value float64) {
+	h.counts[sort.SearchFloat64s(h.bounds, value)].Add(1)
+	for {
+		old := h.sum.Load()
+		sum := math.Float64bits(math.Float64frombits(old) + value)
+		if h.sum.CompareAndSwap(old, sum) {
+			return
+		}
+	}
+}
+
+// ObserveDuration adds a duration to the histogram in seconds
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// Snapshot returns values observed by the histogram
+//
+// Values observed during the snapshot may be partly counted.
+func (h *Histogram) Snapshot() *HistogramSnapshot {
+	s := &HistogramSnapshot{
+		Bounds: append([]float64(nil), h.bounds...),
+		Counts: make([]uint64, len(h.bounds)),
+		Sum:    math.Float64frombits(h.sum.Load()),
+	}
+	var cumulative uint64
+	for i := range h.bounds {
+		cumulative += h.counts[i].Load()
+		s.Counts[i] = cumulative
+	}
+	s.Count = cumulative + h.counts[len(h.bounds)].Load()
+	return s
+}
+
+// Type represents the type of a metric
+type Type int8
+
+const (
+	CounterType Type = iota + 1
+	GaugeType
+	HistogramType
+)
+
+func (t Type) String() string {
+	switch t {
+	case CounterType:
+		return "counter"
+	case GaugeType:
+		return "gauge"
+	case HistogramType:
+		return "histogram"
+	default:
+		return "untyped"
+	}
+}
+
+// Label represents a name/value pair which distinguishes metrics of the same name
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Metric represents a collected value of a metric
+type Metric struct {
+	Name      string             // Name of the metric, metrics of the same name should have the same help and type
+	Help      string             // Description of the metric
+	Type      Type               // Type of the metric
+	Labels    []Label            // Labels of the metric
+	Value     float64            // Value of a counter or a gauge
+	Histogram *HistogramSnapshot // Values of a histogram
+}
+
+// Collector provides metrics, for example a DB engine
+type Collector interface {
+	Metrics() []Metric
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	var c Counter
+	assert.Zero(t, c.Value())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(1000), c.Value())
+
+	c.Add(24)
+	assert.Equal(t, uint64(1024), c.Value())
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{1, 0.1, 0.5})
+
+	s := h.Snapshot()
+	assert.Equal(t, []float64{0.1, 0.5, 1}, s.Bounds)
+	assert.Equal(t, []uint64{0, 0, 0}, s.Counts)
+	assert.Zero(t, s.Count)
+	assert.Zero(t, s.Sum)
+
+	// A value equal to a bound is counted in its bucket
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 2} {
+		h.Observe(v)
+	}
+	h.ObserveDuration(250 * time.Millisecond)
+
+	s = h.Snapshot()
+	assert.Equal(t, []uint64{2, 4, 5}, s.Counts)
+	assert.Equal(t, uint64(6), s.Count)
+	assert.InDelta(t, 3.4, s.Sum, 1e-9)
+
+	// Concurrent observations are all counted
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h.Observe(0.01)
+			}
+		}()
+	}
+	wg.Wait()
+	s = h.Snapshot()
+	assert.Equal(t, uint64(1006), s.Count)
+	assert.Equal(t, uint64(1002), s.Counts[0])
+	assert.InDelta(t, 13.4, s.Sum, 1e-9)
+}
+
+func TestTracerFunc(t *testing.T) {
+	var started Operation
+	var ended error
+	var tracer Tracer = TracerFunc(func(ctx context.Context, operation Operation) func(err error) {
+		started = operation
+		return func(err error) {
+			ended = err
+		}
+	})
+
+	end := tracer.StartOperation(context.Background(), OperationGet)
+	assert.Equal(t, OperationGet, started)
+	err := errors.New("114514")
+	end(err)
+	assert.Equal(t, err, ended)
+}
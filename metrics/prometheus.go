@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PrometheusContentType is the content type of the Prometheus text format
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// labelValueReplacer escapes values of labels in the Prometheus text format
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// helpReplacer escapes descriptions of metrics in the Prometheus text format
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// WritePrometheus writes metrics in the Prometheus text format
+//
+// Metrics of the same name should be adjacent, their description and type are written once.
+func WritePrometheus(w io.Writer, metrics []Metric) error {
+	bw := bufio.NewWriter(w)
+	var lastName string
+	for _, m := range metrics {
+		if m.Name != lastName {
+			bw.WriteString("# HELP " + m.Name + " " + helpReplacer.Replace(m.Help) + "\n")
+			bw.WriteString("# TYPE " + m.Name + " " + m.Type.String() + "\n")
+			lastName = m.Name
+		}
+
+		if m.Type != HistogramType || m.Histogram == nil {
+			writeSample(bw, m.Name, m.Labels, m.Value)
+			continue
+		}
+
+		h := m.Histogram
+		for i, bound := range h.Bounds {
+			writeSample(bw, m.Name+"_bucket", withLabel(m.Labels, "le", formatFloat(bound)), float64(h.Counts[i]))
+		}
+		writeSample(bw, m.Name+"_bucket", withLabel(m.Labels, "le", "+Inf"), float64(h.Count))
+		writeSample(bw, m.Name+"_sum", m.Labels, h.Sum)
+		writeSample(bw, m.Name+"_count", m.Labels, float64(h.Count))
+	}
+	return bw.Flush()
+}
+
+// Handler returns an HTTP handler which exports metrics of a collector in the Prometheus text format
+func Handler(c Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", PrometheusContentType)
+		if err := WritePrometheus(w, c.Metrics()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func writeSample(w *bufio.Writer, name string, labels []Label, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label.Name + `="` + labelValueReplacer.Replace(label.Value) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+// withLabel returns labels with an extra one, without modifying the given labels
+func withLabel(labels []Label, name, value string) []Label {
+	return append(append(make([]Label, 0, len(labels)+1), labels...), Label{Name: name, Value: value})
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
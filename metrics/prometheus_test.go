@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testingCollector []Metric
+
+func (c testingCollector) Metrics() []Metric {
+	return c
+}
+
+func TestWritePrometheus(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(3)
+
+	metrics := []Metric{
+		{Name: "baradb_operations_total", Help: "Number of operations.", Type: CounterType, Labels: []Label{{Name: "operation", Value: "get"}}, Value: 3},
+		{Name: "baradb_operations_total", Help: "Number of operations.", Type: CounterType, Labels: []Label{{Name: "operation", Value: "put"}}, Value: 1},
+		{Name: "baradb_keys", Help: "Number of keys.\nIn the index.", Type: GaugeType, Value: 114514},
+		{Name: "baradb_label", Help: "Escaped labels.", Type: GaugeType, Labels: []Label{{Name: "value", Value: "a\"b\\c\nd"}}, Value: math.Inf(1)},
+		{Name: "baradb_duration_seconds", Help: "Latencies.", Type: HistogramType, Labels: []Label{{Name: "operation", Value: "get"}}, Histogram: h.Snapshot()},
+	}
+
+	var buffer bytes.Buffer
+	assert.Nil(t, WritePrometheus(&buffer, metrics))
+	expected := `# HELP baradb_operations_total Number of operations.
+# TYPE baradb_operations_total counter
+baradb_operations_total{operation="get"} 3
+baradb_operations_total{operation="put"} 1
+# HELP baradb_keys Number of keys.\nIn the index.
+# TYPE baradb_keys gauge
+baradb_keys 114514
+# HELP baradb_label Escaped labels.
+# TYPE baradb_label gauge
+baradb_label{value="a\"b\\c\nd"} +Inf
+# HELP baradb_duration_seconds Latencies.
+# TYPE baradb_duration_seconds histogram
+baradb_duration_seconds_bucket{operation="get",le="0.1"} 1
+baradb_duration_seconds_bucket{operation="get",le="1"} 2
+baradb_duration_seconds_bucket{operation="get",le="+Inf"} 3
+baradb_duration_seconds_sum{operation="get"} 3.55
+baradb_duration_seconds_count{operation="get"} 3
+`
+	assert.Equal(t, expected, buffer.String())
+
+	// Labels of a histogram are not modified by the bucket label
+	assert.Len(t, metrics[4].Labels, 1)
+}
+
+func TestHandler(t *testing.T) {
+	c := testingCollector{
+		{Name: "baradb_keys", Help: "Number of keys.", Type: GaugeType, Value: 1919},
+	}
+
+	recorder := httptest.NewRecorder()
+	Handler(c).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, PrometheusContentType, recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "# HELP baradb_keys Number of keys.\n# TYPE baradb_keys gauge\nbaradb_keys 1919\n", recorder.Body.String())
+}
@@ -0,0 +1,314 @@
+package baradb
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+
+	"github.com/saint-yellow/baradb/data"
+	"github.com/saint-yellow/baradb/metrics"
+)
+
+// operandChain represents merge operands of a key which are not resolved yet
+type operandChain struct {
+	base     *data.LogRecordPosition   // Position of the value which operands are merged into, it is nil if there is none
+	operands []*data.LogRecordPosition // Positions of operands in the order of writing
+}
+
+// encodeMergeOperand encodes the name of a merge operator and an operand into the value of a log record
+func encodeMergeOperand(name string, operand []byte) []byte {
+	buffer := make([]byte, binary.MaxVarintLen32+len(name)+len(operand))
+	index := binary.PutUvarint(buffer, uint64(len(name)))
+	index += copy(buffer[index:], name)
+	index += copy(buffer[index:], operand)
+	return buffer[:index]
+}
+
+// decodeMergeOperand decodes the name of a merge operator and an operand from the value of a log record
+func decodeMergeOperand(value []byte) (string, []byte, error) {
+	nameSize, n := binary.Uvarint(value)
+	if n <= 0 || uint64(len(value)-n) < nameSize {
+		return "", nil, ErrMergeOperandUnresolved
+	}
+	return string(value[n : n+int(nameSize)]), value[n+int(nameSize):], nil
+}
+
+// PutMergeOperand writes an operand which is merged into the value of a key by a merge operator when the key is read
+//
+// Unlike MergeWith, the existing value is not read, so writing is as cheap as Put.
+// The operator should be one of MergeOperators of DBOptions.
+// Chains of operands are collapsed into values by mergence.
+func (db *DB) PutMergeOperand(key []byte, name string, operand []byte) (err error) {
+	defer db.startOperation(context.Background(), metrics.OperationPut)(&err)
+
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if _, ok := db.options.MergeOperators[name]; !ok {
+		return ErrMergeFuncNotFound
+	}
+
+	lr := &data.LogRecord{
+		Key:   data.EncodeKey(key, nonTranNo),
+		Value: encodeMergeOperand(name, operand),
+		Type:  data.MergeOperandLogRecord,
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.waitForPublishes()
+
+	// The previous value and operands are still needed to resolve the operand
+	chain, ok := db.operands[string(key)]
+	if !ok {
+		base, err := db.index.Get(key)
+		if err != nil {
+			return classifyError(err)
+		}
+		chain = &operandChain{base: base}
+	}
+
+	lr.Timestamp = db.nextTimestamp()
+	lrp, err := db.appendLogRecord(lr, false)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	if _, err := db.index.Put(key, lrp); err != nil {
+		return classifyError(err)
+	}
+	chain.operands = append(chain.operands, lrp)
+	db.operands[string(key)] = chain
+	db.addToFilter(key)
+	db.addOperandVersion(key, lr.Timestamp, lrp, chain)
+
+	return nil
+}
+
+// dropMergeOperands forgets merge operands of a key which is overwritten or deleted, and counts them as invalid data
+// except the latest one, which is counted by the update of the index
+//
+// The caller must hold the lock of the DB engine.
+func (db *DB) dropMergeOperands(key []byte) {
+	chain, ok := db.operands[string(key)]
+	if !ok {
+		return
+	}
+	delete(db.operands, string(key))
+
+	if chain.base != nil {
+		db.reclaimSize.Add(int64(chain.base.Size))
+	}
+	for _, lrp := range chain.operands[:len(chain.operands)-1] {
+		db.reclaimSize.Add(int64(lrp.Size))
+	}
+}
+
+// resolveMergeOperand merges operands of the key of a given operand up to it into the value of the key
+//
+// The caller must hold the lock of the DB engine.
+func (db *DB) resolveMergeOperand(lr *data.LogRecord, lrp *data.LogRecordPosition) ([]byte, error) {
+	key, _ := data.DecodeKey(lr.Key)
+	chain, ok := db.operands[string(key)]
+	if !ok {
+		return nil, ErrMergeOperandUnresolved
+	}
+	return db.resolveOperandChain(chain, lr, lrp)
+}
+
+// resolveOperandChain merges operands of a given chain up to a given operand into the value of the chain
+//
+// The caller must hold the lock of the DB engine.
+func (db *DB) resolveOperandChain(chain *operandChain, lr *data.LogRecord, lrp *data.LogRecordPosition) ([]byte, error) {
+	key, _ := data.DecodeKey(lr.Key)
+	last := -1
+	for i, p := range chain.operands {
+		if p.FileID == lrp.FileID && p.Offset == lrp.Offset {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		return nil, ErrMergeOperandUnresolved
+	}
+
+	var value []byte
+	if chain.base != nil {
+		var err error
+		value, err = db.getValueByPosition(chain.base)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range chain.operands[:last+1] {
+		olr := lr
+		if p != lrp {
+			file := db.getDataFile(p.FileID)
+			if file == nil {
+				return nil, ErrFileNotFound
+			}
+			var err error
+			olr, err = file.ReadLogRecordAt(p)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		name, operand, err := decodeMergeOperand(olr.Value)
+		if err != nil {
+			return nil, err
+		}
+		fn, ok := db.options.MergeOperators[name]
+		if !ok {
+			return nil, ErrMergeFuncNotFound
+		}
+		value, err = fn(key, value, operand)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// operandChains builds chains of merge operands of keys from log records in the order of writing
+type operandChains struct {
+	values map[string]*data.LogRecordPosition // Positions of the latest values of keys, which operands after them are merged into
+	chains map[string]*operandChain           // Chains of keys whose latest log records are merge operands
+}
+
+func newOperandChains() *operandChains {
+	return &operandChains{
+		values: make(map[string]*data.LogRecordPosition),
+		chains: make(map[string]*operandChain),
+	}
+}
+
+// apply applies a log record of a key, and returns the chain which the log record is added to if it is a merge operand
+func (c *operandChains) apply(key []byte, lrType data.LogRecordType, lrp *data.LogRecordPosition) *operandChain {
+	switch lrType {
+	case data.NormalLogRecord:
+		c.values[string(key)] = lrp
+		delete(c.chains, string(key))
+	case data.DeletedLogRecord:
+		delete(c.values, string(key))
+		delete(c.chains, string(key))
+	case data.MergeOperandLogRecord:
+		chain, ok := c.chains[string(key)]
+		if !ok {
+			chain = &operandChain{base: c.values[string(key)]}
+			c.chains[string(key)] = chain
+		}
+		chain.operands = append(chain.operands, lrp)
+		return chain
+	}
+	return nil
+}
+
+// deleteRange applies a range tombstone from a start key (inclusive) to an end key (exclusive)
+func (c *operandChains) deleteRange(start, end []byte) {
+	for key := range c.values {
+		if inRange([]byte(key), start, end) {
+			delete(c.values, key)
+		}
+	}
+	for key := range c.chains {
+		if inRange([]byte(key), start, end) {
+			delete(c.chains, key)
+		}
+	}
+}
+
+// loadMergeOperands builds chains of merge operands from all data files
+//
+// Like the history, chains are neither persisted nor covered by the hint file,
+// so all data files are read at startup.
+func (db *DB) loadMergeOperands() error {
+	chains := newOperandChains()
+
+	transactionRecords := make(map[uint64][]*data.TransactionRecord)
+	for _, fid := range db.fileIDs {
+		fileID := uint32(fid)
+		file := db.getDataFile(fileID)
+
+		var offset int64 = 0
+		for {
+			lr, n, err := file.ReadLogRecord(offset)
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+
+			lrp := &data.LogRecordPosition{
+				FileID: fileID,
+				Offset: offset,
+				Size:   uint32(n),
+			}
+
+			// Log records written by a transaction are applied once the transaction is finished
+			lrKey, tranNo := data.DecodeKey(lr.Key)
+			switch {
+			case lr.Family != 0:
+				// Column families have no merge operands
+			case lr.Type == data.RangeTombstoneLogRecord:
+				chains.deleteRange(lrKey, lr.Value)
+			case tranNo == nonTranNo:
+				chains.apply(lrKey, lr.Type, lrp)
+			case lr.Type == data.TransactionFinishedLogRecord:
+				for _, tr := range transactionRecords[tranNo] {
+					chains.apply(tr.Log.Key, tr.Log.Type, tr.Position)
+				}
+				delete(transactionRecords, tranNo)
+			default:
+				lr.Key = lrKey
+				tr := &data.TransactionRecord{
+					Log:      lr,
+					Position: lrp,
+				}
+				transactionRecords[tranNo] = append(transactionRecords[tranNo], tr)
+			}
+
+			offset += n
+		}
+	}
+
+	db.operands = chains.chains
+	return nil
+}
+
+// collapseMergeOperands tells mergence how to handle a log record of a key with merge operands.
+//
+// Operands in merged data files are collapsed into the last one of them, whose resolved value is returned,
+// and the value which operands are merged into is kept only if none of them is merged.
+// Other log records of the chain are discarded unless they are retained by the history.
+func (db *DB) collapseMergeOperands(key []byte, lrp data.LogRecordPosition, nonMergedFileID uint32) (collapsed bool, value []byte, keep bool, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	chain, ok := db.operands[string(key)]
+	if !ok {
+		return false, nil, false, nil
+	}
+
+	last := -1
+	for i, p := range chain.operands {
+		if p.FileID < nonMergedFileID {
+			last = i
+		}
+	}
+	if last < 0 {
+		keep = chain.base != nil && chain.base.FileID == lrp.FileID && chain.base.Offset == lrp.Offset
+		return false, nil, keep, nil
+	}
+
+	p := chain.operands[last]
+	if p.FileID != lrp.FileID || p.Offset != lrp.Offset {
+		return false, nil, false, nil
+	}
+	value, err = db.getValueByPosition(p)
+	if err != nil {
+		return false, nil, false, err
+	}
+	return true, value, false, nil
+}
@@ -1,6 +1,13 @@
 package baradb
 
-import "github.com/saint-yellow/baradb/index"
+import (
+	"time"
+
+	"github.com/saint-yellow/baradb/data"
+	"github.com/saint-yellow/baradb/index"
+	"github.com/saint-yellow/baradb/io_handler"
+	"github.com/saint-yellow/baradb/metrics"
+)
 
 // Options represents options of a DB engine instance
 type DBOptions struct {
@@ -28,6 +35,22 @@ type DBOptions struct {
 	// MMapAtStartup indicates whether load memory mapping while starting up the DB engine
 	MMapAtStartup bool
 
+	// IOHandlerType indicates the type of I/O handlers of data files.
+	//
+	// It can be a built-in type or a custom type registered by io_handler.Register.
+	//
+	// Data in an in-memory I/O handler (io_handler.InMemoryIOHandler) is discarded when the DB engine is closed,
+	// so it works with in-memory indexes only and the DB engine can not be merged.
+	//
+	// Data files handled by writable memory mapping (io_handler.WritableMemoryMappedIOHandler) are preallocated,
+	// and both reads and writes are served from the mapping.
+	//
+	// Data files handled by direct I/O (io_handler.DirectIOHandler) are read bypassing the page cache,
+	// and reads of many log records in a batch are issued concurrently.
+	//
+	// If the value is 0, then data files are handled by standard file I/O.
+	IOHandlerType io_handler.IOHandlerType
+
 	// MergenceThreshold indicates a threshold for merging data.
 	//
 	// When proportion of the invalid data in the DB engine is greater than this threshold,
@@ -37,6 +60,80 @@ type DBOptions struct {
 	//
 	// If the value is 0, then this threshold is disabled and the DB engine will not merge its data.
 	MergenceThreshold float64
+
+	// CheckpointInterval indicates how often the DB engine makes a checkpoint of its in-memory index.
+	//
+	// A checkpoint lets the DB engine load the index at startup and only replay data written after it.
+	//
+	// If the value is 0, then the DB engine will not make checkpoints periodically.
+	CheckpointInterval time.Duration
+
+	// CheckpointAtClose indicates whether the DB engine makes a checkpoint of its in-memory index while being closed
+	CheckpointAtClose bool
+
+	// KeyProvider provides keys to encrypt data at rest with AES-GCM.
+	//
+	// If it is set, then log records in data files, the hint file, checkpoints and the file of a hash index are encrypted.
+	// A B+ tree index stores keys in plain text, so it can not be used with encryption.
+	//
+	// To rotate keys, make the provider return a new current key, then merge the DB engine to re-encrypt old data files.
+	// An old key can be removed from the provider once the mergence is done.
+	//
+	// If it is nil, then data is not encrypted.
+	KeyProvider data.KeyProvider
+
+	// CacheSize indicates the maximum memory occupied by the cache of values of hot log records (unit: Byte).
+	//
+	// The cache is sharded and evicts least recently used values.
+	//
+	// If the value is 0, then values are not cached.
+	CacheSize int64
+
+	// BloomFilterFalsePositiveRate indicates the false-positive rate of a Bloom filter of keys in the DB engine.
+	//
+	// Reads and deletions of absent keys are answered by the filter without touching the index,
+	// which saves disk lookups of a persistent index.
+	// The filter is persisted when the DB engine is closed and rebuilt by mergence.
+	//
+	// The value should be between 0 and 1.
+	//
+	// If the value is 0, then the DB engine does not keep a Bloom filter.
+	BloomFilterFalsePositiveRate float64
+
+	// TimestampLogRecords indicates whether the DB engine stores a write timestamp in every log record.
+	//
+	// Timestamps are read by GetWithMeta and iterators, which can scan keys modified in a time window.
+	// Log records written without timestamps, such as ones written before it is enabled, have unknown timestamps.
+	TimestampLogRecords bool
+
+	// HistoryVersions indicates how many versions of every key the DB engine keeps, deletions included.
+	//
+	// Old versions can be read by GetAt and History, and mergence keeps them.
+	// Log records are timestamped while the history is enabled by this option or HistoryRetention, see TimestampLogRecords.
+	//
+	// If the value is 0, then the number of versions is not limited.
+	HistoryVersions int
+
+	// HistoryRetention indicates how long the DB engine keeps versions of every key after they are replaced.
+	//
+	// The version which was current at the beginning of the window is kept as well.
+	// It works together with HistoryVersions, a version is kept only if both options keep it.
+	//
+	// If the value is 0, then the age of versions is not limited.
+	HistoryRetention time.Duration
+
+	// MergeOperators indicates merge functions by their names, whose operands are written by PutMergeOperand
+	// and merged into values lazily when they are read.
+	//
+	// Operands are resolved by the same functions after restarts, so the functions should not be changed or removed.
+	// Chains of operands are loaded at startup only if the value is not empty.
+	MergeOperators map[string]MergeFunc
+
+	// Tracer receives hook points around Get, Put, Delete, Commit, Sync and Merge, see metrics.Tracer.
+	//
+	// Operations are measured whether it is set or not, see Metrics.
+	// If it is nil, then operations are not traced.
+	Tracer metrics.Tracer
 }
 
 // checkDBOptions return nil if all DB options are valid and a certain error otherwise.
@@ -53,6 +150,34 @@ func checkDBOptions(options DBOptions) error {
 		return ErrInvalidMergenceThreshold
 	}
 
+	if options.CheckpointInterval < 0 {
+		return ErrInvalidCheckpointInterval
+	}
+
+	if options.CacheSize < 0 {
+		return ErrInvalidCacheSize
+	}
+
+	if options.BloomFilterFalsePositiveRate < 0 || options.BloomFilterFalsePositiveRate >= 1 {
+		return ErrInvalidBloomFilterFalsePositiveRate
+	}
+
+	if options.HistoryVersions < 0 || options.HistoryRetention < 0 {
+		return ErrInvalidHistoryOptions
+	}
+
+	if options.KeyProvider != nil && options.IndexType == index.BPtree {
+		return ErrEncryptionNotSupported
+	}
+
+	if !io_handler.IsRegistered(options.IOHandlerType) {
+		return ErrUnsupportedIOHandlerType
+	}
+
+	if options.IOHandlerType == io_handler.InMemoryIOHandler && index.IsPersistent(options.IndexType) {
+		return ErrPersistentIndexInMemory
+	}
+
 	return nil
 }
 
@@ -62,18 +187,47 @@ type WriteBatchOptions struct {
 	SyncWrites     bool // Sync data after writing if true
 }
 
+// ColumnFamilyOptions options of a column family
+type ColumnFamilyOptions struct {
+	IndexType   index.IndexType // Type of the index of the column family, which should not be persistent
+	TTL         time.Duration   // Values expire once they are older than it if it is greater than 0
+	Compression bool            // Compresses values of the column family if true
+}
+
+// checkColumnFamilyOptions return nil if all options of a column family are valid and a certain error otherwise.
+func checkColumnFamilyOptions(options ColumnFamilyOptions) error {
+	switch options.IndexType {
+	case index.Btree, index.ARtree, index.Fingerprint, index.ShardedBtree:
+	default:
+		return ErrInvalidColumnFamilyOptions
+	}
+
+	if options.TTL < 0 {
+		return ErrInvalidColumnFamilyOptions
+	}
+
+	return nil
+}
+
 var (
 	// DefaultDBOptions Default options for launching DB engine
 	DefaultDBOptions = DBOptions{
 		Directory:       "/tmp/baradb",
 		MaxDataFileSize: 512 * 1024 * 1024,
 		SyncWrites:      false,
-		IndexType:     index.ARtree,
+		IndexType:       index.ARtree,
 		MMapAtStartup:   false,
+		IOHandlerType:   io_handler.FileIOHandler,
 	}
 	// DefaultWriteBatchOptions Default options for batch writing
 	DefaultWriteBatchOptions = WriteBatchOptions{
 		MaxBatchNumber: 100,
 		SyncWrites:     true,
 	}
+	// DefaultColumnFamilyOptions Default options of a column family
+	DefaultColumnFamilyOptions = ColumnFamilyOptions{
+		IndexType:   index.ARtree,
+		TTL:         0,
+		Compression: false,
+	}
 )
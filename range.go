@@ -0,0 +1,132 @@
+package baradb
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/saint-yellow/baradb/data"
+	"github.com/saint-yellow/baradb/index"
+	"github.com/saint-yellow/baradb/metrics"
+)
+
+// inRange reports whether a key is between a start key (inclusive) and an end key (exclusive),
+// where the range is unbounded if the end key is empty
+func inRange(key, start, end []byte) bool {
+	return bytes.Compare(key, start) >= 0 && (len(end) == 0 || bytes.Compare(key, end) < 0)
+}
+
+// prefixEnd returns the smallest key which is greater than all keys with a given prefix,
+// and nil if there is no such key
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// DeleteRange deletes keys between a start key (inclusive) and an end key (exclusive) atomically
+//
+// Only a single range tombstone is written however many keys are deleted, and mergence drops the deleted log records.
+// Keys from the start key on are deleted if the end key is empty.
+func (db *DB) DeleteRange(start, end []byte) (err error) {
+	defer db.startOperation(context.Background(), metrics.OperationDelete)(&err)
+
+	if len(start) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if len(end) > 0 && bytes.Compare(start, end) >= 0 {
+		return ErrInvalidKeyRange
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.waitForPublishes()
+
+	// Maybe no key is in the range
+	keys, err := db.keysInRange(start, end)
+	if err != nil || len(keys) == 0 {
+		return classifyError(err)
+	}
+
+	lr := &data.LogRecord{
+		Key:       data.EncodeKey(start, nonTranNo),
+		Value:     end,
+		Type:      data.RangeTombstoneLogRecord,
+		Timestamp: db.nextTimestamp(),
+	}
+	lrp, err := db.appendLogRecord(lr, false)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	keys, err = db.deleteRange(start, end, lrp)
+	for _, key := range keys {
+		db.addVersion(key, lr.Timestamp, lrp, true)
+		db.dropMergeOperands(key)
+	}
+	return classifyError(err)
+}
+
+// DeletePrefix deletes keys with a given prefix atomically, see DeleteRange
+//
+// An empty prefix is rejected by DeleteRange, which measures the deletion.
+func (db *DB) DeletePrefix(prefix []byte) error {
+	return db.DeleteRange(prefix, prefixEnd(prefix))
+}
+
+// keysInRange returns keys in the index between a start key (inclusive) and an end key (exclusive)
+//
+// The caller must hold the lock of the DB engine.
+func (db *DB) keysInRange(start, end []byte) ([][]byte, error) {
+	it, err := db.index.Iterator(false)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	// The iterator of a hash index is unordered, so all its keys are checked
+	ordered := db.options.IndexType != index.Hash
+	if ordered {
+		it.Seek(start)
+	} else {
+		it.Rewind()
+	}
+
+	var keys [][]byte
+	for ; it.Valid(); it.Next() {
+		key := it.Key()
+		if ordered && len(end) > 0 && bytes.Compare(key, end) >= 0 {
+			break
+		}
+		if inRange(key, start, end) {
+			keys = append(keys, append([]byte(nil), key...))
+		}
+	}
+	return keys, nil
+}
+
+// deleteRange deletes keys in a range from the index by a range tombstone at a given position, and returns the deleted keys
+//
+// Keys deleted before an error are returned along with the error.
+// The caller must hold the lock of the DB engine.
+func (db *DB) deleteRange(start, end []byte, lrp *data.LogRecordPosition) ([][]byte, error) {
+	keys, err := db.keysInRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+	db.reclaimSize.Add(int64(lrp.Size))
+	for i, key := range keys {
+		oldLRP, _, err := db.index.Delete(key)
+		if err != nil {
+			return keys[:i], err
+		}
+		if oldLRP != nil {
+			db.reclaimSize.Add(int64(oldLRP.Size))
+		}
+	}
+	return keys, nil
+}
@@ -4,19 +4,31 @@ import "fmt"
 
 // Stat represents statistical information of a DB engine
 type Stat struct {
-	KeyNumber       uint  `json:"keyNumber"`       // Number of key(s) in the DB engine
-	DataFileNumber  uint  `json:"dataFileNumber"`  // Number of data file(s) in the DB engine
-	ReclaimableSize int64 `json:"reclaimableSize"` // Amount of mergable data (unit: byte)
-	DiskSize        int64 `json:"diskSize"`        // Size of the DB engine occuppied in disk (unit: byte)
+	KeyNumber       uint   `json:"keyNumber"`       // Number of key(s) in the DB engine
+	DataFileNumber  uint   `json:"dataFileNumber"`  // Number of data file(s) in the DB engine
+	ReclaimableSize int64  `json:"reclaimableSize"` // Amount of mergable data (unit: byte)
+	DiskSize        int64  `json:"diskSize"`        // Size of the DB engine occuppied in disk (unit: byte)
+	CacheHits       uint64 `json:"cacheHits"`       // Number of reads served by the value cache
+	CacheMisses     uint64 `json:"cacheMisses"`     // Number of reads missed by the value cache
+	CacheSize       int64  `json:"cacheSize"`       // Memory occupied by the value cache (unit: byte)
+}
+
+// ColumnFamilyStat represents statistical information of a column family
+type ColumnFamilyStat struct {
+	KeyNumber       uint  `json:"keyNumber"`       // Number of key(s) in the column family, including expired ones which are not merged yet
+	ReclaimableSize int64 `json:"reclaimableSize"` // Amount of mergable data of the column family (unit: byte)
 }
 
 func (s Stat) String() string {
-	tmpl := "Key(s): %d; Data file(s): %d; Reclaimable size: %d B; Disk size: %d B"
+	tmpl := "Key(s): %d; Data file(s): %d; Reclaimable size: %d B; Disk size: %d B; Cache hits: %d; Cache misses: %d; Cache size: %d B"
 	return fmt.Sprintf(
 		tmpl,
 		s.KeyNumber,
 		s.DataFileNumber,
 		s.ReclaimableSize,
 		s.DiskSize,
+		s.CacheHits,
+		s.CacheMisses,
+		s.CacheSize,
 	)
 }
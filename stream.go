@@ -0,0 +1,165 @@
+package baradb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+
+	"github.com/saint-yellow/baradb/data"
+	"github.com/saint-yellow/baradb/metrics"
+)
+
+// PutReader Writes data whose value of a given size is streamed from a reader to the DB engine
+//
+// The value is written to the active data file in chunks, so memory stays bounded regardless of the size of the value.
+// Exactly size bytes are read from the reader, and nothing is written if the reader ends early.
+//
+// The value is spooled to a temporary file before the DB engine is locked for writing,
+// so a slow reader does not stall other operations, and the lock is held while the temporary file is copied.
+// Streaming requires data files whose I/O handler can patch written data, and it does not support encryption.
+func (db *DB) PutReader(key []byte, r io.Reader, size int64) (err error) {
+	defer db.startOperation(context.Background(), metrics.OperationPut)(&err)
+
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if db.cipher != nil {
+		return ErrStreamingNotSupported
+	}
+
+	spool, err := spoolValue(r, size)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.waitForPublishes()
+
+	if db.activeFile == nil {
+		if err := db.setActiveFile(); err != nil {
+			return classifyError(err)
+		}
+	}
+
+	lr := &data.LogRecord{
+		Key:       data.EncodeKey(key, nonTranNo),
+		Type:      data.NormalLogRecord,
+		Timestamp: db.nextTimestamp(),
+	}
+	if err := db.rotateActiveFile(int64(len(lr.Key)) + size); err != nil {
+		return classifyError(err)
+	}
+
+	writeOffset := db.activeFile.WriteOffset
+	n, err := db.activeFile.WriteLogRecordFrom(lr, spool, size)
+	if err != nil {
+		return classifyError(err)
+	}
+
+	// The value has been synced while being written, only the header may need to be synced
+	db.bytesWritten = 0
+	if db.options.SyncWrites {
+		if err := db.activeFile.Sync(); err != nil {
+			return classifyError(err)
+		}
+	}
+
+	lrp := &data.LogRecordPosition{
+		FileID: db.activeFile.FileID,
+		Offset: writeOffset,
+		Size:   uint32(n),
+	}
+	oldLRP, err := db.index.Put(key, lrp)
+	if err != nil {
+		return classifyError(err)
+	}
+	if oldLRP != nil {
+		db.reclaimSize.Add(int64(oldLRP.Size))
+	}
+	db.addToFilter(key)
+	db.addVersion(key, lr.Timestamp, lrp, false)
+	db.dropMergeOperands(key)
+
+	return nil
+}
+
+// spoolValue copies a value of a given size from a reader to a temporary file, and returns the file rewound to its start
+//
+// Errors of the reader are returned as they are, and io.ErrUnexpectedEOF is returned if the reader ends early.
+func spoolValue(r io.Reader, size int64) (*os.File, error) {
+	file, err := os.CreateTemp("", "baradb-stream-*")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.CopyN(file, r, size)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// GetReader Reads data from the DB engine by a given key, the value is streamed from its data file
+//
+// The value is read in chunks while the returned reader is read, and the CRC of the value is validated at its end,
+// so the reader returns data.ErrInvalidCRC instead of io.EOF if the value is corrupted.
+// A value which is encrypted is read and decrypted as a whole.
+//
+// The reader must be closed and it must not be used after the DB engine is closed.
+func (db *DB) GetReader(key []byte) (rc io.ReadCloser, err error) {
+	defer db.startOperation(context.Background(), metrics.OperationGet)(&err)
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+
+	if !db.mayContain(key) {
+		return nil, ErrKeyNotFound
+	}
+
+	lrp, err := db.index.Get(key)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	if lrp == nil {
+		return nil, ErrKeyNotFound
+	}
+
+	file := db.getDataFile(lrp.FileID)
+	if file == nil {
+		return nil, ErrFileNotFound
+	}
+
+	vr, err := file.NewValueReader(lrp)
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	switch vr.Type {
+	case data.DeletedLogRecord:
+		return nil, ErrKeyNotFound
+	case data.MergeOperandLogRecord:
+		value, err := db.getValueByPosition(lrp)
+		if err != nil {
+			return nil, classifyError(err)
+		}
+		return io.NopCloser(bytes.NewReader(value)), nil
+	}
+	return io.NopCloser(vr), nil
+}
@@ -0,0 +1,145 @@
+package baradb
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strconv"
+
+	"github.com/saint-yellow/baradb/metrics"
+)
+
+// MergeFunc merges an operand into the existing value of a key and returns the new value
+//
+// The existing value is nil if the key does not exist, and it must not be modified.
+type MergeFunc = func(key, existing, operand []byte) ([]byte, error)
+
+// update reads the value of a key, computes a new value from it and writes the new value atomically
+//
+// The function is told whether the key exists, since an existing value may be empty.
+// Nothing is written if the function returns false or an error.
+//
+// It is measured as a write, which covers CompareAndSwap, Increment, Append and MergeWith.
+func (db *DB) update(key []byte, fn func(value []byte, exists bool) ([]byte, bool, error)) (err error) {
+	defer db.startOperation(context.Background(), metrics.OperationPut)(&err)
+
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.waitForPublishes()
+
+	value, err := db.get(key)
+	if err != nil && err != ErrKeyNotFound {
+		return classifyError(err)
+	}
+
+	newValue, ok, err := fn(value, err == nil)
+	if err != nil || !ok {
+		return err
+	}
+	return classifyError(db.put(key, newValue))
+}
+
+// CompareAndSwap writes a new value of a key only if its current value equals an old one,
+// and reports whether the new value is written
+//
+// If the old value is nil, then the new value is written only if the key does not exist.
+func (db *DB) CompareAndSwap(key, old, new []byte) (bool, error) {
+	swapped := false
+	err := db.update(key, func(value []byte, exists bool) ([]byte, bool, error) {
+		if (old == nil) == exists || !bytes.Equal(old, value) {
+			return nil, false, nil
+		}
+		swapped = true
+		return new, true, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return swapped, nil
+}
+
+// Increment adds a delta to the integer value of a key and returns the new value
+//
+// Integers are stored in decimal, and a key which does not exist is regarded as 0.
+func (db *DB) Increment(key []byte, delta int64) (int64, error) {
+	var result int64
+	err := db.update(key, func(value []byte, exists bool) ([]byte, bool, error) {
+		var current int64
+		if exists {
+			var err error
+			current, err = strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return nil, false, ErrValueIsNotInteger
+			}
+		}
+		if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+			return nil, false, ErrIntegerOverflow
+		}
+		result = current + delta
+		return []byte(strconv.FormatInt(result, 10)), true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+// Append appends a suffix to the value of a key, a key which does not exist is regarded as an empty value
+func (db *DB) Append(key, suffix []byte) error {
+	return db.update(key, func(value []byte, exists bool) ([]byte, bool, error) {
+		newValue := make([]byte, len(value)+len(suffix))
+		copy(newValue, value)
+		copy(newValue[len(value):], suffix)
+		return newValue, true, nil
+	})
+}
+
+// RegisterMergeFunc registers a merge function with a given name, which is used by MergeWith
+func (db *DB) RegisterMergeFunc(name string, fn MergeFunc) error {
+	if name == "" || fn == nil {
+		return ErrInvalidMergeFunc
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.mergeFuncs[name]; ok {
+		return ErrMergeFuncExists
+	}
+	db.mergeFuncs[name] = fn
+	return nil
+}
+
+// MergeWith merges an operand into the value of a key with a registered merge function atomically, and returns the new value
+//
+// The new value is written as an ordinary log record, see PutMergeOperand for lazy merging.
+// Merge operators of DBOptions can be used as well.
+func (db *DB) MergeWith(key []byte, name string, operand []byte) ([]byte, error) {
+	var result []byte
+	err := db.update(key, func(value []byte, exists bool) ([]byte, bool, error) {
+		fn, ok := db.mergeFuncs[name]
+		if !ok {
+			fn, ok = db.options.MergeOperators[name]
+		}
+		if !ok {
+			return nil, false, ErrMergeFuncNotFound
+		}
+		if exists && value == nil {
+			value = []byte{}
+		}
+		newValue, err := fn(key, value, operand)
+		if err != nil {
+			return nil, false, err
+		}
+		result = newValue
+		return newValue, true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package utils
+
+import "syscall"
+
+// AvailableDiskSize returns available size of the disk of the machine where the DB hosts in
+func AvailableDiskSize() (int64, error) {
+	wd, err := syscall.Getwd()
+	if err != nil {
+		return 0, err
+	}
+
+	var stat syscall.Statfs_t
+	err = syscall.Statfs(wd, &stat)
+	if err != nil {
+		return 0, nil
+	}
+
+	size := int64(stat.Bavail) * int64(stat.Bsize)
+	return size, nil
+}
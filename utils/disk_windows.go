@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// AvailableDiskSize returns available size of the disk of the machine where the DB hosts in
+func AvailableDiskSize() (int64, error) {
+	wd, err := syscall.Getwd()
+	if err != nil {
+		return 0, err
+	}
+	path, err := windows.UTF16PtrFromString(wd)
+	if err != nil {
+		return 0, err
+	}
+
+	var available uint64
+	err = windows.GetDiskFreeSpaceEx(path, &available, nil, nil)
+	if err != nil {
+		return 0, nil
+	}
+
+	return int64(available), nil
+}
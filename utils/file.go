@@ -1,11 +1,11 @@
 package utils
 
 import (
+	"context"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
 )
 
 // DirSize returns the total size (unit: B) of all files in a given directory.
@@ -23,27 +23,15 @@ func DirSize(d string) (int64, error) {
 	return size, err
 }
 
-// AvailableDiskSize returns available size of the disk of the machine where the DB hosts in
-func AvailableDiskSize() (int64, error) {
-	wd, err := syscall.Getwd()
-	if err != nil {
-		return 0, err
-	}
-
-	var stat syscall.Statfs_t
-	err = syscall.Statfs(wd, &stat)
-	if err != nil {
-		return 0, nil
-	}
-
-	size := int64(stat.Bavail) * stat.Bsize
-	return size, nil
-}
-
 // CopyDir copy the data files in a given source directory to a given destination directory
 //
 // Files excluded will be ignored.
 func CopyDir(src, dst string, exclude []string) error {
+	return CopyDirContext(context.Background(), src, dst, exclude)
+}
+
+// CopyDirContext is like CopyDir, but it stops between files and returns the error of the context once the context is done
+func CopyDirContext(ctx context.Context, src, dst string, exclude []string) error {
 	// Make sure the destination directory is exist
 	if _, err := os.Stat(dst); os.IsNotExist(err) {
 		if err := os.MkdirAll(dst, os.ModePerm); err != nil {
@@ -52,6 +40,10 @@ func CopyDir(src, dst string, exclude []string) error {
 	}
 
 	fn := func(path string, info fs.FileInfo, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		fileName := strings.Replace(path, src, "", 1)
 		if fileName == "" {
 			return nil
@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -18,3 +21,19 @@ func TestAvailableDiskSize(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, size >= 0)
 }
+
+func TestCopyDirContext(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "copy")
+	assert.Nil(t, os.WriteFile(filepath.Join(src, "114514"), []byte("1919810"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, CopyDirContext(ctx, src, dst, nil))
+	_, err := os.Stat(filepath.Join(dst, "114514"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, CopyDirContext(context.Background(), src, dst, nil))
+	data, err := os.ReadFile(filepath.Join(dst, "114514"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1919810", string(data))
+}
@@ -3,11 +3,13 @@ package utils
 import (
 	"fmt"
 	"math/rand"
+	"sync"
 	"time"
 )
 
 var (
 	randSeed      = rand.New(rand.NewSource(time.Now().Unix()))
+	randLock      = new(sync.Mutex) // randSeed is not safe for concurrent use
 	letters       = []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
 	keyTemplate   = "baradb-key-%09d"
 	valueTemplate = "baradb-value-%s"
@@ -20,6 +22,9 @@ func NewKey(n int) []byte {
 
 // NewRandomValue generates a random value for testing
 func NewRandomValue(n int) []byte {
+	randLock.Lock()
+	defer randLock.Unlock()
+
 	b := make([]byte, n)
 	for i := range b {
 		b[i] = letters[randSeed.Intn(len(letters))]